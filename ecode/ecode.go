@@ -7,7 +7,11 @@
  */
 package ecode
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/LiPengfei/vlgo/proto/pb_gen"
+)
 
 //go:generate bash parse_code.sh
 type VEI interface {
@@ -35,6 +39,32 @@ func (e *verr) String() string {
 	return e.Error()
 }
 
+// Is same code, used by errors.Is
+func (e *verr) Is(target error) bool {
+	t, ok := target.(*verr)
+	return ok && e != nil && t != nil && t.c == e.c
+}
+
+// Wrap keep the code of e and append detail to message, compare it with errors.Is
+func Wrap(e VEI, detail string) VEI {
+	v, ok := e.(*verr)
+	if !ok || v == nil {
+		return e
+	}
+	return newVError(v.s+": "+detail, v.c)
+}
+
+// ErrInfo code and message of e for the wire, rebuild it by ErrInfo2VEI
+func ErrInfo(e error) *pb_gen.ErrorInfo {
+	if e == nil {
+		return nil
+	}
+	if v, ok := e.(*verr); ok && v != nil {
+		return &pb_gen.ErrorInfo{Code: v.c, Value: v.s}
+	}
+	return &pb_gen.ErrorInfo{Code: ErrUnexpect.c, Value: e.Error()}
+}
+
 func CustomThirdPluginErr(e error) VEI {
 	if e == nil {
 		return nil
@@ -8,11 +8,17 @@
 package gen
 
 import (
+	"context"
+	"fmt"
 	"reflect"
+	"sync"
 	"time"
 	"vlgo/ecode"
+	"vlgo/timerpool"
 	"vlgo/utils"
+	"vlgo/utils/clock"
 
+	"github.com/petermattis/goid"
 	"go.uber.org/atomic"
 )
 
@@ -20,6 +26,17 @@ const (
 	stopReasonPanic = "panic"
 	stopReasonDone  = "done"
 	stopReasonRet   = "ret"
+
+	stopReasonShutdown  = "shutdown"
+	stopReasonLinked    = "linked"
+	stopReasonPassivate = "passivate"
+)
+
+// reasons for Actor.Stop, any other reason is treated as abnormal by Supervisor and Link
+const (
+	StopReasonNormal    = stopReasonDone
+	StopReasonShutdown  = stopReasonShutdown
+	StopReasonPassivate = stopReasonPassivate
 )
 
 const (
@@ -31,10 +48,12 @@ const (
 )
 
 const (
-	genTimeOut     = 7 * time.Second
-	stopTimeOut    = 30 * time.Second
-	MaxMailBoxLen  = 2000
-	GenInitTimeout = time.Second * 10
+	genTimeOut        = 7 * time.Second
+	stopTimeOut       = 30 * time.Second
+	DefaultMailBoxLen = 1000
+	MaxMailBoxLen     = 2000
+	SysMailBoxLen     = 100
+	GenInitTimeout    = time.Second * 10
 )
 
 // callNoReply 返回这个的时候，表示后续会处理然后主动call调用者，不堵塞gen_server。但是堵塞调用者
@@ -55,7 +74,52 @@ type Actor struct {
 	InterruptBox chan time.Duration
 	DefaultOut   time.Duration
 
+	// MailboxLen mailbox capacity, DefaultMailBoxLen if 0, at most MaxMailBoxLen
+	MailboxLen int
+	// Overflow what to do when mailbox full, BlockTimeout only used by OverflowBlock, 0 block forever
+	Overflow     OverflowPolicy
+	BlockTimeout time.Duration
+
 	IsStopped *atomic.Bool
+	dropped   atomic.Uint64
+
+	// sysBox and highBox drained before Mailbox, see Priority
+	sysBox  chan interface{}
+	highBox chan interface{}
+
+	// StopOnPanic stop the loop when handler panic instead of skipping the message, used by Supervisor
+	StopOnPanic bool
+	// TrapExit receive *ActorDown when a linked actor stopped, instead of stopping together
+	TrapExit bool
+	// DrainOnStop handle mails already in mailbox before stop by Stop
+	DrainOnStop bool
+	// Sched run the actor on scheduler workers instead of its own goroutine
+	Sched *Scheduler
+	// Wheel run AfterCast and named timers on a timing wheel instead of runtime timers, for actors
+	// with lots of timers, e.g. timerpool.DefaultWheel()
+	Wheel *timerpool.Wheel
+
+	stopReason string
+	stopErr    ecode.VEI
+	loopGoID   int64
+	done       chan struct{}
+
+	// curChain actors waiting synchronously on the call being handled, include self
+	curChain []*Actor
+
+	sched  actorSched
+	stats  actorStats
+	timers actorTimers
+
+	pendingMu sync.Mutex
+	replySeq  uint64
+	pending   map[uint64]*pendingCall
+
+	exitMu    sync.Mutex
+	exited    bool
+	hookSeq   uint64
+	exitHooks map[uint64]func(reason string, err ecode.VEI)
+	links     map[*Actor]uint64
 }
 
 type ActorHandlerI interface {
@@ -69,26 +133,48 @@ type ActorHandlerI interface {
 
 type ActorCaller struct {
 	ch chan ActorRet
+
+	// token in owner pending table, 0 if not tracked
+	token uint64
+	owner *Actor
 }
 
 type ActorCall struct {
 	caller ActorCaller
 	msg    interface{}
+	ctx    context.Context
+	chain  []*Actor
 }
 
-// SendReply send reply to caller
+// SendReply send reply to caller, only the first reply is delivered
 func (caller ActorCaller) SendReply(ret interface{}, err ecode.VEI) {
 	log.Debugf(logActor, logReply, "direct send ret %v<-%v", caller.ch, ret)
-	safeSendRet(caller.ch, NewGenRet(ret, err))
+	caller.SendRet(NewGenRet(ret, err))
 }
 
-// sendRet send reply to caller
+// NewCaller caller replying on ch, for handlers run without a loop, e.g. by gentest.Driver
+func NewCaller(ch chan ActorRet) ActorCaller {
+	return ActorCaller{ch: ch}
+}
+
+// sendRet send reply to caller, only the first reply is delivered
 func (caller ActorCaller) SendRet(v ActorRet) {
+	if caller.owner != nil && !caller.owner.donePending(caller.token, v) {
+		return
+	}
 	safeSendRet(caller.ch, v)
 }
 
 type ActorCast struct {
 	msg interface{}
+	ctx context.Context
+}
+
+// actorShutdown ask the loop to stop with reason
+type actorShutdown struct {
+	reason string
+	err    ecode.VEI
+	drain  bool
 }
 
 type ActorRet struct {
@@ -114,15 +200,42 @@ func (r ActorRet) IsStopped() bool {
 	return r.isStopped
 }
 
-// GenTimer used for cancel
+// Reply value returned to the caller, CallNoRep if the handler replies later
+func (r ActorRet) Reply() interface{} {
+	return r.retVal
+}
+
+// Err error returned to the caller
+func (r ActorRet) Err() ecode.VEI {
+	return r.vErr
+}
+
+// Out timeout asked by NewTimeRet, 0 for DefaultOut
+func (r ActorRet) Out() time.Duration {
+	return r.time
+}
+
+// GenTimer used for cancel, Timer nil if run on Actor.Wheel
 type ActorTimer struct {
-	*time.Timer
+	clock.Timer
+	wt *timerpool.WheelTimer
+}
+
+// Stop cancel the timer, false if already fired or stopped
+func (t *ActorTimer) Stop() bool {
+	if t.wt != nil {
+		return t.wt.Stop()
+	}
+	return t.Timer.Stop()
 }
 
 // ActorCtx for gen_call
 type ActorCtx struct {
 	name   string
 	caller ActorCaller
+	self   *Actor
+	goCtx  context.Context
+	chain  []*Actor
 }
 
 func Ctx(name string) ActorCtx {
@@ -137,42 +250,91 @@ func (ctx ActorCtx) Caller() ActorCaller {
 	return ctx.caller
 }
 
-// Start method
+// WithCaller copy of ctx with caller, as the loop sets it for a call
+func (ctx ActorCtx) WithCaller(caller ActorCaller) ActorCtx {
+	ctx.caller = caller
+	return ctx
+}
+
+// Self the actor running the handler, nil before Start
+func (ctx ActorCtx) Self() *Actor {
+	return ctx.self
+}
+
+// Context passed by CallCtx/CastCtx for the message being handled, carry deadline and trace values
+func (ctx ActorCtx) Context() context.Context {
+	if ctx.goCtx == nil {
+		return context.Background()
+	}
+	return ctx.goCtx
+}
+
+// Start method, actor with a name is registered and can be found by WhereIs until it stopped
 func (s *Actor) Start(ctx ActorCtx, initMsg, state interface{}, handle ActorHandlerI) (interface{}, ecode.VEI) {
 	s.H = handle
 	s.Ctx = ctx
+	s.Ctx.self = s
 	s.Name = ctx.name
-	s.Mailbox = make(chan interface{}, 1000)
+	s.Mailbox = make(chan interface{}, s.mailboxLen())
+	s.highBox = make(chan interface{}, s.mailboxLen())
+	s.sysBox = make(chan interface{}, SysMailBoxLen)
 
 	s.IsStopped = atomic.NewBool(false)
+	s.done = make(chan struct{})
+	s.stats.startAt = clock.Now()
 
 	s.InterruptBox = make(chan time.Duration)
 	s.State = state
 
-	wt := NewWaiter("gen_" + s.Name)
+	// unique per actor, a name is only checked by Register below
+	key := fmt.Sprintf("gen_%v_%p", s.Name, s)
+	wt := NewWaiter(key)
 	s.Wt = wt
 
-	initRetCh := make(chan ActorRet)
-	// enter new go routine loop
-	if s.DefaultOut != 0 {
-		go s.loop(nil, time.NewTimer(s.DefaultOut), initMsg, initRetCh)
+	// registered once ready, a lookup never finds a half started actor
+	if s.Name != "" {
+		if err := Register(s.Name, s); err != nil {
+			DelWaiter(key)
+			return nil, err
+		}
+	}
+
+	initRetCh := make(chan ActorRet, 1)
+	if s.Sched != nil {
+		s.InterruptBox = make(chan time.Duration, 1)
+		s.startSched(initMsg, initRetCh)
 	} else {
-		go s.loop(nil, nil, initMsg, initRetCh)
+		// enter new go routine loop, the init ret arms the timeout
+		wt.AddAndSpawnExec(logStart, func() {
+			s.loop(nil, nil, initMsg, initRetCh)
+		})
 	}
 
 	select {
 	case v := <-initRetCh:
 		return v.retVal, v.vErr
-	case <-time.After(GenInitTimeout):
+	case <-clock.After(GenInitTimeout):
 		log.Errorf(logActor, logSend, "gen: %s init Timeout", s.Name)
 		return nil, ecode.ErrActorInitTimeout
 	}
 }
 
-// Cast method
-func (s *Actor) Cast(msg interface{}) {
+// Cast method, error only if mailbox full and Overflow not block
+func (s *Actor) Cast(msg interface{}) ecode.VEI {
 	log.Debugf("Gen", "Call", "send cast msg %v<-%v", s.Mailbox, msg)
-	safeSendChan(s.Mailbox, &ActorCast{msg})
+	return s.post(s.Mailbox, &ActorCast{msg: msg})
+}
+
+// CastPriority cast by lane of prio, higher lanes are always handled first
+func (s *Actor) CastPriority(prio Priority, msg interface{}) ecode.VEI {
+	log.Debugf("Gen", "Call", "send cast msg %v<-%v, prio %v", s.Mailbox, msg, prio)
+	return s.post(s.lane(prio), &ActorCast{msg: msg})
+}
+
+// CastCtx cast with ctx, Handle can read it by ActorCtx.Context
+func (s *Actor) CastCtx(ctx context.Context, msg interface{}) ecode.VEI {
+	log.Debugf("Gen", "Call", "send cast msg %v<-%v", s.Mailbox, msg)
+	return s.post(s.Mailbox, &ActorCast{msg: msg, ctx: ctx})
 }
 
 // Call method
@@ -182,141 +344,271 @@ func (s *Actor) Call(msg interface{}) (interface{}, ecode.VEI) {
 
 // TimeCall method
 func (s *Actor) TimeCall(msg interface{}, overDuration time.Duration) (interface{}, ecode.VEI) {
+	ctx, cancel := clock.WithTimeout(context.Background(), overDuration)
+	defer cancel()
+	return s.CallCtx(ctx, msg)
+}
+
+// CallPriority call by lane of prio, higher lanes are always handled first
+func (s *Actor) CallPriority(prio Priority, msg interface{}) (interface{}, ecode.VEI) {
+	return s.call(context.Background(), s.lane(prio), msg)
+}
+
+// CallCtx call honours ctx deadline and cancellation, genTimeOut used if ctx has no deadline.
+// ctx is passed to Handle by ActorCtx.Context, and the call is skipped if ctx done before handled
+func (s *Actor) CallCtx(ctx context.Context, msg interface{}) (interface{}, ecode.VEI) {
+	return s.call(ctx, s.Mailbox, msg)
+}
+
+func (s *Actor) call(ctx context.Context, lane chan interface{}, msg interface{}) (interface{}, ecode.VEI) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = clock.WithTimeout(ctx, genTimeOut)
+		defer cancel()
+	}
+
+	chain := currentChain()
+	if err := checkCycle(chain, s, msg); err != nil {
+		return nil, err
+	}
+
 	from := make(chan ActorRet, 1)
-	overTimer := time.NewTimer(overDuration)
-	callMsg := &ActorCall{ActorCaller{ch: from}, msg}
-	log.Debugf("Gen", "Call", "from %v send call msg %v<-%v", from, s.Mailbox, msg)
+	callMsg := &ActorCall{caller: ActorCaller{ch: from}, msg: msg, ctx: ctx, chain: chain}
+	log.Debugf("Gen", "Call", "from %v send call msg %v<-%v", from, lane, msg)
+
+	if s.Overflow == OverflowBlock || lane == s.sysBox {
+		if err := s.enqueueCall(ctx, lane, callMsg); err != nil {
+			return nil, err
+		}
+	} else if err := s.post(lane, callMsg); err != nil {
+		return nil, err
+	}
 
 	select {
-	case <-overTimer.C:
-		return nil, ecode.ErrActorCallTimeout
+	case <-ctx.Done():
+		return nil, ctxErr(ctx, ecode.ErrActorHandleTimeout)
 
-	case s.Mailbox <- callMsg:
+	case <-s.done:
 		select {
-		case <-overTimer.C:
-			return nil, ecode.ErrActorHandleTimeout
-
 		case ret := <-from:
-			log.Debugf("Gen", "Call", "got call ret:%v %v<-%v", ret, from, s.Mailbox)
-			//if ret == nil {
-			//	return nil, ecode.ErrGenMayDown
-			//}
 			return ret.ret(), ret.err()
+		default:
+			return nil, ecode.ErrActorStopped
 		}
+
+	case ret := <-from:
+		log.Debugf("Gen", "Call", "got call ret:%v %v<-%v", ret, from, s.Mailbox)
+		//if ret == nil {
+		//	return nil, ecode.ErrGenMayDown
+		//}
+		return ret.ret(), ret.err()
 	}
 }
 
-// AfterCast method  for send_after
+// enqueueCall wait for room until ctx done, or BlockTimeout if set and not the system lane
+func (s *Actor) enqueueCall(ctx context.Context, lane chan interface{}, call *ActorCall) ecode.VEI {
+	if s.IsStopped.Load() {
+		return errNotHandled
+	}
+	var full <-chan time.Time
+	if s.BlockTimeout > 0 && lane != s.sysBox {
+		t := timerpool.GetTimer(s.BlockTimeout)
+		defer timerpool.PutTimer(t)
+		full = t.C()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctxErr(ctx, ecode.ErrActorCallTimeout)
+	case <-full:
+		s.drop(call)
+		return ecode.ErrActorMailboxFull
+	case lane <- call:
+		s.wake()
+		return nil
+	}
+}
+
+// AfterCast method  for send_after, prefer StartTimer which is canceled by name and on stop
 func (s *Actor) AfterCast(tm time.Duration, msg interface{}) *ActorTimer {
-	ret := time.AfterFunc(tm, func() {
-		safeSendChan(s.Mailbox, &ActorCast{msg})
-	})
-	return &ActorTimer{ret}
+	f := func() {
+		// may run in the shared wheel goroutine
+		s.postNoWait(s.Mailbox, &ActorCast{msg: msg})
+	}
+	if s.Wheel != nil {
+		return &ActorTimer{wt: s.Wheel.AfterFunc(tm, f)}
+	}
+	return &ActorTimer{Timer: clock.AfterFunc(tm, f)}
 }
 
 // StartTicker method
 func (s *Actor) StartTicker(tm time.Duration) {
-	go safeSendTicker(s.IsStopped, s.InterruptBox, tm)
+	go func() {
+		safeSendTicker(s.IsStopped, s.InterruptBox, tm)
+		s.wake()
+	}()
 }
 
 // StopTicker method
 func (s *Actor) StopTicker() {
-	go safeSendTicker(s.IsStopped, s.InterruptBox, 0)
+	go func() {
+		safeSendTicker(s.IsStopped, s.InterruptBox, 0)
+		s.wake()
+	}()
 }
 
-func (s *Actor) loop(ticker *time.Ticker, out *time.Timer, initMsg interface{}, retChan chan ActorRet) {
+func (s *Actor) loop(ticker clock.Ticker, out clock.Timer, initMsg interface{}, retChan chan ActorRet) {
+	s.loopGoID = goid.Get()
+	loopActors.Store(s.loopGoID, s)
 	initRet := s.H.Init(s.Ctx, initMsg, s.State)
 	retChan <- initRet
 	stopped, ticker, out := s.handleRet(ticker, initRet)
 
 	loop := !stopped
 	for loop {
+		prev := out
 		loop, ticker, out = s.doLoop(ticker, out)
+		if prev != nil && prev != out {
+			prev.Stop()
+		}
 	}
+	if out != nil {
+		out.Stop()
+	}
+	s.exit()
 }
 
-func (s *Actor) doLoop(ticker *time.Ticker, out *time.Timer) (loop bool, tk *time.Ticker, ot *time.Timer) {
+func (s *Actor) doLoop(ticker clock.Ticker, out clock.Timer) (loop bool, tk clock.Ticker, ot clock.Timer) {
 	loop, tk, ot = true, nil, nil
 
 	defer func() {
 		if r := recover(); r != nil {
 			log.Errorf("Gen", "Panic", "stack: %s, err %v", utils.Stack(), r)
+			s.curChain = nil
+			if s.StopOnPanic {
+				if ticker != nil {
+					ticker.Stop()
+				}
+				s.stopReason = stopReasonPanic
+				loop = false
+				return
+			}
+			tk, ot = ticker, s.outTimer(0)
 		}
 	}()
 
-	if ticker != nil && out != nil {
-		return s.loopWithTickOut(ticker, out)
+	var stopped bool
+	if s.stats.suspended {
+		// only system requests until resumed
+		stopped, tk, ot = s.handleRet(ticker, s.handleMail(s.Ctx, <-s.sysBox))
+		return !stopped, tk, ot
 	}
 
-	if ticker != nil && out == nil {
-		return s.loopWithTick(ticker)
+	if msg, ok := s.priorMail(); ok {
+		stopped, tk, ot = s.handleRet(ticker, s.handleMail(s.Ctx, msg))
+		return !stopped, tk, ot
 	}
 
-	if ticker == nil && out != nil {
-		return s.loopWithOut(out)
-	}
+	switch {
+	case ticker != nil && out != nil:
+		stopped, tk, ot = s.loopWithTickOut(ticker, out)
 
-	return s.simpleLoop()
+	case ticker != nil && out == nil:
+		stopped, tk, ot = s.loopWithTick(ticker)
+
+	case ticker == nil && out != nil:
+		stopped, tk, ot = s.loopWithOut(out)
+
+	default:
+		stopped, tk, ot = s.simpleLoop()
+	}
+	return !stopped, tk, ot
 }
 
-func (s *Actor) loopWithTickOut(ticker *time.Ticker, out *time.Timer) (bool, *time.Ticker, *time.Timer) {
+func (s *Actor) loopWithTickOut(ticker clock.Ticker, out clock.Timer) (bool, clock.Ticker, clock.Timer) {
 	select {
 	case tm := <-s.InterruptBox:
 		return s.handleInteruput(ticker, tm)
 
-	case <-ticker.C:
+	case <-ticker.C():
 		return s.handleRet(ticker, s.H.Tick(s.Ctx, s.State))
 
+	case msg := <-s.sysBox:
+		return s.handleRet(ticker, s.handleMail(s.Ctx, msg))
+
+	case msg := <-s.highBox:
+		return s.handleRet(ticker, s.handleMail(s.Ctx, msg))
+
 	case msg := <-s.Mailbox:
 		return s.handleRet(ticker, s.handleMail(s.Ctx, msg))
 
-	case <-out.C:
+	case <-out.C():
 		return s.handleRet(ticker, s.H.Timeout(s.Ctx, s.State))
 	}
 }
 
-func (s *Actor) loopWithTick(ticker *time.Ticker) (bool, *time.Ticker, *time.Timer) {
+func (s *Actor) loopWithTick(ticker clock.Ticker) (bool, clock.Ticker, clock.Timer) {
 	select {
 	case tm := <-s.InterruptBox:
 		return s.handleInteruput(ticker, tm)
 
-	case <-ticker.C:
+	case <-ticker.C():
 		return s.handleRet(ticker, s.H.Tick(s.Ctx, s.State))
 
+	case msg := <-s.sysBox:
+		return s.handleRet(ticker, s.handleMail(s.Ctx, msg))
+
+	case msg := <-s.highBox:
+		return s.handleRet(ticker, s.handleMail(s.Ctx, msg))
+
 	case msg := <-s.Mailbox:
 		return s.handleRet(ticker, s.handleMail(s.Ctx, msg))
 	}
 }
 
-func (s *Actor) loopWithOut(out *time.Timer) (bool, *time.Ticker, *time.Timer) {
+func (s *Actor) loopWithOut(out clock.Timer) (bool, clock.Ticker, clock.Timer) {
 	select {
 	case tm := <-s.InterruptBox:
 		return s.handleInteruput(nil, tm)
 
+	case msg := <-s.sysBox:
+		return s.handleRet(nil, s.handleMail(s.Ctx, msg))
+
+	case msg := <-s.highBox:
+		return s.handleRet(nil, s.handleMail(s.Ctx, msg))
+
 	case msg := <-s.Mailbox:
 		return s.handleRet(nil, s.handleMail(s.Ctx, msg))
 
-	case <-out.C:
+	case <-out.C():
 		return s.handleRet(nil, s.H.Timeout(s.Ctx, s.State))
 	}
 }
 
-func (s *Actor) simpleLoop() (bool, *time.Ticker, *time.Timer) {
+func (s *Actor) simpleLoop() (bool, clock.Ticker, clock.Timer) {
 	select {
 	case tm := <-s.InterruptBox:
 		return s.handleInteruput(nil, tm)
 
+	case msg := <-s.sysBox:
+		return s.handleRet(nil, s.handleMail(s.Ctx, msg))
+
+	case msg := <-s.highBox:
+		return s.handleRet(nil, s.handleMail(s.Ctx, msg))
+
 	case msg := <-s.Mailbox:
 		return s.handleRet(nil, s.handleMail(s.Ctx, msg))
 	}
 }
 
-func (s *Actor) handleInteruput(ticker *time.Ticker, tm time.Duration) (bool, *time.Ticker, *time.Timer) {
+func (s *Actor) handleInteruput(ticker clock.Ticker, tm time.Duration) (bool, clock.Ticker, clock.Timer) {
 	if ticker != nil {
 		ticker.Stop()
 	}
+	s.stats.tickEvery = 0
 	if tm > 0 {
-		return false, time.NewTicker(tm), s.outTimer(0)
+		s.stats.tickEvery = tm
+		return false, clock.NewTicker(tm), s.outTimer(0)
 	} else {
 		return false, nil, s.outTimer(0)
 	}
@@ -326,21 +618,51 @@ func (s *Actor) handleMail(ctx ActorCtx, msg interface{}) ActorRet {
 	switch msg := msg.(type) {
 	case *ActorCall:
 		from, data := msg.caller, msg.msg
+		if msg.ctx != nil && msg.ctx.Err() != nil {
+			log.Warnf("Gen", "Call", "%v skip call %v, caller ctx done: %v", ctx.name, typeName(data), msg.ctx.Err())
+			return NewGenRet(nil, nil)
+		}
+		if ret, ok := s.handleSys(data); ok {
+			from.SendReply(ret, nil)
+			return NewGenRet(nil, nil)
+		}
+		from = s.addPending(msg)
 		ctx.caller = from
+		ctx.goCtx = msg.ctx
+		ctx.chain = append(msg.chain[:len(msg.chain):len(msg.chain)], s)
 		log.Debugf("Gen", "Call", "%v got call %v<-%v", ctx.name, typeName(data), s.Mailbox)
 
+		s.curChain = ctx.chain
+		s.beginMsg(data)
+		defer s.endMsg()
 		ret := s.H.Handle(ctx, data, s.State)
+		s.curChain = nil
 		if _, ok := ret.ret().(*callNoReply); !ok {
 			log.Debugf("Gen", "Call", "%v send ret %v<-%v", ctx.name, from, ret.ret())
 			from.SendRet(ret)
 		}
 		return ret
 
+	case *actorShutdown:
+		s.stopReason = msg.reason
+		if msg.drain {
+			s.drainMails()
+		}
+		return NewStopRet(nil, msg.err)
+
 	case *ActorCast:
 		data := msg.msg
+		if fired, ok := data.(*timerFired); ok {
+			if data, ok = s.firedTimer(fired); !ok {
+				return NewGenRet(nil, nil)
+			}
+		}
+		ctx.goCtx = msg.ctx
 		if msgName := typeName(data); msgName != "addLandCast" {
 			log.Debugf("Gen", "Cast", "%v got cast msg %v<-%v", ctx.name, msgName, s.Mailbox)
 		}
+		s.beginMsg(data)
+		defer s.endMsg()
 		ret := s.H.Handle(ctx, data, s.State)
 		return ret
 
@@ -350,43 +672,204 @@ func (s *Actor) handleMail(ctx ActorCtx, msg interface{}) ActorRet {
 	}
 }
 
-func (s *Actor) stop(reason string) {
-	if !s.IsStopped.CAS(false, true) {
-		log.Errorf(logActor, logActor, "stop gen %v multi times", reflect.TypeOf(s.State).String())
-		return
+// Stop ask the actor to stop with reason and wait loop exit at most timeout, stopTimeOut if 0.
+// H.Stop called once in actor goroutine, mails left in mailbox are dropped and their callers
+// got ErrActorStopped, handle them before stop by DrainOnStop. Called in own handler it does not wait,
+// return NewStopRet instead is preferred
+func (s *Actor) Stop(reason string, timeout time.Duration) ecode.VEI {
+	if s.IsStopped == nil || s.IsStopped.Load() {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = stopTimeOut
 	}
 
-	s.H.Stop(s.Ctx, reason, s.State)
-	close(s.Mailbox)
-	close(s.InterruptBox)
+	stop := &actorShutdown{reason: reason, drain: s.DrainOnStop}
+	if s.inLoop() {
+		// taken after the running handler, which must not wait on its own full system lane
+		s.postNoWait(s.sysBox, stop)
+		return nil
+	}
+	safeSendChan(s.sysBox, stop)
+	s.wake()
+
+	if !s.Wt.WaitTimeout(WaitReason("stop "+reason), timeout) {
+		log.Errorf(logActor, logActor, "%v stop timeout %v", s.Name, timeout)
+		return ecode.ErrActorStopTimeout
+	}
+	return nil
+}
+
+// Done closed when actor loop exit
+func (s *Actor) Done() <-chan struct{} {
+	return s.done
+}
+
+// drainMails handle mails already in high and normal lanes, stop early if handler return stop
+func (s *Actor) drainMails() {
+	for n := len(s.highBox) + len(s.Mailbox); n > 0; n-- {
+		var mail interface{}
+		select {
+		case mail = <-s.highBox:
+		default:
+			select {
+			case mail = <-s.Mailbox:
+			default:
+				return
+			}
+		}
+
+		if ret, ok := s.safeHandleMail(mail); ok && ret.IsStopped() {
+			return
+		}
+	}
+}
 
-	log.Infof(logActor, logActor, "svr:%v stopped", reflect.TypeOf(s.State).String())
+func (s *Actor) safeHandleMail(mail interface{}) (ret ActorRet, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Gen", "Panic", "stack: %s, err %v", utils.Stack(), r)
+		}
+	}()
+	return s.handleMail(s.Ctx, mail), true
+}
+
+// rejectMails drop mails left after loop exit, callers got ErrActorStopped marked as not handled
+func (s *Actor) rejectMails() {
+	for _, lane := range []chan interface{}{s.sysBox, s.highBox, s.Mailbox} {
+		for n := len(lane); n > 0; n-- {
+			select {
+			case mail := <-lane:
+				if call, ok := mail.(*ActorCall); ok {
+					call.caller.SendReply(nil, errNotHandled)
+				}
+			default:
+			}
+		}
+	}
 }
 
-func (s *Actor) handleRet(ticker *time.Ticker, ret ActorRet) (bool, *time.Ticker, *time.Timer) {
-	if ret.IsStopped() {
+func (s *Actor) handleRet(ticker clock.Ticker, ret ActorRet) (bool, clock.Ticker, clock.Timer) {
+	if s.retStopped(ret) {
 		if ticker != nil {
 			ticker.Stop()
 		}
-		s.H.Stop(s.Ctx, stopReasonRet, s.State)
 		return true, nil, nil
 	}
 
 	return false, ticker, s.outTimer(ret.tm())
 }
 
-func (s *Actor) outTimer(d time.Duration) *time.Timer {
-	if d != 0 {
-		return time.NewTimer(d)
+// retStopped record stop reason and error if ret is a stop ret
+func (s *Actor) retStopped(ret ActorRet) bool {
+	if !ret.IsStopped() {
+		return false
+	}
+	if s.stopReason == "" {
+		s.stopReason = stopReasonRet
 	}
+	s.stopErr = ret.err()
+	return true
+}
+
+// exit called once the loop returned, call H.Stop and notify exit hooks
+func (s *Actor) exit() {
+	s.IsStopped.Store(true)
+	s.cancelTimers()
+	// before the name is free, so a restart under it never finds the waiter in use
+	DelWaiter(s.Wt.Key)
+	unregisterActor(s.Name, s)
+	s.safeHandleStop(s.stopReason)
+	s.rejectMails()
+	s.rejectPending(ecode.ErrActorStopped)
+	close(s.done)
+	loopActors.Delete(s.loopGoID)
+
+	s.exitMu.Lock()
+	s.exited = true
+	hooks, links := s.exitHooks, s.links
+	s.exitHooks, s.links = nil, nil
+	s.exitMu.Unlock()
+
+	for _, f := range hooks {
+		f(s.stopReason, s.stopErr)
+	}
+	for other, id := range links {
+		other.removeExitHook(id)
+	}
+	log.Infof(logActor, logActor, "%v stopped, reason: %v, err: %v", s.Name, s.stopReason, s.stopErr)
+}
 
-	if s.DefaultOut != 0 {
-		return time.NewTimer(s.DefaultOut)
+func (s *Actor) safeHandleStop(reason string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf(logActor, logActor, "%v stop panic: %v, stack: %s", s.Name, r, utils.Stack())
+		}
+	}()
+	s.H.Stop(s.Ctx, reason, s.State)
+}
+
+// onExit register f called when actor loop exit, call f at once if already exited
+func (s *Actor) onExit(f func(reason string, err ecode.VEI)) uint64 {
+	s.exitMu.Lock()
+	if !s.exited {
+		s.hookSeq++
+		if s.exitHooks == nil {
+			s.exitHooks = make(map[uint64]func(reason string, err ecode.VEI))
+		}
+		id := s.hookSeq
+		s.exitHooks[id] = f
+		s.exitMu.Unlock()
+		return id
+	}
+	reason, err := s.stopReason, s.stopErr
+	s.exitMu.Unlock()
+
+	f(reason, err)
+	return 0
+}
+
+func (s *Actor) removeExitHook(id uint64) {
+	s.exitMu.Lock()
+	delete(s.exitHooks, id)
+	s.exitMu.Unlock()
+}
+
+// isAbnormalExit panic, killed by link or stop with an error
+func isAbnormalExit(reason string, err ecode.VEI) bool {
+	if err != nil {
+		return true
+	}
+	return reason != stopReasonRet && reason != stopReasonDone && reason != stopReasonShutdown &&
+		reason != stopReasonPassivate
+}
+
+func (s *Actor) outTimer(d time.Duration) clock.Timer {
+	if d = s.outDur(d); d != 0 {
+		s.stats.outAt = clock.Now().Add(d)
+		return clock.NewTimer(d)
 	}
 
+	s.stats.outAt = time.Time{}
 	return nil
 }
 
+// outDur timeout after a handled event, DefaultOut if handler not set one
+func (s *Actor) outDur(d time.Duration) time.Duration {
+	if d != 0 {
+		return d
+	}
+	return s.DefaultOut
+}
+
+// ctxErr map ctx error to ecode, timeout by deadline or canceled by caller
+func ctxErr(ctx context.Context, timeout ecode.VEI) ecode.VEI {
+	if ctx.Err() == context.Canceled {
+		return ecode.ErrActorCallCanceled
+	}
+	return timeout
+}
+
 func safeSendRet(ch chan ActorRet, data ActorRet) {
 	defer func() {
 		if r := recover(); r != nil {
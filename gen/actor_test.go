@@ -0,0 +1,137 @@
+/*
+ * @Date: 2026-10-18 16:48:12
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 16:48:12
+ * @FilePath: /vlgo/gen/actor_test.go
+ * @Description: graceful stop, drain, pending callers, stop timeout and stop in own handler
+ */
+package gen
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+func TestStop(t *testing.T) {
+	gate := make(chan struct{})
+	stops := make(chan interface{}, 4)
+	h := funcH{
+		handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+			<-gate
+			return NewGenRet(msg, nil)
+		},
+		stop: func(ctx ActorCtx, reason interface{}) { stops <- reason },
+	}
+	a := startFunc(t, &Actor{}, "at_stop", h)
+	a.Cast(0)
+	failed := make(chan ecode.VEI, 1)
+	go func() {
+		_, err := a.Call("queued")
+		failed <- err
+	}()
+	waitFor(t, "call queued", func() bool { return a.MailboxSize() == 1 })
+
+	time.AfterFunc(20*time.Millisecond, func() { close(gate) })
+	if err := a.Stop("bye", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if !a.IsStopped.Load() {
+		t.Fatal("running after Stop returned")
+	}
+	if reason := recvMsg(t, stops, "H.Stop"); reason != "bye" {
+		t.Fatalf("stop reason %v", reason)
+	}
+	if err := recvMsg(t, failed, "queued call"); !errors.Is(err, ecode.ErrActorStopped) {
+		t.Fatalf("queued call: %v", err)
+	}
+	if err := a.Cast(1); !errors.Is(err, ecode.ErrActorStopped) {
+		t.Fatalf("cast after stop: %v", err)
+	}
+	if _, ok := WhereIs("at_stop"); ok {
+		t.Fatal("registered after stop")
+	}
+
+	// stopping again does nothing
+	if err := a.Stop("again", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case reason := <-stops:
+		t.Fatalf("H.Stop called again with %v", reason)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestStopDrain(t *testing.T) {
+	gate := make(chan struct{})
+	got := make(chan interface{}, 16)
+	a := startFunc(t, &Actor{DrainOnStop: true}, "at_drain", funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		<-gate
+		got <- msg
+		return NewGenRet(msg, nil)
+	}})
+	for i := 0; i < 5; i++ {
+		a.Cast(i)
+	}
+	replies := make(chan interface{}, 1)
+	go func() {
+		reply, _ := a.Call("call")
+		replies <- reply
+	}()
+	waitFor(t, "call queued", func() bool { return a.MailboxSize() == 5 })
+
+	time.AfterFunc(20*time.Millisecond, func() { close(gate) })
+	if err := a.Stop(StopReasonNormal, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	expectHandled(t, got, 0, 1, 2, 3, 4, "call")
+	if reply := recvMsg(t, replies, "drained call"); reply != "call" {
+		t.Fatalf("drained call %v", reply)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	gate := make(chan struct{})
+	a := startFunc(t, &Actor{}, "at_slow", funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		<-gate
+		return NewGenRet(nil, nil)
+	}})
+	a.Cast(0)
+	if err := a.Stop(StopReasonShutdown, 20*time.Millisecond); err != ecode.ErrActorStopTimeout {
+		t.Fatalf("stop a busy actor: %v", err)
+	}
+	close(gate)
+	select {
+	case <-a.Done():
+	case <-time.After(time.Second):
+		t.Fatal("stop request lost after the timeout")
+	}
+}
+
+// Stop in its own handler returns at once, even with a full system lane
+func TestStopInHandler(t *testing.T) {
+	stops := make(chan interface{}, 1)
+	returned := make(chan ecode.VEI, 1)
+	a := startFunc(t, &Actor{}, "at_self", funcH{
+		handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+			if msg == "quit" {
+				for i := 0; i < SysMailBoxLen; i++ {
+					ctx.Self().CastPriority(PrioritySystem, i)
+				}
+				returned <- ctx.Self().Stop("self", time.Second)
+			}
+			return NewGenRet(nil, nil)
+		},
+		stop: func(ctx ActorCtx, reason interface{}) { stops <- reason },
+	})
+	a.Cast("quit")
+	if err := recvMsg(t, returned, "Stop returned"); err != nil {
+		t.Fatal(err)
+	}
+	if reason := recvMsg(t, stops, "H.Stop"); reason != "self" {
+		t.Fatalf("stop reason %v", reason)
+	}
+}
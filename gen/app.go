@@ -0,0 +1,254 @@
+/*
+ * @Date: 2026-10-17 21:24:10
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 21:24:10
+ * @FilePath: /vlgo/gen/app.go
+ * @Description: application runner, start and stop Sys in dependency order
+ */
+package gen
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+	"github.com/LiPengfei/vlgo/utils/clock"
+)
+
+const (
+	logApp      = "App"
+	logTimeline = "Timeline"
+)
+
+// DefaultSysStopTimeout max time PreStop and Stop of one Sys may take
+const DefaultSysStopTimeout = 10 * time.Second
+
+type appSys struct {
+	sys         Sys
+	msg         interface{}
+	deps        []string
+	stopTimeout time.Duration
+}
+
+// App run registered Sys: PreRun and Start in dependency order, PreStop and Stop in reverse
+type App struct {
+	name string
+
+	mu       sync.Mutex
+	systems  map[string]*appSys
+	names    []string // register order
+	started  []string // start order
+	shutdown chan struct{}
+	once     sync.Once
+}
+
+// NewApp create an app without systems
+func NewApp(name string) *App {
+	return &App{
+		name:     name,
+		systems:  make(map[string]*appSys),
+		shutdown: make(chan struct{}),
+	}
+}
+
+// Register add sys started after deps, msg passed to PreRun and Start
+func (app *App) Register(sys Sys, msg interface{}, deps ...string) ecode.VEI {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	name := sys.Name()
+	if _, ok := app.systems[name]; ok {
+		log.Errorf(logApp, logStart, "%v register %v already exists", app.name, name)
+		return ecode.ErrAppSysExists
+	}
+	app.systems[name] = &appSys{sys: sys, msg: msg, deps: deps, stopTimeout: DefaultSysStopTimeout}
+	app.names = append(app.names, name)
+	return nil
+}
+
+// SetStopTimeout change the stop timeout of sys name
+func (app *App) SetStopTimeout(name string, d time.Duration) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	if s, ok := app.systems[name]; ok && d > 0 {
+		s.stopTimeout = d
+	}
+}
+
+// Start start all systems in dependency order, systems already started are stopped in reverse
+// order if any PreRun return false or Start fail, or if Shutdown is called meanwhile
+func (app *App) Start() ecode.VEI {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	order, err := app.sortSystems()
+	if err != nil {
+		log.Errorf(logApp, logStart, "%v %v", app.name, err)
+		return err
+	}
+
+	begin := clock.Now()
+	log.Infof(logApp, logTimeline, "%v starting %v systems: %v", app.name, len(order), strings.Join(order, " -> "))
+	for _, name := range order {
+		select {
+		case <-app.shutdown:
+			log.Warnf(logApp, logTimeline, "%v +%v shutdown before starting %v, unwind", app.name, clock.Since(begin), name)
+			app.stopStarted()
+			return ecode.ErrAppShutdown
+		default:
+		}
+
+		s := app.systems[name]
+		if err = app.startSys(name, s, begin); err != nil {
+			log.Errorf(logApp, logTimeline, "%v +%v start %v failed: %v, unwind", app.name, clock.Since(begin), name, err)
+			app.stopStarted()
+			return err
+		}
+		app.started = append(app.started, name)
+	}
+	log.Infof(logApp, logTimeline, "%v started in %v", app.name, clock.Since(begin))
+	return nil
+}
+
+// Run Start, then wait SIGINT, SIGTERM or Shutdown and stop. Signals are caught from the beginning,
+// one while starting stops the systems already started and Run return nil
+func (app *App) Run() ecode.VEI {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case s := <-sig:
+			log.Infof(logApp, logTimeline, "%v got signal %v", app.name, s)
+			app.Shutdown()
+		case <-done:
+		}
+	}()
+
+	if err := app.Start(); err != nil {
+		if err == ecode.ErrAppShutdown {
+			return nil
+		}
+		return err
+	}
+
+	<-app.shutdown
+	log.Infof(logApp, logTimeline, "%v shutdown", app.name)
+	app.Stop()
+	return nil
+}
+
+// Shutdown make Run stop the app
+func (app *App) Shutdown() {
+	app.once.Do(func() {
+		close(app.shutdown)
+	})
+}
+
+// Stop stop started systems in reverse start order, a system over its stop timeout is left behind
+func (app *App) Stop() {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	app.stopStarted()
+}
+
+// stopStarted called with mu locked
+func (app *App) stopStarted() {
+	begin := clock.Now()
+	log.Infof(logApp, logTimeline, "%v stopping %v systems", app.name, len(app.started))
+	for i := len(app.started) - 1; i >= 0; i-- {
+		name := app.started[i]
+		app.stopSys(name, app.systems[name], begin)
+	}
+	app.started = nil
+	log.Infof(logApp, logTimeline, "%v stopped in %v", app.name, clock.Since(begin))
+}
+
+func (app *App) startSys(name string, s *appSys, begin time.Time) ecode.VEI {
+	if !s.sys.PreRun(s.msg) {
+		return ecode.Wrap(ecode.ErrAppPreRun, name)
+	}
+
+	tm := clock.Now()
+	if _, err := s.sys.Start(s.msg); err != nil {
+		return err
+	}
+	log.Infof(logApp, logTimeline, "%v +%v started %v in %v", app.name, clock.Since(begin), name, clock.Since(tm))
+	return nil
+}
+
+func (app *App) stopSys(name string, s *appSys, begin time.Time) {
+	tm := clock.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				log.Errorf(logApp, logTimeline, "%v stop %v panic: %v", app.name, name, r)
+			}
+		}()
+		s.sys.PreStop()
+		s.sys.Stop()
+	}()
+
+	timer := clock.NewTimer(s.stopTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		log.Infof(logApp, logTimeline, "%v +%v stopped %v in %v", app.name, clock.Since(begin), name, clock.Since(tm))
+	case <-timer.C():
+		log.Errorf(logApp, logTimeline, "%v +%v stop %v timeout %v, skip", app.name, clock.Since(begin), name, s.stopTimeout)
+	}
+}
+
+// sortSystems topological order, ties kept in register order
+func (app *App) sortSystems() ([]string, ecode.VEI) {
+	indegree := make(map[string]int, len(app.systems))
+	users := make(map[string][]string, len(app.systems))
+	for _, name := range app.names {
+		for _, dep := range app.systems[name].deps {
+			if _, ok := app.systems[dep]; !ok {
+				return nil, ecode.Wrap(ecode.ErrAppSysDeps, name+" depends on missing "+dep)
+			}
+			indegree[name]++
+			users[dep] = append(users[dep], name)
+		}
+	}
+
+	order := make([]string, 0, len(app.names))
+	done := make(map[string]bool, len(app.names))
+	for len(order) < len(app.names) {
+		progress := false
+		for _, name := range app.names {
+			if done[name] || indegree[name] > 0 {
+				continue
+			}
+			done[name] = true
+			order = append(order, name)
+			for _, u := range users[name] {
+				indegree[u]--
+			}
+			progress = true
+			break
+		}
+
+		if !progress {
+			var cycle []string
+			for _, name := range app.names {
+				if !done[name] {
+					cycle = append(cycle, name)
+				}
+			}
+			return nil, ecode.Wrap(ecode.ErrAppSysDeps, "cycle in "+strings.Join(cycle, ", "))
+		}
+	}
+	return order, nil
+}
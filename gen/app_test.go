@@ -0,0 +1,164 @@
+/*
+ * @Date: 2026-10-18 19:06:12
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 19:06:12
+ * @FilePath: /vlgo/gen/app_test.go
+ * @Description: systems started in dependency order, unwound on failure, shutdown and signals
+ */
+package gen
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+// appTestSys log its start and stop to l, Start fails with err, Stop sleeps slow
+type appTestSys struct {
+	name   string
+	l      *evLog
+	noRun  bool
+	err    ecode.VEI
+	slow   time.Duration
+	starts func()
+}
+
+func (s *appTestSys) Name() string { return s.name }
+
+func (s *appTestSys) PreRun(msg interface{}) bool { return !s.noRun }
+
+func (s *appTestSys) Start(msg interface{}) (interface{}, ecode.VEI) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.l.add("start %v", s.name)
+	if s.starts != nil {
+		s.starts()
+	}
+	return nil, nil
+}
+
+func (s *appTestSys) PreStop() {}
+
+func (s *appTestSys) Stop() {
+	time.Sleep(s.slow)
+	s.l.add("stop %v", s.name)
+}
+
+func TestAppOrder(t *testing.T) {
+	l := &evLog{}
+	app := NewApp("apt_order")
+	app.Register(&appTestSys{name: "web", l: l}, nil, "db", "cache")
+	app.Register(&appTestSys{name: "cache", l: l}, nil, "db")
+	app.Register(&appTestSys{name: "db", l: l}, nil)
+	app.Register(&appTestSys{name: "log", l: l}, nil)
+	if err := app.Register(&appTestSys{name: "db", l: l}, nil); err != ecode.ErrAppSysExists {
+		t.Fatalf("register twice: %v", err)
+	}
+	if err := app.Start(); err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, l, "start db", "start cache", "start web", "start log")
+	app.Stop()
+	expectLog(t, l, "stop log", "stop web", "stop cache", "stop db")
+	// nothing left to stop
+	app.Stop()
+	expectLog(t, l)
+}
+
+func TestAppDeps(t *testing.T) {
+	app := NewApp("apt_missing")
+	app.Register(&appTestSys{name: "a"}, nil, "b")
+	if err := app.Start(); !errors.Is(err, ecode.ErrAppSysDeps) {
+		t.Fatalf("missing dep: %v", err)
+	}
+
+	app = NewApp("apt_cycle")
+	app.Register(&appTestSys{name: "a"}, nil)
+	app.Register(&appTestSys{name: "x"}, nil, "y", "a")
+	app.Register(&appTestSys{name: "y"}, nil, "x")
+	if err := app.Start(); !errors.Is(err, ecode.ErrAppSysDeps) {
+		t.Fatalf("cycle: %v", err)
+	}
+}
+
+// systems started before a failing one are stopped in reverse order, later ones never start
+func TestAppUnwind(t *testing.T) {
+	l := &evLog{}
+	app := NewApp("apt_unwind")
+	app.Register(&appTestSys{name: "a", l: l}, nil)
+	app.Register(&appTestSys{name: "b", l: l}, nil, "a")
+	app.Register(&appTestSys{name: "c", l: l, err: ecode.ErrActorStopped}, nil, "b")
+	app.Register(&appTestSys{name: "d", l: l}, nil, "c")
+	if err := app.Start(); err != ecode.ErrActorStopped {
+		t.Fatalf("start: %v", err)
+	}
+	expectLog(t, l, "start a", "start b", "stop b", "stop a")
+
+	app = NewApp("apt_prerun")
+	app.Register(&appTestSys{name: "a", l: l}, nil)
+	app.Register(&appTestSys{name: "b", l: l, noRun: true}, nil)
+	if err := app.Start(); !errors.Is(err, ecode.ErrAppPreRun) {
+		t.Fatalf("prerun: %v", err)
+	}
+	expectLog(t, l, "start a", "stop a")
+}
+
+// a shutdown while starting stops the systems already started
+func TestAppShutdownWhileStarting(t *testing.T) {
+	l := &evLog{}
+	app := NewApp("apt_shutdown")
+	app.Register(&appTestSys{name: "a", l: l}, nil)
+	app.Register(&appTestSys{name: "b", l: l, starts: app.Shutdown}, nil, "a")
+	app.Register(&appTestSys{name: "c", l: l}, nil, "b")
+	if err := app.Start(); err != ecode.ErrAppShutdown {
+		t.Fatalf("start: %v", err)
+	}
+	expectLog(t, l, "start a", "start b", "stop b", "stop a")
+}
+
+// a signal while starting is caught, Run unwinds and returns nil
+func TestAppSignalWhileStarting(t *testing.T) {
+	l := &evLog{}
+	app := NewApp("apt_signal")
+	app.Register(&appTestSys{name: "a", l: l}, nil)
+	app.Register(&appTestSys{name: "b", l: l, starts: func() {
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+		select {
+		case <-app.shutdown:
+		case <-time.After(time.Second):
+			t.Error("signal not caught")
+		}
+	}}, nil, "a")
+	app.Register(&appTestSys{name: "c", l: l}, nil, "b")
+	if err := app.Run(); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	expectLog(t, l, "start a", "start b", "stop b", "stop a")
+}
+
+// Run stops on Shutdown, a system over its stop timeout is left behind
+func TestAppRun(t *testing.T) {
+	l := &evLog{}
+	app := NewApp("apt_run")
+	app.Register(&appTestSys{name: "a", l: l}, nil)
+	app.Register(&appTestSys{name: "slow", l: l, slow: time.Second}, nil, "a")
+	app.SetStopTimeout("slow", 20*time.Millisecond)
+
+	done := make(chan ecode.VEI, 1)
+	go func() { done <- app.Run() }()
+	waitFor(t, "started", func() bool {
+		app.mu.Lock()
+		defer app.mu.Unlock()
+		return len(app.started) == 2
+	})
+	app.Shutdown()
+	if err := recvMsg(t, done, "run return"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	expectLog(t, l, "start a", "start slow", "stop a")
+}
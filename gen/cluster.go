@@ -0,0 +1,339 @@
+/*
+ * @Date: 2026-10-17 20:31:47
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 20:31:47
+ * @FilePath: /vlgo/gen/cluster.go
+ * @Description: cluster membership on top of Node, run as a Sys
+ */
+package gen
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+	"github.com/LiPengfei/vlgo/proto/pb_gen"
+	"github.com/LiPengfei/vlgo/utils/clock"
+	"github.com/spf13/viper"
+)
+
+const (
+	logCluster = "Cluster"
+	logMember  = "Member"
+)
+
+// topics of *MemberEvent published on the default bus, subscribe "cluster.*" for all
+const (
+	ClusterTopicJoin  = "cluster.join"
+	ClusterTopicLeave = "cluster.leave"
+)
+
+const (
+	DefaultClusterHeartbeat = time.Second
+	clusterFailBeats        = 5
+	clusterActorPrefix      = "cluster/"
+)
+
+// ClusterConfig Seeds addresses of nodes to join, a member silent for FailAfter is down
+type ClusterConfig struct {
+	Seeds     []string
+	Heartbeat time.Duration
+	FailAfter time.Duration
+}
+
+// ClusterConfigFrom read cluster.seeds, cluster.heartbeat and cluster.fail_after
+func ClusterConfigFrom(cfg *viper.Viper) ClusterConfig {
+	return ClusterConfig{
+		Seeds:     cfg.GetStringSlice("cluster.seeds"),
+		Heartbeat: cfg.GetDuration("cluster.heartbeat"),
+		FailAfter: cfg.GetDuration("cluster.fail_after"),
+	}
+}
+
+// Member one alive node of the cluster
+type Member struct {
+	Node string
+	Addr string
+}
+
+// MemberEvent published when a member joined, left or was detected down
+type MemberEvent struct {
+	Member
+	// Down left without saying goodbye, by timeout or lost connection
+	Down bool
+}
+
+type clusterMember struct {
+	Member
+	lastSeen time.Time
+}
+
+type clusterDialed struct {
+	addr string
+	peer string
+	err  ecode.VEI
+}
+
+type clusterMembers struct{}
+
+type clusterLeave struct{}
+
+// Cluster keep the alive members by heartbeats between the membership actors of all nodes,
+// registered as "cluster/<node name>". Joins and leaves are published to local actors on
+// ClusterTopicJoin and ClusterTopicLeave
+type Cluster struct {
+	node *Node
+	cfg  ClusterConfig
+
+	mu    sync.Mutex
+	actor *Actor
+
+	members map[string]*clusterMember
+	dialing map[string]bool
+	// seeds seed address -> name of the node answering there, this node for its own address
+	seeds map[string]string
+}
+
+// NewCluster membership of node, start it by Start or as a Sys
+func NewCluster(node *Node, cfg ClusterConfig) *Cluster {
+	if cfg.Heartbeat <= 0 {
+		cfg.Heartbeat = DefaultClusterHeartbeat
+	}
+	if cfg.FailAfter <= 0 {
+		cfg.FailAfter = cfg.Heartbeat * clusterFailBeats
+	}
+	RegisterRemoteMsg(&pb_gen.ClusterHeartbeat{})
+
+	return &Cluster{
+		node:    node,
+		cfg:     cfg,
+		members: make(map[string]*clusterMember),
+		dialing: make(map[string]bool),
+		seeds:   make(map[string]string),
+	}
+}
+
+// Name method
+func (c *Cluster) Name() string {
+	return "cluster"
+}
+
+// PreRun method
+func (c *Cluster) PreRun(msg interface{}) bool {
+	if c.node == nil {
+		log.Errorf(logCluster, logStart, "cluster without node")
+		return false
+	}
+	return true
+}
+
+// Start start the membership actor and contact seeds
+func (c *Cluster) Start(msg interface{}) (interface{}, ecode.VEI) {
+	a := &Actor{}
+	c.mu.Lock()
+	c.actor = a
+	c.mu.Unlock()
+	return a.Start(Ctx(clusterActorPrefix+c.node.Name()), msg, c, clusterHandler{})
+}
+
+// PreStop tell the other members this node is leaving
+func (c *Cluster) PreStop() {
+	if a := c.getActor(); a != nil {
+		a.Call(&clusterLeave{})
+	}
+}
+
+// Stop stop the membership actor
+func (c *Cluster) Stop() {
+	if a := c.getActor(); a != nil {
+		a.Stop(StopReasonShutdown, 0)
+	}
+}
+
+// Members alive members, this node included, sorted by node name, nil before Start
+func (c *Cluster) Members() []Member {
+	a := c.getActor()
+	if a == nil {
+		return nil
+	}
+	members, _ := CallAs[[]Member](a, &clusterMembers{})
+	return members
+}
+
+func (c *Cluster) getActor() *Actor {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.actor
+}
+
+type clusterHandler struct{}
+
+func (clusterHandler) Init(ctx ActorCtx, msg, state interface{}) ActorRet {
+	c := state.(*Cluster)
+	c.node.MonitorNode("", ctx.Self())
+	c.dialSeeds()
+	ctx.Self().StartTicker(c.cfg.Heartbeat)
+	return NewGenRet(nil, nil)
+}
+
+func (clusterHandler) Handle(ctx ActorCtx, msg interface{}, state interface{}) ActorRet {
+	c := state.(*Cluster)
+
+	switch msg := msg.(type) {
+	case *pb_gen.ClusterHeartbeat:
+		c.handleHeartbeat(msg)
+
+	case *NodeDown:
+		c.down(msg.Node, true)
+
+	case *clusterDialed:
+		delete(c.dialing, msg.addr)
+		if msg.peer != "" {
+			c.seeds[msg.addr] = msg.peer
+		}
+		if msg.err != nil {
+			log.Debugf(logCluster, logMember, "%v dial %v: %v", ctx.Name(), msg.addr, msg.err)
+		} else if msg.peer != c.node.Name() {
+			// greet at once, do not wait the next tick
+			c.sendHeartbeat(msg.peer, false)
+		}
+
+	case *clusterMembers:
+		members := []Member{{Node: c.node.Name(), Addr: c.node.Addr()}}
+		for _, m := range c.members {
+			members = append(members, m.Member)
+		}
+		sort.Slice(members, func(i, j int) bool { return members[i].Node < members[j].Node })
+		return NewGenRet(members, nil)
+
+	case *clusterLeave:
+		for name := range c.members {
+			c.sendHeartbeat(name, true)
+		}
+
+	default:
+		log.Errorf(logCluster, logActor, "%v unexpected msg %v", ctx.Name(), typeName(msg))
+	}
+	return NewGenRet(nil, nil)
+}
+
+func (clusterHandler) Stop(ctx ActorCtx, msg interface{}, state interface{}) {
+	c := state.(*Cluster)
+	c.node.DemonitorNode("", ctx.Self())
+}
+
+// Tick heartbeat the members, detect silent ones and retry seeds not connected
+func (clusterHandler) Tick(ctx ActorCtx, state interface{}) ActorRet {
+	c := state.(*Cluster)
+
+	now := clock.Now()
+	for name, m := range c.members {
+		if now.Sub(m.lastSeen) > c.cfg.FailAfter {
+			log.Warnf(logCluster, logMember, "%v no heartbeat from %v in %v", ctx.Name(), name, c.cfg.FailAfter)
+			c.down(name, true)
+			c.node.Disconnect(name)
+			continue
+		}
+		c.sendHeartbeat(name, false)
+	}
+	c.dialSeeds()
+	return NewGenRet(nil, nil)
+}
+
+func (clusterHandler) Timeout(ctx ActorCtx, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func (c *Cluster) handleHeartbeat(hb *pb_gen.ClusterHeartbeat) {
+	if hb.Leaving {
+		c.down(hb.Node, false)
+		return
+	}
+
+	m, ok := c.members[hb.Node]
+	if !ok {
+		m = &clusterMember{Member: Member{Node: hb.Node, Addr: hb.Addr}}
+		c.members[hb.Node] = m
+		log.Infof(logCluster, logMember, "%v member %v %v joined", c.node.Name(), hb.Node, hb.Addr)
+		Publish(ClusterTopicJoin, &MemberEvent{Member: m.Member})
+		// answer so the new member knows us without waiting a tick
+		c.sendHeartbeat(hb.Node, false)
+	}
+	m.lastSeen = clock.Now()
+
+	// gossip, meet the members the sender knows
+	for _, other := range hb.Members {
+		if _, known := c.members[other.Node]; known || other.Node == c.node.Name() {
+			continue
+		}
+		// the smaller name dial to avoid both sides connecting at the same time
+		if c.node.Name() < other.Node {
+			c.dial(other.Addr)
+		}
+	}
+}
+
+// down remove member name and publish its leave
+func (c *Cluster) down(name string, isDown bool) {
+	m, ok := c.members[name]
+	if !ok {
+		return
+	}
+	delete(c.members, name)
+	log.Infof(logCluster, logMember, "%v member %v left, down: %v", c.node.Name(), name, isDown)
+	Publish(ClusterTopicLeave, &MemberEvent{Member: m.Member, Down: isDown})
+}
+
+func (c *Cluster) sendHeartbeat(peer string, leaving bool) {
+	hb := &pb_gen.ClusterHeartbeat{Node: c.node.Name(), Addr: c.node.Addr(), Leaving: leaving}
+	for _, m := range c.members {
+		hb.Members = append(hb.Members, &pb_gen.ClusterMember{Node: m.Node, Addr: m.Addr})
+	}
+	if err := c.node.Remote(peer, clusterActorPrefix+peer).Cast(hb); err != nil {
+		log.Debugf(logCluster, logMember, "%v heartbeat to %v: %v", c.node.Name(), peer, err)
+	}
+}
+
+// dialSeeds connect the seeds not connected yet. A seed is known by the node name it answered
+// with, the listen address may be a wildcard never equal to the configured one. Seeds dialing
+// each other at once are left to Node, which keeps one of both connections
+func (c *Cluster) dialSeeds() {
+	for _, addr := range c.cfg.Seeds {
+		if peer, ok := c.seeds[addr]; ok && (peer == c.node.Name() || c.node.peer(peer) != nil) {
+			continue
+		}
+		if addr == c.node.Addr() || c.memberAt(addr) {
+			continue
+		}
+		c.dial(addr)
+	}
+}
+
+// dial connect addr out of the actor, a dead address may block until dial timeout
+func (c *Cluster) dial(addr string) {
+	if c.dialing[addr] {
+		return
+	}
+	c.dialing[addr] = true
+
+	self := c.actor
+	node := c.node
+	go func() {
+		peer, err := node.Connect(addr)
+		if err == ecode.ErrNodeExists {
+			// connected by the other side, the heartbeat will come, or addr is this node
+			err = nil
+		}
+		self.Cast(&clusterDialed{addr: addr, peer: peer, err: err})
+	}()
+}
+
+func (c *Cluster) memberAt(addr string) bool {
+	for _, m := range c.members {
+		if m.Addr == addr {
+			return true
+		}
+	}
+	return false
+}
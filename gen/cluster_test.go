@@ -0,0 +1,155 @@
+/*
+ * @Date: 2026-10-18 14:48:36
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 14:48:36
+ * @FilePath: /vlgo/gen/cluster_test.go
+ * @Description: cluster membership of nodes on loopback, join, leave, down and seeds
+ */
+package gen
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+const (
+	clusterTestBeat = 20 * time.Millisecond
+	clusterTestFail = 200 * time.Millisecond
+)
+
+// startTestCluster membership of n joining seeds, stopped when the test ends
+func startTestCluster(t *testing.T, n *Node, seeds ...string) *Cluster {
+	t.Helper()
+	c := NewCluster(n, ClusterConfig{Seeds: seeds, Heartbeat: clusterTestBeat, FailAfter: clusterTestFail})
+	if _, err := c.Start(nil); err != nil {
+		t.Fatalf("start cluster of %v: %v", n.Name(), err)
+	}
+	t.Cleanup(c.Stop)
+	return c
+}
+
+func memberNames(c *Cluster) []string {
+	var names []string
+	for _, m := range c.Members() {
+		names = append(names, m.Node)
+	}
+	return names
+}
+
+func waitMembers(t *testing.T, c *Cluster, want ...string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got := memberNames(c)
+		if len(got) == len(want) {
+			same := true
+			for i := range want {
+				same = same && got[i] == want[i]
+			}
+			if same {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%v members %v, want %v", c.node.Name(), got, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// clusterSeeds seeds and dials in progress, read in the membership actor
+func clusterSeeds(t *testing.T, c *Cluster) (map[string]string, int) {
+	t.Helper()
+	seeds := make(map[string]string)
+	dialing := 0
+	err := c.getActor().ReplaceState(func(state interface{}) interface{} {
+		for addr, peer := range state.(*Cluster).seeds {
+			seeds[addr] = peer
+		}
+		dialing = len(state.(*Cluster).dialing)
+		return state
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return seeds, dialing
+}
+
+func TestCluster(t *testing.T) {
+	if (&Cluster{}).Members() != nil {
+		t.Fatal("members before start")
+	}
+
+	// the seed listens on a wildcard address, configured by its loopback one
+	nodes := startTestNodes(t, "ctl_a", "ctl_b", "ctl_c")
+	a, b, c := nodes[0], nodes[1], nodes[2]
+	seedNode, err := StartNode("ctl_seed", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(seedNode.Stop)
+	_, port, _ := net.SplitHostPort(seedNode.Addr())
+	seed := net.JoinHostPort("127.0.0.1", port)
+
+	downs := make(chan *MemberEvent, 16)
+	w := startFunc(t, &Actor{}, "ctl_watch", funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		if tm, ok := msg.(*TopicMsg); ok && tm.Topic == ClusterTopicLeave {
+			downs <- tm.Msg.(*MemberEvent)
+		}
+		return NewGenRet(nil, nil)
+	}})
+	Subscribe(w, ClusterTopicLeave)
+
+	cs := startTestCluster(t, seedNode, seed)
+	ca := startTestCluster(t, a, seed)
+	cb := startTestCluster(t, b, seed)
+	cc := startTestCluster(t, c, seed)
+
+	all := []string{"ctl_a", "ctl_b", "ctl_c", "ctl_seed"}
+	for _, cl := range []*Cluster{cs, ca, cb, cc} {
+		waitMembers(t, cl, all...)
+	}
+
+	// seeds are known by name once connected and never dialed again
+	time.Sleep(5 * clusterTestBeat)
+	if seeds, _ := clusterSeeds(t, cs); seeds[seed] != "ctl_seed" {
+		t.Fatalf("seed node seeds %v", seeds)
+	}
+	if seeds, _ := clusterSeeds(t, ca); seeds[seed] != "ctl_seed" {
+		t.Fatalf("ctl_a seeds %v", seeds)
+	}
+	for i := 0; i < 10; i++ {
+		for _, cl := range []*Cluster{cs, ca, cb, cc} {
+			if _, dialing := clusterSeeds(t, cl); dialing != 0 {
+				t.Fatalf("%v redials a connected seed", cl.node.Name())
+			}
+		}
+		time.Sleep(clusterTestBeat / 2)
+	}
+
+	// leave says goodbye
+	cb.PreStop()
+	cb.Stop()
+	waitMembers(t, ca, "ctl_a", "ctl_c", "ctl_seed")
+	if ev := recvMsg(t, downs, "leave of ctl_b"); ev.Node != "ctl_b" || ev.Down {
+		t.Fatalf("leave %+v", ev)
+	}
+
+	// a member silent for FailAfter is down, its connection still open
+	if err := cc.getActor().Suspend(); err != nil {
+		t.Fatal(err)
+	}
+	defer cc.getActor().Resume()
+	waitMembers(t, ca, "ctl_a", "ctl_seed")
+	for {
+		ev := recvMsg(t, downs, "down of ctl_c")
+		if ev.Node == "ctl_b" {
+			continue
+		}
+		if ev.Node != "ctl_c" || !ev.Down {
+			t.Fatalf("down %+v", ev)
+		}
+		break
+	}
+}
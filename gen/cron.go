@@ -0,0 +1,451 @@
+/*
+ * @Date: 2026-10-18 00:12:37
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 00:12:37
+ * @FilePath: /vlgo/gen/cron.go
+ * @Description: cron service, run as a Sys, cast to named actors when jobs fire
+ */
+package gen
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+	"github.com/LiPengfei/vlgo/timerpool"
+	"github.com/LiPengfei/vlgo/utils/clock"
+)
+
+const (
+	logCron = "Cron"
+	logJob  = "Job"
+
+	cronActorPrefix = "cron/"
+	// cronCatchUpTimer retry every cronCatchUpRetry the catch up fires whose target is not registered yet
+	cronCatchUpTimer = "catch_up"
+	cronCatchUpRetry = time.Second
+)
+
+// CronJob cast *CronFired with Msg to the actor registered as Target each time Schedule fires
+type CronJob struct {
+	Name     string
+	Schedule Schedule
+	Target   string
+	Msg      interface{}
+	// CatchUp fire once at start when the persisted next time passed while not running,
+	// e.g. a daily reset missed by a restart over midnight. The fire waits for Target to be registered
+	CatchUp bool
+}
+
+// CronFired cast to the job target, At the planned fire time, earlier than now when caught up
+type CronFired struct {
+	Job string
+	At  time.Time
+	Msg interface{}
+}
+
+// CronJobInfo answered by Jobs
+type CronJobInfo struct {
+	Name   string
+	Target string
+	Next   time.Time
+}
+
+// CronStore persist the next fire time of jobs, loaded once at start and saved after each change
+type CronStore interface {
+	Load() (map[string]time.Time, error)
+	Save(next map[string]time.Time) error
+}
+
+type fileCronStore struct {
+	path string
+}
+
+// NewFileCronStore store next fire times as json in path
+func NewFileCronStore(path string) CronStore {
+	return fileCronStore{path: path}
+}
+
+func (s fileCronStore) Load() (map[string]time.Time, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	next := make(map[string]time.Time)
+	return next, json.Unmarshal(data, &next)
+}
+
+// Save write a temp file and rename it, a crash never leaves a half written file
+func (s fileCronStore) Save(next map[string]time.Time) error {
+	data, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+type cronEntry struct {
+	CronJob
+	next  time.Time
+	seq   uint64
+	timer *timerpool.WheelTimer
+	// missed fire time waiting for the target, zero if none
+	missed time.Time
+}
+
+type cronDue struct {
+	name string
+	seq  uint64
+}
+
+type cronAdd struct {
+	job CronJob
+}
+
+type cronRemove struct {
+	name string
+}
+
+type cronJobs struct{}
+
+type cronCatchUp struct{}
+
+// Cron fire jobs on the timing wheel of the cron actor, registered as "cron/<name>". Fires are
+// delivered as casts, a target not registered at that time misses the fire
+type Cron struct {
+	name  string
+	store CronStore
+	// Wheel used for job timers, timerpool.DefaultWheel() if nil, set before Start
+	Wheel *timerpool.Wheel
+
+	mu      sync.Mutex
+	actor   *Actor
+	initial []CronJob
+
+	entries map[string]*cronEntry
+	saved   map[string]time.Time
+	seq     uint64
+}
+
+// NewCron cron service, store nil if next fire times are not persisted
+func NewCron(name string, store CronStore) *Cron {
+	return &Cron{name: name, store: store, entries: make(map[string]*cronEntry)}
+}
+
+// Name method
+func (c *Cron) Name() string {
+	return c.name
+}
+
+// PreRun method
+func (c *Cron) PreRun(msg interface{}) bool {
+	return true
+}
+
+// Start start the cron actor, load the persisted fire times and arm the jobs added so far
+func (c *Cron) Start(msg interface{}) (interface{}, ecode.VEI) {
+	if c.Wheel == nil {
+		c.Wheel = timerpool.DefaultWheel()
+	}
+
+	a := &Actor{}
+	ret, err := a.Start(Ctx(cronActorPrefix+c.name), msg, c, cronHandler{})
+	if err != nil {
+		return ret, err
+	}
+	c.mu.Lock()
+	c.actor = a
+	// added after Init took the initial jobs
+	late := c.initial
+	c.initial = nil
+	c.mu.Unlock()
+	for _, job := range late {
+		if _, err := a.Call(&cronAdd{job}); err != nil {
+			log.Errorf(logCron, logJob, "%v add %v: %v", c.name, job.Name, err)
+		}
+	}
+	return ret, nil
+}
+
+// PreStop method
+func (c *Cron) PreStop() {}
+
+// Stop stop the cron actor and its timers
+func (c *Cron) Stop() {
+	c.mu.Lock()
+	a := c.actor
+	c.mu.Unlock()
+	if a != nil {
+		a.Stop(StopReasonShutdown, 0)
+	}
+}
+
+// Add add a job, before or after Start
+func (c *Cron) Add(job CronJob) ecode.VEI {
+	if job.Name == "" || job.Schedule == nil {
+		return ecode.Wrap(ecode.ErrCronSpec, "job without name or schedule")
+	}
+
+	c.mu.Lock()
+	if a := c.actor; a != nil {
+		c.mu.Unlock()
+		_, err := a.Call(&cronAdd{job})
+		return err
+	}
+	defer c.mu.Unlock()
+	for _, j := range c.initial {
+		if j.Name == job.Name {
+			return ecode.ErrCronJobExists
+		}
+	}
+	c.initial = append(c.initial, job)
+	return nil
+}
+
+// AddSpec add a job scheduled by the cron expression spec, see ParseCron
+func (c *Cron) AddSpec(name, spec, target string, msg interface{}, catchUp bool) ecode.VEI {
+	sched, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+	return c.Add(CronJob{Name: name, Schedule: sched, Target: target, Msg: msg, CatchUp: catchUp})
+}
+
+// Remove remove the job name, only after Start
+func (c *Cron) Remove(name string) ecode.VEI {
+	c.mu.Lock()
+	a := c.actor
+	c.mu.Unlock()
+	if a == nil {
+		return ecode.ErrActorNotFound
+	}
+	_, err := a.Call(&cronRemove{name})
+	return err
+}
+
+// Jobs jobs and their next fire time sorted by name, only after Start
+func (c *Cron) Jobs() []CronJobInfo {
+	c.mu.Lock()
+	a := c.actor
+	c.mu.Unlock()
+	if a == nil {
+		return nil
+	}
+	jobs, _ := CallAs[[]CronJobInfo](a, &cronJobs{})
+	return jobs
+}
+
+type cronHandler struct{}
+
+func (cronHandler) Init(ctx ActorCtx, msg, state interface{}) ActorRet {
+	c := state.(*Cron)
+
+	c.saved = make(map[string]time.Time)
+	if c.store != nil {
+		saved, err := c.store.Load()
+		if err != nil {
+			log.Errorf(logCron, logStart, "%v load fire times: %v", ctx.Name(), err)
+		}
+		for name, at := range saved {
+			c.saved[name] = at
+		}
+	}
+
+	c.mu.Lock()
+	initial := c.initial
+	c.initial = nil
+	c.mu.Unlock()
+	for _, job := range initial {
+		c.add(ctx.Self(), job)
+	}
+	c.save()
+	return NewGenRet(nil, nil)
+}
+
+func (cronHandler) Handle(ctx ActorCtx, msg interface{}, state interface{}) ActorRet {
+	c := state.(*Cron)
+
+	switch msg := msg.(type) {
+	case *cronDue:
+		e, ok := c.entries[msg.name]
+		if !ok || e.seq != msg.seq {
+			return NewGenRet(nil, nil)
+		}
+		c.catchUp(e)
+		c.fire(e, e.next)
+		// the wheel may be late, never fire the same time twice
+		from := e.next
+		if now := clock.Now(); now.After(from) {
+			from = now
+		}
+		c.arm(ctx.Self(), e, e.Schedule.Next(from))
+		c.save()
+
+	case *cronAdd:
+		if _, ok := c.entries[msg.job.Name]; ok {
+			return NewGenRet(nil, ecode.ErrCronJobExists)
+		}
+		c.add(ctx.Self(), msg.job)
+		c.save()
+
+	case *cronRemove:
+		e, ok := c.entries[msg.name]
+		if !ok {
+			return NewGenRet(nil, ecode.ErrCronJobNotFound)
+		}
+		e.stop()
+		delete(c.entries, msg.name)
+		delete(c.saved, msg.name)
+		c.save()
+
+	case *cronCatchUp:
+		pending := false
+		for _, e := range c.entries {
+			c.catchUp(e)
+			pending = pending || !e.missed.IsZero()
+		}
+		if pending {
+			ctx.Self().StartTimer(cronCatchUpTimer, cronCatchUpRetry, &cronCatchUp{})
+		}
+		c.save()
+
+	case *cronJobs:
+		jobs := make([]CronJobInfo, 0, len(c.entries))
+		for _, e := range c.entries {
+			jobs = append(jobs, CronJobInfo{Name: e.Name, Target: e.Target, Next: e.next})
+		}
+		sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+		return NewGenRet(jobs, nil)
+
+	default:
+		log.Errorf(logCron, logActor, "%v unexpected msg %v", ctx.Name(), typeName(msg))
+	}
+	return NewGenRet(nil, nil)
+}
+
+func (cronHandler) Stop(ctx ActorCtx, msg interface{}, state interface{}) {
+	c := state.(*Cron)
+	for _, e := range c.entries {
+		e.stop()
+	}
+	c.save()
+
+	c.mu.Lock()
+	c.actor = nil
+	c.mu.Unlock()
+}
+
+func (cronHandler) Tick(ctx ActorCtx, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func (cronHandler) Timeout(ctx ActorCtx, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+// add arm a new job, fire it once first if it missed a persisted time and CatchUp is set. Jobs are
+// added at start, often before their target, so the missed fire is retried until it is delivered
+func (c *Cron) add(self *Actor, job CronJob) {
+	now := clock.Now()
+	e := &cronEntry{CronJob: job}
+	c.entries[job.Name] = e
+
+	at, ok := c.saved[job.Name]
+	if ok && !at.After(now) && job.CatchUp {
+		log.Infof(logCron, logJob, "%v catch up %v missed at %v", self.Name, job.Name, at)
+		e.missed = at
+	}
+	c.arm(self, e, job.Schedule.Next(now))
+	if c.catchUp(e); !e.missed.IsZero() {
+		self.StartTimer(cronCatchUpTimer, cronCatchUpRetry, &cronCatchUp{})
+	}
+}
+
+// catchUp deliver the missed fire of e if its target is registered now
+func (c *Cron) catchUp(e *cronEntry) {
+	if e.missed.IsZero() {
+		return
+	}
+	target, ok := WhereIs(e.Target)
+	if !ok || target.IsStopped.Load() {
+		return
+	}
+	// a full target mailbox must not hold the cron, a drop or reject by its policy is only logged
+	name, job := c.name, e.Name
+	target.postNoWaitOr(target.Mailbox, &ActorCast{msg: &CronFired{Job: e.Name, At: e.missed, Msg: e.Msg}}, func(err ecode.VEI) {
+		log.Errorf(logCron, logJob, "%v job %v catch up lost by %v: %v", name, job, target.Name, err)
+	})
+	e.missed = time.Time{}
+	if e.next.IsZero() {
+		c.done(e)
+		return
+	}
+	c.saved[e.Name] = e.next
+}
+
+// done remove a job never firing again
+func (c *Cron) done(e *cronEntry) {
+	log.Infof(logCron, logJob, "%v job %v done", c.name, e.Name)
+	delete(c.entries, e.Name)
+	delete(c.saved, e.Name)
+}
+
+func (e *cronEntry) stop() {
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+}
+
+// arm wait next, remove the job if it never fires again and has no missed fire waiting
+func (c *Cron) arm(self *Actor, e *cronEntry, next time.Time) {
+	if next.IsZero() {
+		e.next, e.timer = time.Time{}, nil
+		if e.missed.IsZero() {
+			c.done(e)
+		}
+		return
+	}
+
+	c.seq++
+	e.next, e.seq = next, c.seq
+	due := &cronDue{name: e.Name, seq: e.seq}
+	e.timer = c.Wheel.AfterFunc(clock.Until(next), func() {
+		// never block the shared wheel goroutine on the cron mailbox
+		self.postNoWait(self.Mailbox, &ActorCast{msg: due})
+	})
+	// a missed fire not delivered yet is kept, so it is caught up after a restart too
+	if e.missed.IsZero() {
+		c.saved[e.Name] = next
+	}
+}
+
+func (c *Cron) fire(e *cronEntry, at time.Time) {
+	target, ok := WhereIs(e.Target)
+	if !ok {
+		log.Warnf(logCron, logJob, "%v job %v target %v not found, skip fire at %v", c.name, e.Name, e.Target, at)
+		return
+	}
+	name, job := c.name, e.Name
+	target.postNoWaitOr(target.Mailbox, &ActorCast{msg: &CronFired{Job: e.Name, At: at, Msg: e.Msg}}, func(err ecode.VEI) {
+		log.Errorf(logCron, logJob, "%v job %v fire at %v lost by %v: %v", name, job, at, target.Name, err)
+	})
+}
+
+func (c *Cron) save() {
+	if c.store == nil {
+		return
+	}
+	if err := c.store.Save(c.saved); err != nil {
+		log.Errorf(logCron, logJob, "%v save fire times: %v", c.name, err)
+	}
+}
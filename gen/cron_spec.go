@@ -0,0 +1,372 @@
+/*
+ * @Date: 2026-10-18 00:12:37
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 00:12:37
+ * @FilePath: /vlgo/gen/cron_spec.go
+ * @Description: cron expressions and calendar rules for Cron
+ */
+package gen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+// Schedule next fire time strictly after after, zero time if it never fires again
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+// cronSchedule bit i of a field set if value i matches
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	// domAny or dowAny, the other field alone decides the day, otherwise any of both matches
+	domAny, dowAny bool
+	loc            *time.Location
+}
+
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronSeconds = cronField{0, 59, nil}
+	cronMinutes = cronField{0, 59, nil}
+	cronHours   = cronField{0, 23, nil}
+	cronDoms    = cronField{1, 31, nil}
+	cronMonths  = cronField{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is also sunday
+	cronDows = cronField{0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// ParseCron parse "min hour dom month dow", or with seconds first "sec min hour dom month dow".
+// Fields accept *, ?, lists, ranges, steps and month or weekday names, e.g. "30 4 * * mon-fri".
+// @yearly, @monthly, @weekly, @daily and @hourly are accepted too. The time zone is local unless
+// the expression starts with "CRON_TZ=<zone> " or "TZ=<zone> ", e.g. "CRON_TZ=Asia/Shanghai 0 5 * * *"
+// A wall time skipped when daylight saving starts does not fire, one repeated when it ends fires
+// once unless every hour matches
+func ParseCron(spec string) (Schedule, ecode.VEI) {
+	loc := time.Local
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.IndexByte(spec, ' ')
+		if i < 0 {
+			return nil, cronSpecErr(spec, "missing fields after time zone")
+		}
+		zone := spec[strings.IndexByte(spec, '=')+1 : i]
+		l, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, cronSpecErr(spec, err.Error())
+		}
+		loc, spec = l, strings.TrimSpace(spec[i+1:])
+	}
+
+	if d, ok := cronDescriptors[spec]; ok {
+		spec = d
+	}
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, cronSpecErr(spec, fmt.Sprintf("want 5 or 6 fields, got %v", len(fields)))
+	}
+
+	s := &cronSchedule{loc: loc}
+	var err error
+	parsers := []struct {
+		bits  *uint64
+		field cronField
+	}{
+		{&s.second, cronSeconds}, {&s.minute, cronMinutes}, {&s.hour, cronHours},
+		{&s.dom, cronDoms}, {&s.month, cronMonths}, {&s.dow, cronDows},
+	}
+	for i, p := range parsers {
+		if *p.bits, err = parseCronField(fields[i], p.field); err != nil {
+			return nil, cronSpecErr(spec, err.Error())
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = fields[3] == "*" || fields[3] == "?"
+	s.dowAny = fields[5] == "*" || fields[5] == "?"
+	return s, nil
+}
+
+func cronSpecErr(spec, reason string) ecode.VEI {
+	return ecode.Wrap(ecode.ErrCronSpec, spec+": "+reason)
+}
+
+func parseCronField(expr string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		lo, hi, step := f.min, f.max, 1
+
+		rng := part
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			rng, step = part[:i], n
+		}
+
+		switch {
+		case rng == "*" || rng == "?":
+		case strings.Contains(rng, "-"):
+			i := strings.IndexByte(rng, '-')
+			var err error
+			if lo, err = f.value(rng[:i]); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(rng[i+1:]); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := f.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			// "a/n" means from a to max
+			if step == 1 {
+				hi = v
+			}
+		}
+
+		if lo > hi {
+			return 0, fmt.Errorf("bad range in %q", part)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%q not in %v-%v", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// cronSearchYears give up after, e.g. "0 0 30 2 *" never matches
+const cronSearchYears = 5
+
+// Next walk from the biggest field to the smallest, resetting smaller fields when one moves
+func (s *cronSchedule) Next(after time.Time) time.Time {
+	origin := after.Location()
+	t := after.In(s.loc).Add(time.Second - time.Duration(after.Nanosecond()))
+	added := false
+	limit := t.Year() + cronSearchYears
+
+wrap:
+	if t.Year() > limit {
+		return time.Time{}
+	}
+
+	for s.month&(1<<uint(t.Month())) == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, s.loc)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !s.dayMatch(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.loc)
+		}
+		t = t.AddDate(0, 0, 1)
+		// midnight may not exist or be doubled at a daylight saving change
+		if h := t.Hour(); h != 0 {
+			if h > 12 {
+				t = t.Add(time.Duration(24-h) * time.Hour)
+			} else {
+				t = t.Add(time.Duration(-h) * time.Hour)
+			}
+		}
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for s.hour&(1<<uint(t.Hour())) == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, s.loc)
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+
+	for s.minute&(1<<uint(t.Minute())) == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	for s.second&(1<<uint(t.Second())) == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Second)
+		}
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto wrap
+		}
+	}
+
+	// a wall time repeated when daylight saving ends fires once, unless every hour matches
+	if s.hour != cronAllHours && repeatedWall(t) {
+		return s.Next(t)
+	}
+	return t.In(origin)
+}
+
+const cronAllHours = 1<<24 - 1
+
+// repeatedWall t is the second time its wall clock is shown, after clocks were set back
+func repeatedWall(t time.Time) bool {
+	_, now := t.Zone()
+	_, before := t.Add(-12 * time.Hour).Zone()
+	if before <= now {
+		return false
+	}
+	first := t.Add(-time.Duration(before-now) * time.Second)
+	_, off := first.Zone()
+	return off == before && first.Hour() == t.Hour() && first.Minute() == t.Minute()
+}
+
+func (s *cronSchedule) dayMatch(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Daily fire at hour:minute every day in loc, local if nil. Panic with ErrCronSpec if out of range
+func Daily(hour, minute int, loc *time.Location) Schedule {
+	rule := fmt.Sprintf("Daily(%v, %v)", hour, minute)
+	mustCalendar(rule, "hour", hour, cronHours)
+	mustCalendar(rule, "minute", minute, cronMinutes)
+	return calendar(hour, minute, 0, -1, loc)
+}
+
+// Weekly fire at hour:minute every weekday in loc, local if nil. Panic with ErrCronSpec if out of range
+func Weekly(weekday time.Weekday, hour, minute int, loc *time.Location) Schedule {
+	rule := fmt.Sprintf("Weekly(%v, %v, %v)", int(weekday), hour, minute)
+	mustCalendar(rule, "weekday", int(weekday), cronField{0, 6, nil})
+	mustCalendar(rule, "hour", hour, cronHours)
+	mustCalendar(rule, "minute", minute, cronMinutes)
+	return calendar(hour, minute, 0, int(weekday), loc)
+}
+
+// Monthly fire at hour:minute on day of every month in loc, local if nil, months without day skipped.
+// Panic with ErrCronSpec if out of range
+func Monthly(day, hour, minute int, loc *time.Location) Schedule {
+	rule := fmt.Sprintf("Monthly(%v, %v, %v)", day, hour, minute)
+	mustCalendar(rule, "day", day, cronDoms)
+	mustCalendar(rule, "hour", hour, cronHours)
+	mustCalendar(rule, "minute", minute, cronMinutes)
+	return calendar(hour, minute, day, -1, loc)
+}
+
+// mustCalendar calendar rules are written in code, a value out of range is a bug and panics
+func mustCalendar(rule, name string, v int, f cronField) {
+	if v < f.min || v > f.max {
+		panic(cronSpecErr(rule, fmt.Sprintf("%v %v out of %v-%v", name, v, f.min, f.max)))
+	}
+}
+
+func calendar(hour, minute, day, weekday int, loc *time.Location) Schedule {
+	if loc == nil {
+		loc = time.Local
+	}
+	s := &cronSchedule{
+		second: 1,
+		minute: 1 << uint(minute),
+		hour:   1 << uint(hour),
+		dom:    ^uint64(0),
+		month:  ^uint64(0),
+		dow:    ^uint64(0),
+		domAny: true,
+		dowAny: true,
+		loc:    loc,
+	}
+	if day > 0 {
+		s.dom, s.domAny = 1<<uint(day), false
+	}
+	if weekday >= 0 {
+		s.dow, s.dowAny = 1<<uint(weekday), false
+	}
+	return s
+}
+
+type everySchedule time.Duration
+
+// Every fire every d, counted from the previous fire, at least one second
+func Every(d time.Duration) Schedule {
+	if d < time.Second {
+		d = time.Second
+	}
+	return everySchedule(d)
+}
+
+func (e everySchedule) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(e))
+}
+
+type onceSchedule time.Time
+
+// Once fire only at t
+func Once(t time.Time) Schedule {
+	return onceSchedule(t)
+}
+
+func (o onceSchedule) Next(after time.Time) time.Time {
+	if t := time.Time(o); t.After(after) {
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,227 @@
+/*
+ * @Date: 2026-10-18 12:20:06
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 12:20:06
+ * @FilePath: /vlgo/gen/cron_spec_test.go
+ * @Description: cron expressions, next fire times, day rules and daylight saving
+ */
+package gen
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+// a saturday
+var cronTestBase = time.Date(2026, 10, 17, 12, 30, 15, 0, time.UTC)
+
+func utcAt(month time.Month, day, hour, minute, sec int) time.Time {
+	return time.Date(2026, month, day, hour, minute, sec, 0, time.UTC)
+}
+
+// nextN the n fire times of s after from
+func nextN(s Schedule, from time.Time, n int) []time.Time {
+	var ts []time.Time
+	for i := 0; i < n; i++ {
+		from = s.Next(from)
+		ts = append(ts, from)
+	}
+	return ts
+}
+
+func checkTimes(t *testing.T, got, want []time.Time) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Fatalf("fire %v at %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	sh, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"TZ=UTC * * * * *", utcAt(10, 17, 12, 31, 0)},
+		{"TZ=UTC */15 * * * * *", utcAt(10, 17, 12, 30, 30)},
+		{"TZ=UTC 0 5 * * *", utcAt(10, 18, 5, 0, 0)},
+		{"CRON_TZ=Asia/Shanghai 0 5 * * *", time.Date(2026, 10, 18, 5, 0, 0, 0, sh)},
+		{"TZ=UTC 45,15 12 * * *", utcAt(10, 17, 12, 45, 0)},
+		{"TZ=UTC 0 10-14/2 * * *", utcAt(10, 17, 14, 0, 0)},
+		{"TZ=UTC 30 4 * * mon-fri", utcAt(10, 19, 4, 30, 0)},
+		{"TZ=UTC 0 12 * * 7", utcAt(10, 18, 12, 0, 0)},
+		{"TZ=UTC 0 0 1 jan *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"TZ=UTC 0 0 29 feb *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"TZ=UTC @hourly", utcAt(10, 17, 13, 0, 0)},
+		{"TZ=UTC @daily", utcAt(10, 18, 0, 0, 0)},
+		{"TZ=UTC @weekly", utcAt(10, 18, 0, 0, 0)},
+		{"TZ=UTC @monthly", utcAt(11, 1, 0, 0, 0)},
+		{"TZ=UTC @yearly", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"TZ=UTC 0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := ParseCron(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Next(cronTestBase); !got.Equal(tt.want) {
+				t.Fatalf("next %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCronError(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * *",
+		"* * * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"* * * smarch *",
+		"TZ=Nowhere/City * * * * *",
+		"TZ=UTC",
+		"@often",
+	} {
+		t.Run(spec, func(t *testing.T) {
+			if _, err := ParseCron(spec); !errors.Is(err, ecode.ErrCronSpec) {
+				t.Fatalf("err %v, want %v", err, ecode.ErrCronSpec)
+			}
+		})
+	}
+}
+
+// day of month and weekday both restricted match either, as in cron; * or ? in one leaves the other
+func TestCronDayRule(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []time.Time
+	}{
+		{"TZ=UTC 0 0 1 * mon", []time.Time{utcAt(10, 19, 0, 0, 0), utcAt(10, 26, 0, 0, 0), utcAt(11, 1, 0, 0, 0), utcAt(11, 2, 0, 0, 0)}},
+		{"TZ=UTC 0 0 * * mon", []time.Time{utcAt(10, 19, 0, 0, 0), utcAt(10, 26, 0, 0, 0), utcAt(11, 2, 0, 0, 0), utcAt(11, 9, 0, 0, 0)}},
+		{"TZ=UTC 0 0 ? * mon", []time.Time{utcAt(10, 19, 0, 0, 0), utcAt(10, 26, 0, 0, 0), utcAt(11, 2, 0, 0, 0), utcAt(11, 9, 0, 0, 0)}},
+		{"TZ=UTC 0 0 1 * *", []time.Time{utcAt(11, 1, 0, 0, 0), utcAt(12, 1, 0, 0, 0), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, 2, 1, 0, 0, 0, 0, time.UTC)}},
+		{"TZ=UTC 0 0 1 * ?", []time.Time{utcAt(11, 1, 0, 0, 0), utcAt(12, 1, 0, 0, 0), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, 2, 1, 0, 0, 0, 0, time.UTC)}},
+		{"TZ=UTC 0 9 13 * fri", []time.Time{utcAt(10, 23, 9, 0, 0), utcAt(10, 30, 9, 0, 0), utcAt(11, 6, 9, 0, 0), utcAt(11, 13, 9, 0, 0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := ParseCron(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkTimes(t, nextN(s, cronTestBase, len(tt.want)), tt.want)
+		})
+	}
+}
+
+// a wall time skipped when clocks go forward does not fire that day, one repeated when they go
+// back fires once unless the hour is a wildcard
+func TestCronDaylightSaving(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, ny)
+	}
+	// clocks set back at 02:00 EDT to 01:00 EST
+	edt1 := time.Date(2026, 11, 1, 5, 0, 0, 0, time.UTC)
+	est1 := time.Date(2026, 11, 1, 6, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want []time.Time
+	}{
+		{"skipped time", "30 2 * * *", at(3, 7, 3, 0), []time.Time{at(3, 9, 2, 30), at(3, 10, 2, 30)}},
+		{"daily over spring forward", "0 0 * * *", at(3, 7, 12, 0), []time.Time{at(3, 8, 0, 0), at(3, 9, 0, 0)}},
+		{"hourly over spring forward", "0 * * * *", at(3, 8, 1, 30), []time.Time{at(3, 8, 3, 0), at(3, 8, 4, 0)}},
+		{"repeated time fires once", "30 1 * * *", at(11, 1, 0, 0), []time.Time{edt1.Add(30 * time.Minute), at(11, 2, 1, 30)}},
+		{"repeated hour fires once", "*/30 1 * * *", at(11, 1, 0, 0), []time.Time{edt1, edt1.Add(30 * time.Minute), at(11, 2, 1, 0)}},
+		{"hourly over fall back", "0 * * * *", at(11, 1, 0, 30), []time.Time{edt1, est1, est1.Add(time.Hour), est1.Add(2 * time.Hour)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseCron("CRON_TZ=America/New_York " + tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkTimes(t, nextN(s, tt.from, len(tt.want)), tt.want)
+		})
+	}
+}
+
+func TestCronSchedules(t *testing.T) {
+	tests := []struct {
+		name string
+		s    Schedule
+		want []time.Time
+	}{
+		{"daily", Daily(5, 0, time.UTC), []time.Time{utcAt(10, 18, 5, 0, 0), utcAt(10, 19, 5, 0, 0)}},
+		{"daily later today", Daily(20, 15, time.UTC), []time.Time{utcAt(10, 17, 20, 15, 0), utcAt(10, 18, 20, 15, 0)}},
+		{"weekly", Weekly(time.Wednesday, 20, 0, time.UTC), []time.Time{utcAt(10, 21, 20, 0, 0), utcAt(10, 28, 20, 0, 0)}},
+		{"monthly skip short months", Monthly(31, 0, 0, time.UTC), []time.Time{utcAt(10, 31, 0, 0, 0), utcAt(12, 31, 0, 0, 0)}},
+		{"every", Every(time.Minute), []time.Time{utcAt(10, 17, 12, 31, 15), utcAt(10, 17, 12, 32, 15)}},
+		{"every at least a second", Every(time.Millisecond), []time.Time{utcAt(10, 17, 12, 30, 16), utcAt(10, 17, 12, 30, 17)}},
+		{"once", Once(utcAt(10, 17, 13, 0, 0)), []time.Time{utcAt(10, 17, 13, 0, 0), {}}},
+		{"once passed", Once(utcAt(10, 17, 12, 0, 0)), []time.Time{{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkTimes(t, nextN(tt.s, cronTestBase, len(tt.want)), tt.want)
+		})
+	}
+}
+
+// calendar rules out of range are bugs and panic with ErrCronSpec
+func TestCalendarRange(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		f    func() Schedule
+	}{
+		{"hour 24", func() Schedule { return Daily(24, 0, time.UTC) }},
+		{"hour -1", func() Schedule { return Daily(-1, 0, time.UTC) }},
+		{"minute 60", func() Schedule { return Daily(0, 60, time.UTC) }},
+		{"weekday 7", func() Schedule { return Weekly(time.Weekday(7), 0, 0, time.UTC) }},
+		{"weekly hour 25", func() Schedule { return Weekly(time.Monday, 25, 0, time.UTC) }},
+		{"day 0", func() Schedule { return Monthly(0, 0, 0, time.UTC) }},
+		{"day 32", func() Schedule { return Monthly(32, 0, 0, time.UTC) }},
+		{"monthly minute -1", func() Schedule { return Monthly(1, 0, -1, time.UTC) }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				err, _ := recover().(error)
+				if !errors.Is(err, ecode.ErrCronSpec) {
+					t.Fatalf("panic %v, want %v", err, ecode.ErrCronSpec)
+				}
+			}()
+			tt.f()
+		})
+	}
+
+	// the bounds are accepted
+	Daily(23, 59, time.UTC)
+	Weekly(time.Saturday, 0, 0, time.UTC)
+	Monthly(1, 0, 0, time.UTC)
+	Monthly(31, 23, 59, time.UTC)
+}
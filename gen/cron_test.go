@@ -0,0 +1,295 @@
+/*
+ * @Date: 2026-10-18 12:41:30
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 12:41:30
+ * @FilePath: /vlgo/gen/cron_test.go
+ * @Description: cron service on a fake clock, fires, catch up, persistence and jobs added while starting
+ */
+package gen
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+	"github.com/LiPengfei/vlgo/timerpool"
+	"github.com/LiPengfei/vlgo/utils/clock"
+)
+
+// a minute before midnight
+var cronTestStart = time.Date(2026, 1, 1, 23, 59, 0, 0, time.UTC)
+
+// cronTestH forward every *CronFired to its state
+type cronTestH struct{}
+
+func (cronTestH) Init(ctx ActorCtx, msg, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func (cronTestH) Handle(ctx ActorCtx, msg interface{}, state interface{}) ActorRet {
+	if f, ok := msg.(*CronFired); ok {
+		state.(chan *CronFired) <- f
+	}
+	return NewGenRet(nil, nil)
+}
+
+func (cronTestH) Stop(ctx ActorCtx, msg interface{}, state interface{}) {}
+
+func (cronTestH) Tick(ctx ActorCtx, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func (cronTestH) Timeout(ctx ActorCtx, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+// memCronStore CronStore kept in memory
+type memCronStore struct {
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+func (s *memCronStore) Load() (map[string]time.Time, error) {
+	return s.get(), nil
+}
+
+func (s *memCronStore) Save(next map[string]time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next = make(map[string]time.Time, len(next))
+	for k, v := range next {
+		s.next[k] = v
+	}
+	return nil
+}
+
+func (s *memCronStore) get() map[string]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := make(map[string]time.Time, len(s.next))
+	for k, v := range s.next {
+		next[k] = v
+	}
+	return next
+}
+
+// newTestCron cron on a fake clock at cronTestStart with its own one second wheel
+func newTestCron(t *testing.T, name string, store CronStore) (*Cron, *clock.Fake) {
+	t.Helper()
+	fc := clock.NewFake(cronTestStart)
+	restore := clock.Set(fc)
+	t.Cleanup(restore)
+	w := timerpool.NewWheel(time.Second)
+	t.Cleanup(w.Close)
+
+	c := NewCron(name, store)
+	c.Wheel = w
+	t.Cleanup(c.Stop)
+	return c, fc
+}
+
+func startCronTarget(t *testing.T, name string) chan *CronFired {
+	t.Helper()
+	fired := make(chan *CronFired, 8)
+	a := &Actor{}
+	if _, err := a.Start(Ctx(name), nil, fired, cronTestH{}); err != nil {
+		t.Fatalf("start %v: %v", name, err)
+	}
+	t.Cleanup(func() { a.Stop(StopReasonShutdown, 0) })
+	return fired
+}
+
+// advanceCron move the fake clock by d a second at a time, letting the wheel goroutine follow
+func advanceCron(fc *clock.Fake, d time.Duration) {
+	for ; d > 0; d -= time.Second {
+		fc.Advance(time.Second)
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func expectFired(t *testing.T, fired chan *CronFired, job string, at time.Time) {
+	t.Helper()
+	select {
+	case f := <-fired:
+		if f.Job != job || !f.At.Equal(at) {
+			t.Fatalf("fired %v at %v, want %v at %v", f.Job, f.At, job, at)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%v not fired at %v", job, at)
+	}
+}
+
+func expectNoFire(t *testing.T, fired chan *CronFired) {
+	t.Helper()
+	select {
+	case f := <-fired:
+		t.Fatalf("unexpected fire %v at %v", f.Job, f.At)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestCronFire(t *testing.T) {
+	store := &memCronStore{}
+	c, fc := newTestCron(t, "ctf", store)
+	fired := startCronTarget(t, "ctf_target")
+	midnight := cronTestStart.Add(time.Minute)
+
+	if err := c.Add(CronJob{Name: "reset", Schedule: Daily(0, 0, time.UTC), Target: "ctf_target"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddSpec("bad", "61 * * * *", "ctf_target", nil, false); !errors.Is(err, ecode.ErrCronSpec) {
+		t.Fatalf("bad spec: %v", err)
+	}
+	if _, err := c.Start(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add(CronJob{Name: "once", Schedule: Once(cronTestStart.Add(30 * time.Second)), Target: "ctf_target"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add(CronJob{Name: "once", Schedule: Every(time.Minute), Target: "ctf_target"}); err != ecode.ErrCronJobExists {
+		t.Fatalf("add twice: %v", err)
+	}
+	if jobs := c.Jobs(); len(jobs) != 2 || jobs[0].Name != "once" || !jobs[1].Next.Equal(midnight) {
+		t.Fatalf("jobs %v", jobs)
+	}
+
+	advanceCron(fc, 29*time.Second)
+	expectNoFire(t, fired)
+	advanceCron(fc, time.Second)
+	expectFired(t, fired, "once", cronTestStart.Add(30*time.Second))
+	advanceCron(fc, 30*time.Second)
+	expectFired(t, fired, "reset", midnight)
+	expectNoFire(t, fired)
+
+	// once is done, reset armed for the next day and persisted
+	jobs := c.Jobs()
+	if len(jobs) != 1 || !jobs[0].Next.Equal(midnight.Add(24*time.Hour)) {
+		t.Fatalf("jobs %v", jobs)
+	}
+	if saved := store.get(); len(saved) != 1 || !saved["reset"].Equal(midnight.Add(24*time.Hour)) {
+		t.Fatalf("saved %v", saved)
+	}
+
+	if err := c.Remove("reset"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Remove("reset"); err != ecode.ErrCronJobNotFound {
+		t.Fatalf("remove twice: %v", err)
+	}
+	if saved := store.get(); len(saved) != 0 {
+		t.Fatalf("saved %v after remove", saved)
+	}
+}
+
+// a fire missed while not running is caught up once the target is registered
+func TestCronCatchUp(t *testing.T) {
+	missed := time.Date(2026, 1, 1, 23, 0, 0, 0, time.UTC)
+	store := &memCronStore{next: map[string]time.Time{"reset": missed, "quiet": missed}}
+	c, fc := newTestCron(t, "ctc", store)
+
+	c.Add(CronJob{Name: "reset", Schedule: Daily(23, 0, time.UTC), Target: "ctc_target", CatchUp: true})
+	c.Add(CronJob{Name: "quiet", Schedule: Daily(23, 0, time.UTC), Target: "ctc_target"})
+	if _, err := c.Start(nil); err != nil {
+		t.Fatal(err)
+	}
+	// kept until delivered, a restart now still catches up
+	if saved := store.get(); !saved["reset"].Equal(missed) {
+		t.Fatalf("saved %v before the target exists", saved)
+	}
+
+	fired := startCronTarget(t, "ctc_target")
+	advanceCron(fc, time.Second)
+	expectFired(t, fired, "reset", missed)
+	expectNoFire(t, fired)
+
+	next := missed.Add(24 * time.Hour)
+	if saved := store.get(); !saved["reset"].Equal(next) || !saved["quiet"].Equal(next) {
+		t.Fatalf("saved %v after catch up", saved)
+	}
+	advanceCron(fc, 2*time.Second)
+	expectNoFire(t, fired)
+}
+
+func TestCronFileStore(t *testing.T) {
+	store := NewFileCronStore(filepath.Join(t.TempDir(), "cron.json"))
+	if next, err := store.Load(); err != nil || len(next) != 0 {
+		t.Fatalf("load missing file: %v %v", next, err)
+	}
+	want := map[string]time.Time{"reset": cronTestStart}
+	if err := store.Save(want); err != nil {
+		t.Fatal(err)
+	}
+	next, err := store.Load()
+	if err != nil || len(next) != 1 || !next["reset"].Equal(cronTestStart) {
+		t.Fatalf("load %v %v", next, err)
+	}
+}
+
+// startingSchedule daily at midnight, its first Next blocks until release
+type startingSchedule struct {
+	entered chan struct{}
+	release chan struct{}
+	once    *sync.Once
+}
+
+func (s startingSchedule) Next(after time.Time) time.Time {
+	s.once.Do(func() {
+		close(s.entered)
+		<-s.release
+	})
+	return Daily(0, 0, time.UTC).Next(after)
+}
+
+// a job added while the cron actor runs Init is armed too
+func TestCronAddWhileStarting(t *testing.T) {
+	c, _ := newTestCron(t, "cts", nil)
+	s := startingSchedule{entered: make(chan struct{}), release: make(chan struct{}), once: &sync.Once{}}
+	c.Add(CronJob{Name: "first", Schedule: s, Target: "cts_target"})
+
+	started := make(chan ecode.VEI, 1)
+	go func() {
+		_, err := c.Start(nil)
+		started <- err
+	}()
+	<-s.entered
+	if err := c.Add(CronJob{Name: "late", Schedule: Every(time.Minute), Target: "cts_target"}); err != nil {
+		t.Fatal(err)
+	}
+	close(s.release)
+	if err := <-started; err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := c.Jobs()
+	if len(jobs) != 2 || jobs[0].Name != "first" || jobs[1].Name != "late" || !jobs[1].Next.Equal(cronTestStart.Add(time.Minute)) {
+		t.Fatalf("jobs %v", jobs)
+	}
+}
+
+// a target with a full mailbox holds neither the cron nor the other jobs
+func TestCronTargetFull(t *testing.T) {
+	c, fc := newTestCron(t, "ctfull", nil)
+	gate := make(chan struct{})
+	defer close(gate)
+	startFunc(t, &Actor{MailboxLen: 1}, "ctfull_slow", funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		<-gate
+		return NewGenRet(nil, nil)
+	}})
+	fired := startCronTarget(t, "ctfull_target")
+
+	c.Add(CronJob{Name: "slow", Schedule: Every(time.Second), Target: "ctfull_slow"})
+	c.Add(CronJob{Name: "tick", Schedule: Every(time.Second), Target: "ctfull_target"})
+	if _, err := c.Start(nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 4; i++ {
+		advanceCron(fc, time.Second)
+		expectFired(t, fired, "tick", cronTestStart.Add(time.Duration(i)*time.Second))
+	}
+	if jobs := c.Jobs(); len(jobs) != 2 {
+		t.Fatalf("jobs %v", jobs)
+	}
+}
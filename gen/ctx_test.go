@@ -0,0 +1,86 @@
+/*
+ * @Date: 2026-10-18 16:10:37
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 16:10:37
+ * @FilePath: /vlgo/gen/ctx_test.go
+ * @Description: context of calls and casts, deadline, cancel and expired calls skipped
+ */
+package gen
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+type ctxTestKey struct{}
+
+// startCtxEcho echo actor sending the ctx value of each handled msg, blocking on "block" until gate closed
+func startCtxEcho(t *testing.T, name string, gate chan struct{}) chan interface{} {
+	t.Helper()
+	seen := make(chan interface{}, 16)
+	startFunc(t, &Actor{}, name, funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		if msg == "block" {
+			<-gate
+			return NewGenRet(nil, nil)
+		}
+		seen <- ctx.Context().Value(ctxTestKey{})
+		return NewGenRet(msg, nil)
+	}})
+	return seen
+}
+
+func TestCallCtx(t *testing.T) {
+	seen := startCtxEcho(t, "ct_value", nil)
+	a, _ := WhereIs("ct_value")
+
+	ctx := context.WithValue(context.Background(), ctxTestKey{}, "call")
+	if reply, err := a.CallCtx(ctx, 1); reply != 1 || err != nil {
+		t.Fatalf("call: %v %v", reply, err)
+	}
+	if v := recvMsg(t, seen, "call ctx"); v != "call" {
+		t.Fatalf("call ctx value %v", v)
+	}
+
+	a.CastCtx(context.WithValue(context.Background(), ctxTestKey{}, "cast"), 2)
+	if v := recvMsg(t, seen, "cast ctx"); v != "cast" {
+		t.Fatalf("cast ctx value %v", v)
+	}
+
+	// the ctx of a message is not left to the next one
+	a.Cast(3)
+	if v := recvMsg(t, seen, "plain cast"); v != nil {
+		t.Fatalf("plain cast ctx value %v", v)
+	}
+}
+
+// a call whose ctx is done before it is handled fails at once and is skipped by the actor
+func TestCallCtxDone(t *testing.T) {
+	gate := make(chan struct{})
+	seen := startCtxEcho(t, "ct_done", gate)
+	a, _ := WhereIs("ct_done")
+	a.Cast("block")
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxTestKey{}, "late"), 20*time.Millisecond)
+	defer cancel()
+	if _, err := a.CallCtx(ctx, 1); err != ecode.ErrActorHandleTimeout {
+		t.Fatalf("deadline: %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.WithValue(context.Background(), ctxTestKey{}, "canceled"))
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := a.CallCtx(ctx, 2); err != ecode.ErrActorCallCanceled {
+		t.Fatalf("cancel: %v", err)
+	}
+
+	close(gate)
+	ctx = context.WithValue(context.Background(), ctxTestKey{}, "next")
+	if reply, err := a.CallCtx(ctx, 3); reply != 3 || err != nil {
+		t.Fatalf("call after: %v %v", reply, err)
+	}
+	if v := recvMsg(t, seen, "handled"); v != "next" {
+		t.Fatalf("handled a call with ctx %v", v)
+	}
+}
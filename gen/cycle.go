@@ -0,0 +1,68 @@
+/*
+ * @Date: 2026-10-17 13:32:09
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 13:32:09
+ * @FilePath: /vlgo/gen/cycle.go
+ * @Description: detect call cycle between actors
+ */
+package gen
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/LiPengfei/vlgo/ecode"
+	"github.com/petermattis/goid"
+)
+
+const logCycle = "Cycle"
+
+// loopActors goroutine id -> *Actor whose loop is running on it
+var loopActors sync.Map
+
+// CallChain names of actors waiting synchronously on the call being handled, the last one is self
+func (ctx ActorCtx) CallChain() []string {
+	names := make([]string, 0, len(ctx.chain))
+	for _, a := range ctx.chain {
+		names = append(names, a.Name)
+	}
+	return names
+}
+
+// inLoop current goroutine is running s
+func (s *Actor) inLoop() bool {
+	v, ok := loopActors.Load(goid.Get())
+	return ok && v == s
+}
+
+// currentChain actors blocked if current goroutine call now, nil if not running in an actor loop
+func currentChain() []*Actor {
+	v, ok := loopActors.Load(goid.Get())
+	if !ok {
+		return nil
+	}
+
+	s := v.(*Actor)
+	if len(s.curChain) == 0 {
+		return []*Actor{s}
+	}
+	return s.curChain
+}
+
+// checkCycle fail if target already waiting in chain, the call would never be handled
+func checkCycle(chain []*Actor, target *Actor, msg interface{}) ecode.VEI {
+	for _, a := range chain {
+		if a != target {
+			continue
+		}
+
+		names := make([]string, 0, len(chain)+1)
+		for _, c := range chain {
+			names = append(names, c.Name)
+		}
+		path := strings.Join(append(names, target.Name), " -> ")
+		log.Errorf(logCycle, "Call", "call %v cycle: %s", typeName(msg), path)
+		return ecode.Wrap(ecode.ErrActorCallCycle, path)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+/*
+ * @Date: 2026-10-18 17:14:06
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 17:14:06
+ * @FilePath: /vlgo/gen/cycle_test.go
+ * @Description: call cycles to self and through other actors, call chains
+ */
+package gen
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+// startForward actor calling next for every msg but "chain", answered by its call chain
+func startForward(t *testing.T, name string, next **Actor) *Actor {
+	t.Helper()
+	return startFunc(t, &Actor{}, name, funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		switch msg {
+		case "chain":
+			return NewGenRet(strings.Join(ctx.CallChain(), " -> "), nil)
+		case "self":
+			return NewGenRet(ctx.Self().Call("chain"))
+		}
+		if *next == nil {
+			return NewGenRet("end", nil)
+		}
+		return NewGenRet((*next).Call(msg))
+	}})
+}
+
+func TestCallCycle(t *testing.T) {
+	var a, b, c *Actor
+	a = startForward(t, "cyt_a", &b)
+	b = startForward(t, "cyt_b", &c)
+	c = startForward(t, "cyt_c", &a)
+
+	_, err := a.Call("loop")
+	if !errors.Is(err, ecode.ErrActorCallCycle) {
+		t.Fatalf("cycle: %v", err)
+	}
+	if !strings.Contains(err.Error(), "cyt_a -> cyt_b -> cyt_c -> cyt_a") {
+		t.Fatalf("cycle path %v", err)
+	}
+
+	if _, err := a.Call("self"); !errors.Is(err, ecode.ErrActorCallCycle) {
+		t.Fatalf("call to self: %v", err)
+	}
+
+	// the actors still answer after a cycle is refused
+	if reply, err := c.Call("chain"); reply != "cyt_c" || err != nil {
+		t.Fatalf("chain: %v %v", reply, err)
+	}
+}
+
+func TestCallChain(t *testing.T) {
+	var a, b, c *Actor
+	a = startForward(t, "cyt_chain_a", &b)
+	b = startForward(t, "cyt_chain_b", &c)
+	c = startFunc(t, &Actor{}, "cyt_chain_c", funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		return NewGenRet(strings.Join(ctx.CallChain(), " -> "), nil)
+	}})
+	if reply, err := a.Call("who"); reply != "cyt_chain_a -> cyt_chain_b -> cyt_chain_c" || err != nil {
+		t.Fatalf("call chain: %v %v", reply, err)
+	}
+	if reply, err := c.Call("who"); reply != "cyt_chain_c" || err != nil {
+		t.Fatalf("call chain from outside: %v %v", reply, err)
+	}
+
+	// a call from the handler of a cast starts a new chain
+	replies := make(chan interface{}, 1)
+	d := startFunc(t, &Actor{}, "cyt_chain_d", funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		reply, err := a.Call("chain")
+		if err != nil {
+			reply = err
+		}
+		replies <- reply
+		return NewGenRet(nil, nil)
+	}})
+	d.Cast("back")
+	if reply := recvMsg(t, replies, "call back"); reply != "cyt_chain_d -> cyt_chain_a" {
+		t.Fatalf("call back: %v", reply)
+	}
+}
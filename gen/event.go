@@ -0,0 +1,284 @@
+/*
+ * @Date: 2026-10-17 15:12:44
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 15:12:44
+ * @FilePath: /vlgo/gen/event.go
+ * @Description: event manager hosting pluggable handlers, like erlang gen_event
+ */
+package gen
+
+import (
+	"fmt"
+
+	"github.com/LiPengfei/vlgo/ecode"
+	"github.com/LiPengfei/vlgo/utils"
+)
+
+const (
+	logEvent   = "Event"
+	logHandler = "Handler"
+)
+
+// reasons passed to EventHandlerI.Terminate
+const (
+	HandlerRemoved  = "remove"
+	HandlerStopped  = "stop"
+	HandlerPanic    = "panic"
+	HandlerShutdown = stopReasonShutdown
+)
+
+// EventHandlerI one handler hosted by EventManager, all methods run in the manager goroutine.
+// HandleEvent and HandleCall returning a stop ret remove the handler
+type EventHandlerI interface {
+	Init(ctx ActorCtx, args interface{}) ecode.VEI
+
+	HandleEvent(ctx ActorCtx, event interface{}) ActorRet
+	HandleCall(ctx ActorCtx, msg interface{}) ActorRet
+	Terminate(ctx ActorCtx, reason string)
+}
+
+// EventHandlerDown cast to EventManager.Report when a handler is removed for stop or panic
+type EventHandlerDown struct {
+	ID     string
+	Reason string
+	Err    ecode.VEI
+}
+
+type evHandler struct {
+	id string
+	h  EventHandlerI
+}
+
+type evAdd struct {
+	id   string
+	h    EventHandlerI
+	args interface{}
+}
+
+type evRemove struct {
+	id string
+}
+
+type evNotify struct {
+	event interface{}
+}
+
+type evCall struct {
+	id  string
+	msg interface{}
+}
+
+type evWhich struct{}
+
+// EventManager actor dispatching each event to all handlers in add order. A handler panic
+// only remove that handler, the manager keeps running
+type EventManager struct {
+	*Actor
+
+	// Report receive *EventHandlerDown if not nil
+	Report *Actor
+
+	handlers []*evHandler
+}
+
+// NewEventManager create a manager without handlers
+func NewEventManager() *EventManager {
+	return &EventManager{}
+}
+
+// Start start the actor loop, set em.Actor before Start to run with actor options
+func (em *EventManager) Start(ctx ActorCtx) ecode.VEI {
+	if em.Actor == nil {
+		em.Actor = &Actor{}
+	}
+	_, err := em.Actor.Start(ctx, nil, em, emHandler{})
+	return err
+}
+
+// AddHandler call h.Init with args and add it as id
+func (em *EventManager) AddHandler(id string, h EventHandlerI, args interface{}) ecode.VEI {
+	_, err := em.Call(&evAdd{id, h, args})
+	return err
+}
+
+// RemoveHandler call Terminate and remove the handler
+func (em *EventManager) RemoveHandler(id string) ecode.VEI {
+	_, err := em.Call(&evRemove{id})
+	return err
+}
+
+// Notify dispatch event to all handlers without waiting
+func (em *EventManager) Notify(event interface{}) ecode.VEI {
+	return em.Cast(&evNotify{event})
+}
+
+// SyncNotify dispatch event to all handlers and wait they all handled it
+func (em *EventManager) SyncNotify(event interface{}) ecode.VEI {
+	_, err := em.Call(&evNotify{event})
+	return err
+}
+
+// CallHandler call handler id and wait its reply
+func (em *EventManager) CallHandler(id string, msg interface{}) (interface{}, ecode.VEI) {
+	return em.Call(&evCall{id, msg})
+}
+
+// WhichHandlers ids of the handlers in add order
+func (em *EventManager) WhichHandlers() []string {
+	ids, _ := CallAs[[]string](em.Actor, &evWhich{})
+	return ids
+}
+
+type emHandler struct{}
+
+func (emHandler) Init(ctx ActorCtx, msg, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func (emHandler) Handle(ctx ActorCtx, msg interface{}, state interface{}) ActorRet {
+	em := state.(*EventManager)
+
+	switch msg := msg.(type) {
+	case *evNotify:
+		em.notify(ctx, msg.event)
+		return NewGenRet(nil, nil)
+
+	case *evCall:
+		return em.call(ctx, msg)
+
+	case *evAdd:
+		return NewGenRet(nil, em.add(ctx, msg))
+
+	case *evRemove:
+		i := em.indexOf(msg.id)
+		if i < 0 {
+			return NewGenRet(nil, ecode.ErrEventHandlerNotFound)
+		}
+		em.remove(ctx, i, HandlerRemoved, nil)
+		return NewGenRet(nil, nil)
+
+	case *evWhich:
+		ids := make([]string, 0, len(em.handlers))
+		for _, h := range em.handlers {
+			ids = append(ids, h.id)
+		}
+		return NewGenRet(ids, nil)
+
+	default:
+		log.Errorf(logEvent, logActor, "%v unexpected msg %v", ctx.Name(), typeName(msg))
+		return NewGenRet(nil, nil)
+	}
+}
+
+func (emHandler) Stop(ctx ActorCtx, msg interface{}, state interface{}) {
+	em := state.(*EventManager)
+	for i := len(em.handlers) - 1; i >= 0; i-- {
+		em.terminate(ctx, em.handlers[i], HandlerShutdown)
+	}
+	em.handlers = nil
+}
+
+func (emHandler) Tick(ctx ActorCtx, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func (emHandler) Timeout(ctx ActorCtx, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func (em *EventManager) add(ctx ActorCtx, msg *evAdd) (err ecode.VEI) {
+	if em.indexOf(msg.id) >= 0 {
+		return ecode.ErrEventHandlerExists
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf(logEvent, logHandler, "%v handler %v init panic: %v, stack: %s", ctx.Name(), msg.id, r, utils.Stack())
+			err = ecode.CustomThirdPluginErr(fmt.Errorf("init panic: %v", r))
+		}
+	}()
+	if err = msg.h.Init(ctx, msg.args); err != nil {
+		return err
+	}
+	em.handlers = append(em.handlers, &evHandler{msg.id, msg.h})
+	return nil
+}
+
+func (em *EventManager) notify(ctx ActorCtx, event interface{}) {
+	// copy, handlers removed while iterating
+	handlers := append([]*evHandler(nil), em.handlers...)
+	for _, h := range handlers {
+		ret, ok := em.safeHandle(ctx, h, func() ActorRet { return h.h.HandleEvent(ctx, event) })
+		if !ok || ret.IsStopped() {
+			em.removeStopped(ctx, h, ok, ret)
+		}
+	}
+}
+
+func (em *EventManager) call(ctx ActorCtx, msg *evCall) ActorRet {
+	i := em.indexOf(msg.id)
+	if i < 0 {
+		return NewGenRet(nil, ecode.ErrEventHandlerNotFound)
+	}
+
+	h := em.handlers[i]
+	ret, ok := em.safeHandle(ctx, h, func() ActorRet { return h.h.HandleCall(ctx, msg.msg) })
+	if !ok || ret.IsStopped() {
+		em.removeStopped(ctx, h, ok, ret)
+	}
+	// the manager keeps running whatever the handler returned
+	return NewGenRet(ret.ret(), ret.err())
+}
+
+func (em *EventManager) safeHandle(ctx ActorCtx, h *evHandler, f func() ActorRet) (ret ActorRet, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf(logEvent, logHandler, "%v handler %v panic: %v, stack: %s", ctx.Name(), h.id, r, utils.Stack())
+			ret = NewStopRet(nil, ecode.CustomThirdPluginErr(fmt.Errorf("panic: %v", r)))
+		}
+	}()
+	return f(), true
+}
+
+func (em *EventManager) removeStopped(ctx ActorCtx, h *evHandler, ok bool, ret ActorRet) {
+	i := em.indexOf(h.id)
+	if i < 0 || em.handlers[i] != h {
+		return
+	}
+
+	reason := HandlerStopped
+	if !ok {
+		reason = HandlerPanic
+	}
+	em.remove(ctx, i, reason, ret.err())
+}
+
+func (em *EventManager) remove(ctx ActorCtx, i int, reason string, err ecode.VEI) {
+	h := em.handlers[i]
+	em.handlers = append(em.handlers[:i], em.handlers[i+1:]...)
+	em.terminate(ctx, h, reason)
+
+	log.Infof(logEvent, logHandler, "%v handler %v removed, reason: %v, err: %v", ctx.Name(), h.id, reason, err)
+	if reason != HandlerRemoved && em.Report != nil {
+		// a full mailbox of Report must not hold the manager
+		em.Report.postNoWait(em.Report.Mailbox, &ActorCast{msg: &EventHandlerDown{ID: h.id, Reason: reason, Err: err}})
+	}
+}
+
+func (em *EventManager) terminate(ctx ActorCtx, h *evHandler, reason string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf(logEvent, logHandler, "%v handler %v terminate panic: %v, stack: %s", ctx.Name(), h.id, r, utils.Stack())
+		}
+	}()
+	h.h.Terminate(ctx, reason)
+}
+
+func (em *EventManager) indexOf(id string) int {
+	for i, h := range em.handlers {
+		if h.id == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,207 @@
+/*
+ * @Date: 2026-10-18 17:58:26
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 17:58:26
+ * @FilePath: /vlgo/gen/event_test.go
+ * @Description: event handlers dispatch order, calls, removal, panics and downs report
+ */
+package gen
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+type evLog struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (l *evLog) add(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.log = append(l.log, fmt.Sprintf(format, args...))
+}
+
+func (l *evLog) take() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	log := l.log
+	l.log = nil
+	return log
+}
+
+func expectLog(t *testing.T, l *evLog, want ...string) {
+	t.Helper()
+	got := l.take()
+	if len(got) != len(want) {
+		t.Fatalf("log %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("log %v, want %v", got, want)
+		}
+	}
+}
+
+// evRecH log every callback, panic on panicOn and stop on "stop"
+type evRecH struct {
+	id      string
+	l       *evLog
+	n       int
+	err     ecode.VEI
+	panicOn interface{}
+}
+
+func (h *evRecH) Init(ctx ActorCtx, args interface{}) ecode.VEI {
+	h.l.add("%v init %v", h.id, args)
+	return h.err
+}
+
+func (h *evRecH) HandleEvent(ctx ActorCtx, event interface{}) ActorRet {
+	switch {
+	case event == h.panicOn:
+		panic("boom")
+	case event == "stop":
+		return NewStopRet(nil, nil)
+	}
+	h.n++
+	h.l.add("%v event %v", h.id, event)
+	return NewGenRet(nil, nil)
+}
+
+func (h *evRecH) HandleCall(ctx ActorCtx, msg interface{}) ActorRet {
+	if msg == "stop" {
+		return NewStopRet("bye", nil)
+	}
+	return NewGenRet(h.n, nil)
+}
+
+func (h *evRecH) Terminate(ctx ActorCtx, reason string) {
+	h.l.add("%v terminate %v", h.id, reason)
+}
+
+func startTestEvents(t *testing.T, name string, report *Actor) *EventManager {
+	t.Helper()
+	em := NewEventManager()
+	em.Report = report
+	if err := em.Start(Ctx(name)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { em.Stop(StopReasonShutdown, 0) })
+	return em
+}
+
+func TestEventManager(t *testing.T) {
+	l := &evLog{}
+	em := startTestEvents(t, "evt_manager", nil)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := em.AddHandler(id, &evRecH{id: id, l: l}, id+"0"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := em.AddHandler("a", &evRecH{id: "a", l: l}, nil); err != ecode.ErrEventHandlerExists {
+		t.Fatalf("add twice: %v", err)
+	}
+	if err := em.AddHandler("d", &evRecH{id: "d", l: l, err: ecode.ErrActorStopped}, nil); err != ecode.ErrActorStopped {
+		t.Fatalf("init failed: %v", err)
+	}
+	expectLog(t, l, "a init a0", "b init b0", "c init c0", "d init <nil>")
+
+	em.Notify(1)
+	if err := em.SyncNotify(2); err != nil {
+		t.Fatal(err)
+	}
+	expectLog(t, l, "a event 1", "b event 1", "c event 1", "a event 2", "b event 2", "c event 2")
+
+	if n, err := em.CallHandler("b", "count"); n != 2 || err != nil {
+		t.Fatalf("call: %v %v", n, err)
+	}
+	if _, err := em.CallHandler("d", "count"); err != ecode.ErrEventHandlerNotFound {
+		t.Fatalf("call unknown: %v", err)
+	}
+
+	if err := em.RemoveHandler("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := em.RemoveHandler("b"); err != ecode.ErrEventHandlerNotFound {
+		t.Fatalf("remove twice: %v", err)
+	}
+	if ids := em.WhichHandlers(); len(ids) != 2 || ids[0] != "a" || ids[1] != "c" {
+		t.Fatalf("handlers %v", ids)
+	}
+	expectLog(t, l, "b terminate remove")
+
+	// terminated in reverse add order
+	em.Stop(StopReasonShutdown, 0)
+	expectLog(t, l, "c terminate shutdown", "a terminate shutdown")
+}
+
+// a handler panicking or returning stop is removed and reported, the others keep going
+func TestEventHandlerDown(t *testing.T) {
+	l := &evLog{}
+	report := &Actor{}
+	downs := startRecorder(t, report, "evt_report")
+	em := startTestEvents(t, "evt_down", report)
+	em.AddHandler("a", &evRecH{id: "a", l: l}, nil)
+	em.AddHandler("b", &evRecH{id: "b", l: l, panicOn: 1}, nil)
+	em.AddHandler("c", &evRecH{id: "c", l: l}, nil)
+	em.AddHandler("d", &evRecH{id: "d", l: l}, nil)
+	l.take()
+
+	em.SyncNotify(1)
+	expectLog(t, l, "a event 1", "b terminate panic", "c event 1", "d event 1")
+	if down, ok := recvMsg(t, downs, "down").(*EventHandlerDown); !ok || down.ID != "b" || down.Reason != HandlerPanic || down.Err == nil {
+		t.Fatalf("down %+v", down)
+	}
+
+	if reply, err := em.CallHandler("c", "stop"); reply != "bye" || err != nil {
+		t.Fatalf("call stop: %v %v", reply, err)
+	}
+	if down, ok := recvMsg(t, downs, "down").(*EventHandlerDown); !ok || down.ID != "c" || down.Reason != HandlerStopped {
+		t.Fatalf("down %+v", down)
+	}
+	em.SyncNotify("stop")
+	if down, ok := recvMsg(t, downs, "down").(*EventHandlerDown); !ok || down.ID != "a" || down.Reason != HandlerStopped {
+		t.Fatalf("down %+v", down)
+	}
+	if down, ok := recvMsg(t, downs, "down").(*EventHandlerDown); !ok || down.ID != "d" {
+		t.Fatalf("down %+v", down)
+	}
+	expectLog(t, l, "c terminate stop", "a terminate stop", "d terminate stop")
+	if ids := em.WhichHandlers(); len(ids) != 0 {
+		t.Fatalf("handlers %v", ids)
+	}
+	select {
+	case msg := <-downs:
+		t.Fatalf("got %v", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// a report actor with a full mailbox never holds the manager
+func TestEventReportFull(t *testing.T) {
+	gate := make(chan struct{})
+	report := startFunc(t, &Actor{MailboxLen: 1}, "evt_report_full", funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		<-gate
+		return NewGenRet(nil, nil)
+	}})
+	report.Cast("block")
+	report.Cast("fill")
+	defer close(gate)
+
+	l := &evLog{}
+	em := startTestEvents(t, "evt_full", report)
+	em.AddHandler("a", &evRecH{id: "a", l: l, panicOn: 1}, nil)
+	em.AddHandler("b", &evRecH{id: "b", l: l}, nil)
+	if err := em.SyncNotify(1); err != nil {
+		t.Fatalf("notify with a full report mailbox: %v", err)
+	}
+	if ids := em.WhichHandlers(); len(ids) != 1 || ids[0] != "b" {
+		t.Fatalf("handlers %v", ids)
+	}
+}
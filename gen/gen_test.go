@@ -0,0 +1,101 @@
+/*
+ * @Date: 2026-10-18 14:02:10
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 14:02:10
+ * @FilePath: /vlgo/gen/gen_test.go
+ * @Description: handler and helpers shared by the gen tests
+ */
+package gen
+
+import (
+	"testing"
+	"time"
+)
+
+// funcH handler built from funcs, a nil func answers NewGenRet(nil, nil)
+type funcH struct {
+	init    func(ctx ActorCtx, msg interface{}) ActorRet
+	handle  func(ctx ActorCtx, msg interface{}) ActorRet
+	stop    func(ctx ActorCtx, reason interface{})
+	tick    func(ctx ActorCtx) ActorRet
+	timeout func(ctx ActorCtx) ActorRet
+}
+
+func (h funcH) Init(ctx ActorCtx, msg, state interface{}) ActorRet {
+	if h.init == nil {
+		return NewGenRet(nil, nil)
+	}
+	return h.init(ctx, msg)
+}
+
+func (h funcH) Handle(ctx ActorCtx, msg interface{}, state interface{}) ActorRet {
+	if h.handle == nil {
+		return NewGenRet(nil, nil)
+	}
+	return h.handle(ctx, msg)
+}
+
+func (h funcH) Stop(ctx ActorCtx, msg interface{}, state interface{}) {
+	if h.stop != nil {
+		h.stop(ctx, msg)
+	}
+}
+
+func (h funcH) Tick(ctx ActorCtx, state interface{}) ActorRet {
+	if h.tick == nil {
+		return NewGenRet(nil, nil)
+	}
+	return h.tick(ctx)
+}
+
+func (h funcH) Timeout(ctx ActorCtx, state interface{}) ActorRet {
+	if h.timeout == nil {
+		return NewGenRet(nil, nil)
+	}
+	return h.timeout(ctx)
+}
+
+// echoFuncH answer every msg with itself, stop on "stop"
+func echoFuncH() funcH {
+	return funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		if msg == "stop" {
+			return NewStopRet(nil, nil)
+		}
+		return NewGenRet(msg, nil)
+	}}
+}
+
+// startFunc start a with h as name, stopped when the test ends
+func startFunc(t *testing.T, a *Actor, name string, h funcH) *Actor {
+	t.Helper()
+	if _, err := a.Start(Ctx(name), nil, nil, h); err != nil {
+		t.Fatalf("start %v: %v", name, err)
+	}
+	t.Cleanup(func() { a.Stop(StopReasonShutdown, 0) })
+	return a
+}
+
+// waitFor poll cond until it holds, fail the test after a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %v", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// recvMsg next value of ch, fail the test after a second
+func recvMsg[T any](t *testing.T, ch chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second):
+		t.Fatalf("no %v", what)
+		var zero T
+		return zero
+	}
+}
@@ -0,0 +1,36 @@
+/*
+ * @Date: 2026-10-18 00:58:20
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 00:58:20
+ * @FilePath: /vlgo/gen/gentest/clock.go
+ * @Description: fake clock helpers for tests
+ */
+package gentest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/utils/clock"
+)
+
+// FakeStart default start of FakeClock, fixed so tests do not depend on the day they run
+var FakeStart = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// FakeClock use a fake clock starting at start, FakeStart if zero, until the test ends. Set it
+// before starting the actors under test, timers already created keep the real clock
+func FakeClock(t testing.TB, start time.Time) *clock.Fake {
+	if start.IsZero() {
+		start = FakeStart
+	}
+	fc := clock.NewFake(start)
+	t.Cleanup(clock.Set(fc))
+	return fc
+}
+
+// AdvanceWhen wait until at least n timers are armed on fc, then advance it by d. Used when the
+// actor arms its timer asynchronously, e.g. StartTicker or the timeout after a cast
+func AdvanceWhen(fc *clock.Fake, n int, d time.Duration) {
+	fc.BlockUntil(n)
+	fc.Advance(d)
+}
@@ -0,0 +1,145 @@
+/*
+ * @Date: 2026-10-18 00:58:20
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 00:58:20
+ * @FilePath: /vlgo/gen/gentest/driver.go
+ * @Description: drive a handler synchronously without an actor loop
+ */
+package gentest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/gen"
+)
+
+const driverReplyLen = 64
+
+// Driver call the callbacks of a handler in the test goroutine. ctx.Self() is a probe, so casts to
+// self, timers and tickers started by the handler are received by Self instead of the handler.
+// ctx.Caller() replies to the driver, a handler returning CallNoRep sends its late reply there
+type Driver struct {
+	t     testing.TB
+	H     gen.ActorHandlerI
+	State interface{}
+	Self  *Probe
+
+	ctx     gen.ActorCtx
+	replies chan gen.ActorRet
+	stopped bool
+	last    gen.ActorRet
+}
+
+// NewDriver driver of h with state, its probe registered as name
+func NewDriver(t testing.TB, name string, h gen.ActorHandlerI, state interface{}) *Driver {
+	t.Helper()
+
+	self := NewProbe(t, name)
+	replies := make(chan gen.ActorRet, driverReplyLen)
+	ctx := self.Actor().Ctx.WithCaller(gen.NewCaller(replies))
+	return &Driver{t: t, H: h, State: state, Self: self, ctx: ctx, replies: replies}
+}
+
+// Init call H.Init
+func (d *Driver) Init(msg interface{}) gen.ActorRet {
+	d.t.Helper()
+	d.checkAlive("Init")
+	return d.record(d.H.Init(d.ctx, msg, d.State))
+}
+
+// Handle call H.Handle, as for a cast or a call: the reply is ret.Reply()
+func (d *Driver) Handle(msg interface{}) gen.ActorRet {
+	d.t.Helper()
+	d.checkAlive("Handle")
+	return d.record(d.H.Handle(d.ctx, msg, d.State))
+}
+
+// Tick call H.Tick
+func (d *Driver) Tick() gen.ActorRet {
+	d.t.Helper()
+	d.checkAlive("Tick")
+	return d.record(d.H.Tick(d.ctx, d.State))
+}
+
+// Timeout call H.Timeout
+func (d *Driver) Timeout() gen.ActorRet {
+	d.t.Helper()
+	d.checkAlive("Timeout")
+	return d.record(d.H.Timeout(d.ctx, d.State))
+}
+
+// Stop call H.Stop with reason, as the loop does once it exits
+func (d *Driver) Stop(reason string) {
+	d.t.Helper()
+	d.H.Stop(d.ctx, reason, d.State)
+	d.stopped = true
+}
+
+// ExpectReply the last callback returned want and no error
+func (d *Driver) ExpectReply(want interface{}) {
+	d.t.Helper()
+	if err := d.last.Err(); err != nil {
+		d.t.Fatalf("driver %v: got error %v, want reply %#v", d.Self.Name(), err, want)
+	}
+	if got := d.last.Reply(); !reflect.DeepEqual(got, want) {
+		d.t.Fatalf("driver %v: got reply %#v, want %#v", d.Self.Name(), got, want)
+	}
+}
+
+// ExpectStopped the last callback returned a stop ret
+func (d *Driver) ExpectStopped() {
+	d.t.Helper()
+	if !d.last.IsStopped() {
+		d.t.Fatalf("driver %v: want stop ret, got %#v", d.Self.Name(), d.last.Reply())
+	}
+}
+
+// LateReply next reply sent by ctx.Caller(), fail the test if none in Self.Timeout
+func (d *Driver) LateReply() gen.ActorRet {
+	d.t.Helper()
+
+	timer := time.NewTimer(d.Self.Timeout)
+	defer timer.Stop()
+	select {
+	case ret := <-d.replies:
+		return ret
+	case <-timer.C:
+		d.t.Fatalf("driver %v: no late reply in %v", d.Self.Name(), d.Self.Timeout)
+		return gen.ActorRet{}
+	}
+}
+
+// ExpectLateReply the next reply sent by ctx.Caller() is want and no error
+func (d *Driver) ExpectLateReply(want interface{}) {
+	d.t.Helper()
+
+	ret := d.LateReply()
+	if err := ret.Err(); err != nil {
+		d.t.Fatalf("driver %v: got late error %v, want reply %#v", d.Self.Name(), err, want)
+	}
+	if got := ret.Reply(); !reflect.DeepEqual(got, want) {
+		d.t.Fatalf("driver %v: got late reply %#v, want %#v", d.Self.Name(), got, want)
+	}
+}
+
+// Stopped a callback returned a stop ret or Stop was called
+func (d *Driver) Stopped() bool {
+	return d.stopped
+}
+
+func (d *Driver) record(ret gen.ActorRet) gen.ActorRet {
+	d.last = ret
+	if ret.IsStopped() {
+		d.stopped = true
+	}
+	return ret
+}
+
+func (d *Driver) checkAlive(callback string) {
+	d.t.Helper()
+	if d.stopped {
+		d.t.Fatalf("driver %v: %v after stop", d.Self.Name(), callback)
+	}
+}
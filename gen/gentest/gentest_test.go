@@ -0,0 +1,337 @@
+/*
+ * @Date: 2026-10-18 13:05:44
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 13:05:44
+ * @FilePath: /vlgo/gen/gentest/gentest_test.go
+ * @Description: probe expectations, driver callbacks and fake clock helpers
+ */
+package gentest_test
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/gen"
+	"github.com/LiPengfei/vlgo/gen/gentest"
+	"github.com/LiPengfei/vlgo/utils/clock"
+)
+
+// failT record the failures of the helpers under test instead of failing the test
+type failT struct {
+	*testing.T
+	mu     sync.Mutex
+	failed []string
+}
+
+func (f *failT) Helper() {}
+
+func (f *failT) Errorf(format string, args ...interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failed = append(f.failed, fmt.Sprintf(format, args...))
+}
+
+func (f *failT) Fatalf(format string, args ...interface{}) {
+	f.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+// expectFail run check in its own goroutine, as Fatalf ends it, and want it to fail
+func expectFail(t *testing.T, ft *failT, check func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		check()
+	}()
+	<-done
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	if len(ft.failed) == 0 {
+		t.Fatal("check passed, want it to fail")
+	}
+	ft.failed = nil
+}
+
+type gtState struct {
+	n       int
+	waiting []gen.ActorCaller
+}
+
+// gtCounterH count "inc", cast "inc" to self on "again" and stop on "stop" or timeout. "later" is
+// answered with the count on the next "flush"
+type gtCounterH struct{}
+
+func (gtCounterH) Init(ctx gen.ActorCtx, msg, state interface{}) gen.ActorRet {
+	ctx.Self().StartTimer("ping", time.Minute, "ping")
+	return gen.NewTimeRet(nil, nil, 10*time.Second)
+}
+
+func (gtCounterH) Handle(ctx gen.ActorCtx, msg interface{}, state interface{}) gen.ActorRet {
+	s := state.(*gtState)
+	switch msg {
+	case "inc":
+		s.n++
+		return gen.NewGenRet(s.n, nil)
+	case "again":
+		ctx.Self().Cast("inc")
+	case "later":
+		s.waiting = append(s.waiting, ctx.Caller())
+		return gen.NewGenRet(gen.CallNoRep, nil)
+	case "flush":
+		for _, caller := range s.waiting {
+			caller.SendReply(s.n, nil)
+		}
+		s.waiting = nil
+	case "stop":
+		return gen.NewStopRet(nil, nil)
+	}
+	return gen.NewGenRet(nil, nil)
+}
+
+func (gtCounterH) Stop(ctx gen.ActorCtx, msg interface{}, state interface{}) {}
+
+func (gtCounterH) Tick(ctx gen.ActorCtx, state interface{}) gen.ActorRet {
+	return gen.NewGenRet(nil, nil)
+}
+
+func (gtCounterH) Timeout(ctx gen.ActorCtx, state interface{}) gen.ActorRet {
+	return gen.NewStopRet(nil, nil)
+}
+
+func TestProbeExpect(t *testing.T) {
+	p := gentest.NewProbe(t, "gt_probe")
+	if a, ok := gen.WhereIs("gt_probe"); !ok || a != p.Actor() || p.Name() != "gt_probe" {
+		t.Fatalf("probe not registered as gt_probe")
+	}
+
+	type hello struct{ Who string }
+	p.Actor().Cast(&hello{"bob"})
+	p.Actor().Cast(&hello{"amy"})
+	p.Actor().Cast(3)
+	p.ExpectMsg(&hello{"bob"})
+	if h := gentest.ExpectMsgType[*hello](p); h.Who != "amy" {
+		t.Fatalf("got %v", h)
+	}
+	p.ExpectMsgThat(func(msg interface{}) bool { return msg == 3 })
+
+	p.Actor().Cast("a")
+	p.Actor().Cast("b")
+	time.Sleep(10 * time.Millisecond)
+	if msgs := p.Msgs(); len(msgs) != 2 || msgs[0] != "a" || msgs[1] != "b" {
+		t.Fatalf("msgs %v", msgs)
+	}
+	p.ExpectNoMsg(10 * time.Millisecond)
+
+	// calls are recorded and answered by the reply func, nil before it is set
+	if reply, err := p.Actor().Call("echo"); reply != nil || err != nil {
+		t.Fatalf("call before SetReply: %v %v", reply, err)
+	}
+	p.SetReply(func(msg interface{}) interface{} { return "re " + msg.(string) })
+	if reply, err := p.Actor().Call("echo"); reply != "re echo" || err != nil {
+		t.Fatalf("call: %v %v", reply, err)
+	}
+	p.ExpectMsg("echo")
+	p.ExpectMsg("echo")
+}
+
+func TestProbeFail(t *testing.T) {
+	ft := &failT{T: t}
+	p := gentest.NewProbe(ft, "")
+	p.Timeout = 20 * time.Millisecond
+	other := gentest.NewProbe(t, "")
+
+	tests := []struct {
+		name  string
+		check func()
+	}{
+		{"no message", func() { p.ReceiveMsg() }},
+		{"other message", func() {
+			p.Actor().Cast(1)
+			p.ExpectMsg(2)
+		}},
+		{"other type", func() {
+			p.Actor().Cast(1)
+			gentest.ExpectMsgType[string](p)
+		}},
+		{"not matched", func() {
+			p.Actor().Cast(1)
+			p.ExpectMsgThat(func(msg interface{}) bool { return false })
+		}},
+		{"unexpected message", func() {
+			p.Actor().Cast(1)
+			p.ExpectNoMsg(50 * time.Millisecond)
+		}},
+		{"not stopped", func() { p.ExpectStopped(other.Actor()) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectFail(t, ft, tt.check)
+		})
+	}
+}
+
+// messages over the buffer are reported by the next expectation, from the test goroutine
+func TestProbeOverflow(t *testing.T) {
+	ft := &failT{T: t}
+	p := gentest.NewProbe(ft, "")
+	const bufLen = 4096
+	for i := 0; i < bufLen+2; i++ {
+		p.Actor().Cast(i)
+	}
+	// recorded too, so dropped as well
+	p.Actor().Call("sync")
+
+	if msgs := p.Msgs(); len(msgs) != bufLen || msgs[bufLen-1] != bufLen-1 {
+		t.Fatalf("%v msgs", len(msgs))
+	}
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	if len(ft.failed) != 1 || !strings.Contains(ft.failed[0], fmt.Sprintf("dropped 3 from %v", bufLen)) {
+		t.Fatalf("failed %v", ft.failed)
+	}
+	ft.failed = nil
+}
+
+func TestProbeWatch(t *testing.T) {
+	p := gentest.NewProbe(t, "")
+	a := &gen.Actor{}
+	if _, err := a.Start(gen.Ctx("gt_watched"), nil, &gtState{}, gtCounterH{}); err != nil {
+		t.Fatal(err)
+	}
+	p.Watch(a)
+	a.Cast("stop")
+	p.ExpectStopped(a)
+	if down := gentest.ExpectMsgType[*gen.ActorDown](p); down.Name != "gt_watched" {
+		t.Fatalf("down %v", down)
+	}
+}
+
+// with a fake clock ExpectNoMsg advances it instead of waiting
+func TestProbeFakeClock(t *testing.T) {
+	fc := gentest.FakeClock(t, time.Time{})
+	if !fc.Now().Equal(gentest.FakeStart) {
+		t.Fatalf("start %v, want %v", fc.Now(), gentest.FakeStart)
+	}
+	p := gentest.NewProbe(t, "")
+	p.Actor().StartTimer("late", 90*time.Minute, "late")
+
+	begin := time.Now()
+	p.ExpectNoMsg(time.Hour)
+	if waited := time.Since(begin); waited > time.Second {
+		t.Fatalf("waited %v of real time", waited)
+	}
+	if at := fc.Now(); !at.Equal(gentest.FakeStart.Add(time.Hour)) {
+		t.Fatalf("now %v after ExpectNoMsg", at)
+	}
+	fc.Advance(30 * time.Minute)
+	p.ExpectMsg("late")
+}
+
+func TestFakeClockRestore(t *testing.T) {
+	start := time.Date(2030, 5, 1, 0, 0, 0, 0, time.UTC)
+	t.Run("fake", func(t *testing.T) {
+		gentest.FakeClock(t, start)
+		if !clock.Now().Equal(start) {
+			t.Fatalf("now %v, want %v", clock.Now(), start)
+		}
+	})
+	if !clock.IsReal() {
+		t.Fatal("real clock not restored after the test")
+	}
+}
+
+// the timeout is armed by the actor loop after Init, AdvanceWhen waits for it
+func TestAdvanceWhen(t *testing.T) {
+	fc := gentest.FakeClock(t, time.Time{})
+	p := gentest.NewProbe(t, "")
+	a := &gen.Actor{}
+	if _, err := a.Start(gen.Ctx("gt_timeout"), nil, &gtState{}, gtCounterH{}); err != nil {
+		t.Fatal(err)
+	}
+	p.Watch(a)
+
+	// the ping timer started by Init and the timeout it returned
+	gentest.AdvanceWhen(fc, 2, 10*time.Second)
+	p.ExpectStopped(a)
+	gentest.ExpectMsgType[*gen.ActorDown](p)
+}
+
+func TestDriver(t *testing.T) {
+	fc := gentest.FakeClock(t, time.Time{})
+	s := &gtState{}
+	d := gentest.NewDriver(t, "gt_driver", gtCounterH{}, s)
+
+	if ret := d.Init(nil); ret.Out() != 10*time.Second {
+		t.Fatalf("init timeout %v", ret.Out())
+	}
+	d.Handle("inc")
+	d.ExpectReply(1)
+	d.Handle("inc")
+	d.ExpectReply(2)
+	if s.n != 2 {
+		t.Fatalf("state %v", s.n)
+	}
+
+	// casts to self and timers reach the probe, not the handler
+	d.Handle("again")
+	d.ExpectReply(nil)
+	d.Self.ExpectMsg("inc")
+	fc.Advance(time.Minute)
+	d.Self.ExpectMsg("ping")
+	if s.n != 2 {
+		t.Fatalf("state %v after cast to self", s.n)
+	}
+
+	d.Timeout()
+	d.ExpectStopped()
+	if !d.Stopped() {
+		t.Fatal("not stopped after a stop ret")
+	}
+}
+
+// a handler answering later replies by ctx.Caller() to the driver
+func TestDriverLateReply(t *testing.T) {
+	s := &gtState{}
+	d := gentest.NewDriver(t, "", gtCounterH{}, s)
+	d.Init(nil)
+
+	d.Handle("later")
+	d.ExpectReply(gen.CallNoRep)
+	d.Handle("inc")
+	d.Handle("later")
+	d.Handle("flush")
+	d.ExpectLateReply(1)
+	d.ExpectLateReply(1)
+
+	// from another goroutine too
+	d.Handle("later")
+	go s.waiting[0].SendReply("async", nil)
+	d.ExpectLateReply("async")
+}
+
+func TestDriverFail(t *testing.T) {
+	ft := &failT{T: t}
+	d := gentest.NewDriver(ft, "", gtCounterH{}, &gtState{})
+	d.Init(nil)
+
+	d.Handle("inc")
+	expectFail(t, ft, func() { d.ExpectReply(2) })
+	expectFail(t, ft, func() { d.ExpectStopped() })
+
+	d.Self.Timeout = 20 * time.Millisecond
+	expectFail(t, ft, func() { d.LateReply() })
+	d.Handle("later")
+	d.Handle("flush")
+	expectFail(t, ft, func() { d.ExpectLateReply(2) })
+
+	d.Stop(gen.StopReasonShutdown)
+	if !d.Stopped() {
+		t.Fatal("not stopped after Stop")
+	}
+	expectFail(t, ft, func() { d.Handle("inc") })
+}
@@ -0,0 +1,229 @@
+/*
+ * @Date: 2026-10-18 00:58:20
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 00:58:20
+ * @FilePath: /vlgo/gen/gentest/probe.go
+ * @Description: probe actor recording the messages it receives, with expectations for tests
+ */
+package gentest
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/gen"
+	"github.com/LiPengfei/vlgo/utils/clock"
+)
+
+const (
+	// DefaultExpectTimeout real time ExpectMsg and ExpectStopped wait
+	DefaultExpectTimeout = 3 * time.Second
+	// NoMsgGrace real time ExpectNoMsg still waits after advancing a fake clock, for the actors
+	// woken by the advance to run
+	NoMsgGrace = 20 * time.Millisecond
+
+	probeBufLen = 4096
+)
+
+// Probe actor recording every cast and call it receives, calls are answered by the reply func.
+// Messages over the buffer are dropped and reported by the next expectation or at cleanup
+type Probe struct {
+	t       testing.TB
+	actor   *gen.Actor
+	msgs    chan interface{}
+	Timeout time.Duration
+
+	mu        sync.Mutex
+	reply     func(msg interface{}) interface{}
+	dropped   int
+	firstDrop interface{}
+}
+
+// NewProbe start a probe registered as name, anonymous if name is empty, stopped by t.Cleanup
+func NewProbe(t testing.TB, name string) *Probe {
+	t.Helper()
+
+	p := &Probe{t: t, msgs: make(chan interface{}, probeBufLen), Timeout: DefaultExpectTimeout}
+	p.actor = &gen.Actor{MailboxLen: gen.MaxMailBoxLen}
+	if _, err := p.actor.Start(gen.Ctx(name), nil, p, probeHandler{}); err != nil {
+		t.Fatalf("start probe %v: %v", name, err)
+	}
+	t.Cleanup(func() {
+		p.actor.Stop(gen.StopReasonShutdown, 0)
+		p.checkDropped()
+	})
+	return p
+}
+
+// Actor the probe actor, e.g. a cast target, a monitor or a subscriber
+func (p *Probe) Actor() *gen.Actor {
+	return p.actor
+}
+
+// Name registry name of the probe
+func (p *Probe) Name() string {
+	return p.actor.Name
+}
+
+// SetReply answer calls by f(msg), nil reply if not set
+func (p *Probe) SetReply(f func(msg interface{}) interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reply = f
+}
+
+// Watch monitor a, its *gen.ActorDown is received by the probe
+func (p *Probe) Watch(a *gen.Actor) gen.MonitorRef {
+	return p.actor.Monitor(a)
+}
+
+// ReceiveMsg next message, fail the test if none in Timeout
+func (p *Probe) ReceiveMsg() interface{} {
+	p.t.Helper()
+	p.checkDropped()
+
+	timer := time.NewTimer(p.Timeout)
+	defer timer.Stop()
+	select {
+	case msg := <-p.msgs:
+		return msg
+	case <-timer.C:
+		p.t.Fatalf("probe %v: no message in %v", p.Name(), p.Timeout)
+		return nil
+	}
+}
+
+// ExpectMsg next message deep equal to want
+func (p *Probe) ExpectMsg(want interface{}) interface{} {
+	p.t.Helper()
+
+	msg := p.ReceiveMsg()
+	if !reflect.DeepEqual(msg, want) {
+		p.t.Fatalf("probe %v: got %#v, want %#v", p.Name(), msg, want)
+	}
+	return msg
+}
+
+// ExpectMsgThat next message accepted by match
+func (p *Probe) ExpectMsgThat(match func(msg interface{}) bool) interface{} {
+	p.t.Helper()
+
+	msg := p.ReceiveMsg()
+	if !match(msg) {
+		p.t.Fatalf("probe %v: unexpected %#v", p.Name(), msg)
+	}
+	return msg
+}
+
+// ExpectMsgType next message of type T
+func ExpectMsgType[T any](p *Probe) T {
+	p.t.Helper()
+
+	msg := p.ReceiveMsg()
+	v, ok := msg.(T)
+	if !ok {
+		var want T
+		p.t.Fatalf("probe %v: got %T, want %T", p.Name(), msg, want)
+	}
+	return v
+}
+
+// ExpectNoMsg no message in d. With a fake clock in use d is advanced on it instead of waited,
+// then NoMsgGrace of real time is waited
+func (p *Probe) ExpectNoMsg(d time.Duration) {
+	p.t.Helper()
+	p.checkDropped()
+
+	wait := d
+	if fc, ok := clock.Get().(*clock.Fake); ok {
+		fc.Advance(d)
+		wait = NoMsgGrace
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case msg := <-p.msgs:
+		p.t.Fatalf("probe %v: got %#v, want no message in %v", p.Name(), msg, d)
+	case <-timer.C:
+	}
+}
+
+// ExpectStopped a stopped in Timeout
+func (p *Probe) ExpectStopped(a *gen.Actor) {
+	p.t.Helper()
+
+	timer := time.NewTimer(p.Timeout)
+	defer timer.Stop()
+	select {
+	case <-a.Done():
+	case <-timer.C:
+		p.t.Fatalf("actor %v not stopped in %v", a.Name, p.Timeout)
+	}
+}
+
+// Msgs messages received and not expected yet, without waiting
+func (p *Probe) Msgs() []interface{} {
+	p.t.Helper()
+	p.checkDropped()
+
+	var msgs []interface{}
+	for {
+		select {
+		case msg := <-p.msgs:
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+// checkDropped fail the test in its own goroutine if the handler dropped messages since last check
+func (p *Probe) checkDropped() {
+	p.t.Helper()
+
+	p.mu.Lock()
+	n, first := p.dropped, p.firstDrop
+	p.dropped, p.firstDrop = 0, nil
+	p.mu.Unlock()
+	if n > 0 {
+		p.t.Errorf("probe %v: %v messages not expected, dropped %v from %#v", p.Name(), probeBufLen, n, first)
+	}
+}
+
+type probeHandler struct{}
+
+func (probeHandler) Init(ctx gen.ActorCtx, msg, state interface{}) gen.ActorRet {
+	return gen.NewGenRet(nil, nil)
+}
+
+func (probeHandler) Handle(ctx gen.ActorCtx, msg interface{}, state interface{}) gen.ActorRet {
+	p := state.(*Probe)
+	p.mu.Lock()
+	select {
+	case p.msgs <- msg:
+	default:
+		// t must not be failed from the actor goroutine
+		if p.dropped++; p.dropped == 1 {
+			p.firstDrop = msg
+		}
+	}
+	reply := p.reply
+	p.mu.Unlock()
+	if reply != nil {
+		return gen.NewGenRet(reply(msg), nil)
+	}
+	return gen.NewGenRet(nil, nil)
+}
+
+func (probeHandler) Stop(ctx gen.ActorCtx, msg interface{}, state interface{}) {}
+
+func (probeHandler) Tick(ctx gen.ActorCtx, state interface{}) gen.ActorRet {
+	return gen.NewGenRet(nil, nil)
+}
+
+func (probeHandler) Timeout(ctx gen.ActorCtx, state interface{}) gen.ActorRet {
+	return gen.NewGenRet(nil, nil)
+}
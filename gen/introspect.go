@@ -0,0 +1,224 @@
+/*
+ * @Date: 2026-10-17 22:08:33
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 22:08:33
+ * @FilePath: /vlgo/gen/introspect.go
+ * @Description: system requests answered by the actor loop, for ops tooling
+ */
+package gen
+
+import (
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+	"github.com/LiPengfei/vlgo/utils/clock"
+	"go.uber.org/atomic"
+)
+
+const logSysMsg = "SysMsg"
+
+// StateSnapshotter implemented by a handler to answer GetState with a copy, otherwise the state itself
+// is returned and the caller must not touch it while the actor runs
+type StateSnapshotter interface {
+	Snapshot(state interface{}) interface{}
+}
+
+// ActorStatus answered by GetStatus
+type ActorStatus struct {
+	Name      string
+	Mailbox   int
+	Dropped   uint64
+	Pending   int
+	Uptime    time.Duration
+	Processed uint64
+	Suspended bool
+
+	// CurrentMsg message type being handled, only set when the loop is busy and the status is
+	// built outside it, LastMsg the last one handled
+	CurrentMsg string
+	LastMsg    string
+
+	// Ticker interval of the active ticker, TimeoutIn time left before Timeout, 0 if none
+	Ticker    time.Duration
+	TimeoutIn time.Duration
+}
+
+// actorStats updated by the loop, atomics are read outside it when the loop does not answer
+type actorStats struct {
+	startAt   time.Time
+	processed atomic.Uint64
+	curMsg    atomic.String
+	lastMsg   string
+	suspended bool
+	tickEvery time.Duration
+	outAt     time.Time
+}
+
+type sysGetState struct{}
+
+type sysGetStatus struct{}
+
+type sysSuspend struct{}
+
+type sysResume struct{}
+
+type sysReplaceState struct {
+	f func(state interface{}) interface{}
+}
+
+// GetState state snapshot of the actor registered as name
+func GetState(name string) (interface{}, ecode.VEI) {
+	a, ok := WhereIs(name)
+	if !ok {
+		return nil, ecode.ErrActorNotFound
+	}
+	return a.GetState()
+}
+
+// GetStatus status of the actor registered as name
+func GetStatus(name string) (ActorStatus, ecode.VEI) {
+	a, ok := WhereIs(name)
+	if !ok {
+		return ActorStatus{Name: name}, ecode.ErrActorNotFound
+	}
+	return a.GetStatus()
+}
+
+// Suspend the actor registered as name
+func Suspend(name string) ecode.VEI {
+	a, ok := WhereIs(name)
+	if !ok {
+		return ecode.ErrActorNotFound
+	}
+	return a.Suspend()
+}
+
+// Resume the actor registered as name
+func Resume(name string) ecode.VEI {
+	a, ok := WhereIs(name)
+	if !ok {
+		return ecode.ErrActorNotFound
+	}
+	return a.Resume()
+}
+
+// ReplaceState replace the state of the actor registered as name by f(state)
+func ReplaceState(name string, f func(state interface{}) interface{}) ecode.VEI {
+	a, ok := WhereIs(name)
+	if !ok {
+		return ecode.ErrActorNotFound
+	}
+	return a.ReplaceState(f)
+}
+
+// GetState H.Snapshot(state) if H is a StateSnapshotter, otherwise the state
+func (s *Actor) GetState() (interface{}, ecode.VEI) {
+	return s.CallPriority(PrioritySystem, &sysGetState{})
+}
+
+// GetStatus ask the loop, a busy loop not answering in genTimeOut get a partial status built outside
+// it with CurrentMsg set, and ErrActorCallTimeout
+func (s *Actor) GetStatus() (ActorStatus, ecode.VEI) {
+	ret, err := s.CallPriority(PrioritySystem, &sysGetStatus{})
+	if status, ok := ret.(ActorStatus); ok && err == nil {
+		return status, nil
+	}
+
+	return ActorStatus{
+		Name:       s.Name,
+		Mailbox:    s.MailboxSize(),
+		Dropped:    s.Dropped(),
+		Uptime:     clock.Since(s.stats.startAt),
+		Processed:  s.stats.processed.Load(),
+		CurrentMsg: s.stats.curMsg.Load(),
+	}, err
+}
+
+// Suspend stop handling mails, ticks and timeouts until Resume, system requests still answered
+func (s *Actor) Suspend() ecode.VEI {
+	_, err := s.CallPriority(PrioritySystem, &sysSuspend{})
+	return err
+}
+
+// Resume undo Suspend
+func (s *Actor) Resume() ecode.VEI {
+	_, err := s.CallPriority(PrioritySystem, &sysResume{})
+	return err
+}
+
+// ReplaceState run f in the loop and use its result as the new state, e.g. fix a corrupted field
+func (s *Actor) ReplaceState(f func(state interface{}) interface{}) ecode.VEI {
+	_, err := s.CallPriority(PrioritySystem, &sysReplaceState{f})
+	return err
+}
+
+// handleSys answer a system request, ok false if msg is not one
+func (s *Actor) handleSys(msg interface{}) (ret interface{}, ok bool) {
+	switch msg := msg.(type) {
+	case *sysGetState:
+		if snap, ok := s.H.(StateSnapshotter); ok {
+			return snap.Snapshot(s.State), true
+		}
+		return s.State, true
+
+	case *sysGetStatus:
+		return s.status(), true
+
+	case *sysSuspend:
+		log.Infof(logSysMsg, logActor, "%v suspended", s.Name)
+		s.stats.suspended = true
+		return nil, true
+
+	case *sysResume:
+		log.Infof(logSysMsg, logActor, "%v resumed", s.Name)
+		s.stats.suspended = false
+		return nil, true
+
+	case *sysReplaceState:
+		log.Infof(logSysMsg, logActor, "%v replace state", s.Name)
+		s.State = msg.f(s.State)
+		return nil, true
+	}
+	return nil, false
+}
+
+// status called in loop
+func (s *Actor) status() ActorStatus {
+	st := ActorStatus{
+		Name:      s.Name,
+		Mailbox:   s.MailboxSize(),
+		Dropped:   s.Dropped(),
+		Pending:   len(s.PendingCalls()),
+		Uptime:    clock.Since(s.stats.startAt),
+		Processed: s.stats.processed.Load(),
+		Suspended: s.stats.suspended,
+		LastMsg:   s.stats.lastMsg,
+		Ticker:    s.stats.tickEvery,
+	}
+	if !s.stats.outAt.IsZero() {
+		if st.TimeoutIn = clock.Until(s.stats.outAt); st.TimeoutIn < 0 {
+			st.TimeoutIn = 0
+		}
+	}
+	return st
+}
+
+// beginMsg and endMsg wrap the handling of a user message
+func (s *Actor) beginMsg(msg interface{}) {
+	s.stats.curMsg.Store(typeName(msg))
+}
+
+func (s *Actor) endMsg() {
+	s.stats.lastMsg = s.stats.curMsg.Swap("")
+	s.stats.processed.Inc()
+}
+
+// suspendedMail take a system mail without blocking when suspended
+func (s *Actor) suspendedMail() (interface{}, bool) {
+	select {
+	case msg := <-s.sysBox:
+		return msg, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,128 @@
+/*
+ * @Date: 2026-10-18 19:21:48
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 19:21:48
+ * @FilePath: /vlgo/gen/introspect_test.go
+ * @Description: status, state snapshot, suspend, resume and replace state by name
+ */
+package gen
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+// snapFuncH funcH answering GetState with a copy of its *int state
+type snapFuncH struct{ funcH }
+
+func (snapFuncH) Snapshot(state interface{}) interface{} { return *state.(*int) }
+
+// startCounter count its msgs in an *int state, "get" answers the count, "tick" starts a ticker
+func startCounter(t *testing.T, a *Actor, name string) *Actor {
+	t.Helper()
+	n := 0
+	h := snapFuncH{funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		st := ctx.Self().State.(*int)
+		switch msg {
+		case "get":
+			return NewGenRet(*st, nil)
+		case "tick":
+			ctx.Self().StartTicker(time.Minute)
+		}
+		*st++
+		return NewGenRet(nil, nil)
+	}}}
+	if _, err := a.Start(Ctx(name), nil, &n, h); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Stop(StopReasonShutdown, 0) })
+	return a
+}
+
+func TestIntrospect(t *testing.T) {
+	sc := newTestSched(t, 2, 4)
+	for _, tt := range []struct {
+		name  string
+		sched *Scheduler
+	}{{"int_loop", nil}, {"int_sched", sc}} {
+		t.Run(tt.name, func(t *testing.T) {
+			a := startCounter(t, &Actor{Sched: tt.sched, DefaultOut: time.Minute}, tt.name)
+			a.Call("x")
+			a.Call("tick")
+
+			// the ticker is armed by the loop after the handler returned
+			var st ActorStatus
+			var err ecode.VEI
+			waitFor(t, "ticker", func() bool {
+				st, err = GetStatus(tt.name)
+				return st.Ticker == time.Minute
+			})
+			if err != nil || st.Name != tt.name || st.Processed != 2 || st.LastMsg != "string" || st.Mailbox != 0 {
+				t.Fatalf("status %+v %v", st, err)
+			}
+			if st.TimeoutIn <= 0 || st.TimeoutIn > time.Minute || st.Suspended {
+				t.Fatalf("status %+v", st)
+			}
+			if v, err := GetState(tt.name); v != 2 || err != nil {
+				t.Fatalf("state %v %v", v, err)
+			}
+
+			// mails wait while suspended, system requests are still answered
+			if err := Suspend(tt.name); err != nil {
+				t.Fatal(err)
+			}
+			a.Cast("x")
+			time.Sleep(20 * time.Millisecond)
+			if v, _ := GetState(tt.name); v != 2 {
+				t.Fatalf("handled while suspended, state %v", v)
+			}
+			if st, _ := GetStatus(tt.name); !st.Suspended || st.Mailbox != 1 {
+				t.Fatalf("suspended status %+v", st)
+			}
+			if err := ReplaceState(tt.name, func(state interface{}) interface{} {
+				n := 10
+				return &n
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if err := Resume(tt.name); err != nil {
+				t.Fatal(err)
+			}
+			if v, err := a.Call("get"); v != 11 || err != nil {
+				t.Fatalf("get after resume %v %v", v, err)
+			}
+		})
+	}
+}
+
+// without a snapshotter the state itself is answered
+func TestIntrospectState(t *testing.T) {
+	a := &Actor{}
+	if _, err := a.Start(Ctx("int_state"), nil, "plain", echoFuncH()); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop(StopReasonShutdown, 0)
+	if v, err := GetState("int_state"); v != "plain" || err != nil {
+		t.Fatalf("state %v %v", v, err)
+	}
+}
+
+func TestIntrospectNotFound(t *testing.T) {
+	if _, err := GetState("int_none"); err != ecode.ErrActorNotFound {
+		t.Fatalf("state: %v", err)
+	}
+	if _, err := GetStatus("int_none"); err != ecode.ErrActorNotFound {
+		t.Fatalf("status: %v", err)
+	}
+	if err := Suspend("int_none"); err != ecode.ErrActorNotFound {
+		t.Fatalf("suspend: %v", err)
+	}
+	if err := Resume("int_none"); err != ecode.ErrActorNotFound {
+		t.Fatalf("resume: %v", err)
+	}
+	if err := ReplaceState("int_none", nil); err != ecode.ErrActorNotFound {
+		t.Fatalf("replace: %v", err)
+	}
+}
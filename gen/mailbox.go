@@ -0,0 +1,206 @@
+/*
+ * @Date: 2026-10-17 12:10:33
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 12:10:33
+ * @FilePath: /vlgo/gen/mailbox.go
+ * @Description: mailbox capacity and overflow policy
+ */
+package gen
+
+import (
+	"github.com/LiPengfei/vlgo/ecode"
+	"github.com/LiPengfei/vlgo/timerpool"
+	"github.com/LiPengfei/vlgo/utils"
+)
+
+const logMailbox = "Mailbox"
+
+// errNotHandled ErrActorStopped for a mail the loop never took, so sending it again is safe.
+// Same code as ErrActorStopped, compare it with errors.Is
+var errNotHandled = ecode.Wrap(ecode.ErrActorStopped, "mail not handled")
+
+// OverflowPolicy what to do when a mail arrive at a full mailbox
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota // wait for space, at most Actor.BlockTimeout if set
+	OverflowDropNewest                       // drop the arriving mail and count it, a cast never fails, a call got ErrActorMailboxFull
+	OverflowDropOldest                       // drop the oldest mail in mailbox to make room
+	OverflowReject                           // return ErrActorMailboxFull to sender, not counted as dropped
+)
+
+// Priority mailbox lane, the loop always drain higher lanes first
+type Priority int
+
+const (
+	PriorityNormal Priority = iota // Mailbox, used by Cast/Call
+	PriorityHigh                   // latency sensitive calls
+	PrioritySystem                 // control traffic, never dropped by overflow policy
+)
+
+// Dropped count of mails dropped by overflow policy
+func (s *Actor) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// MailboxSize mails waiting in all lanes
+func (s *Actor) MailboxSize() int {
+	return len(s.Mailbox) + len(s.highBox) + len(s.sysBox)
+}
+
+func (s *Actor) lane(prio Priority) chan interface{} {
+	switch prio {
+	case PrioritySystem:
+		return s.sysBox
+	case PriorityHigh:
+		return s.highBox
+	default:
+		return s.Mailbox
+	}
+}
+
+// priorMail take one mail from system or high lane without blocking
+func (s *Actor) priorMail() (interface{}, bool) {
+	select {
+	case msg := <-s.sysBox:
+		return msg, true
+	default:
+	}
+
+	select {
+	case msg := <-s.highBox:
+		return msg, true
+	default:
+	}
+	return nil, false
+}
+
+func (s *Actor) mailboxLen() int {
+	switch {
+	case s.MailboxLen <= 0:
+		return DefaultMailBoxLen
+	case s.MailboxLen > MaxMailBoxLen:
+		log.Warnf(logMailbox, logStart, "%v mailbox len %v exceed %v", s.Name, s.MailboxLen, MaxMailBoxLen)
+		return MaxMailBoxLen
+	default:
+		return s.MailboxLen
+	}
+}
+
+// post put mail into lane by Overflow policy, system lane always block
+func (s *Actor) post(lane chan interface{}, mail interface{}) ecode.VEI {
+	err := s.enqueue(lane, mail)
+	if err == nil {
+		s.wake()
+	}
+	return err
+}
+
+// postNoWait post from goroutines that must never wait on s, e.g. exit hooks running in a dying
+// actor or timing wheel callbacks: a mail not fitting at once is posted by a new goroutine, so it
+// may arrive after later ones
+func (s *Actor) postNoWait(lane chan interface{}, mail interface{}) {
+	s.postNoWaitOr(lane, mail, nil)
+}
+
+// postNoWaitOr postNoWait, lost called if the overflow policy drops or rejects the mail
+func (s *Actor) postNoWaitOr(lane chan interface{}, mail interface{}, lost func(err ecode.VEI)) {
+	if lane == nil || s.IsStopped.Load() {
+		return
+	}
+	select {
+	case lane <- mail:
+		s.wake()
+	default:
+		go func() {
+			if err := s.post(lane, mail); err != nil && lost != nil {
+				lost(err)
+			}
+		}()
+	}
+}
+
+func (s *Actor) enqueue(lane chan interface{}, mail interface{}) (err ecode.VEI) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf(logActor, logReply, "send msg %v<-%v, err: %v, stack: %s", lane, mail, r, utils.Stack())
+		}
+	}()
+
+	if lane == nil {
+		log.Errorf(logActor, logCast, "send msg %v to nil channel", mail)
+		return nil
+	}
+	if s.IsStopped.Load() {
+		log.Warnf(logActor, logCast, "%v stopped, drop %v", s.Name, mail)
+		return errNotHandled
+	}
+
+	select {
+	case lane <- mail:
+		return nil
+	default:
+	}
+
+	if lane == s.sysBox {
+		lane <- mail
+		return nil
+	}
+
+	switch s.Overflow {
+	case OverflowDropNewest:
+		s.drop(mail)
+		return nil
+
+	case OverflowReject:
+		return ecode.ErrActorMailboxFull
+
+	case OverflowDropOldest:
+		for {
+			select {
+			case old := <-lane:
+				s.drop(old)
+			default:
+			}
+
+			select {
+			case lane <- mail:
+				return nil
+			default:
+			}
+		}
+
+	default:
+		if s.BlockTimeout <= 0 {
+			lane <- mail
+			return nil
+		}
+
+		t := timerpool.GetTimer(s.BlockTimeout)
+		defer timerpool.PutTimer(t)
+		select {
+		case lane <- mail:
+			return nil
+		case <-t.C():
+			s.drop(mail)
+			return ecode.ErrActorMailboxFull
+		}
+	}
+}
+
+// drop count the mail and tell the caller at once if it is a call
+func (s *Actor) drop(mail interface{}) {
+	n := s.dropped.Inc()
+	switch mail := mail.(type) {
+	case *ActorCall:
+		log.Warnf(logMailbox, logSend, "%v mailbox full, drop call %v, dropped %v", s.Name, typeName(mail.msg), n)
+		mail.caller.SendReply(nil, ecode.ErrActorMailboxFull)
+	case *ActorCast:
+		log.Warnf(logMailbox, logSend, "%v mailbox full, drop cast %v, dropped %v", s.Name, typeName(mail.msg), n)
+		if fired, ok := mail.msg.(*timerFired); ok {
+			s.lostTimer(fired, ecode.ErrActorMailboxFull)
+		}
+	default:
+		log.Warnf(logMailbox, logSend, "%v mailbox full, drop %v, dropped %v", s.Name, typeName(mail), n)
+	}
+}
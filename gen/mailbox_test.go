@@ -0,0 +1,209 @@
+/*
+ * @Date: 2026-10-18 16:22:54
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 16:22:54
+ * @FilePath: /vlgo/gen/mailbox_test.go
+ * @Description: overflow policies of a full mailbox and priority lanes
+ */
+package gen
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+// startGated actor of mailbox len 2 handling nothing until gate closed, msg 0 is taken by the
+// loop and 1, 2 fill the mailbox
+func startGated(t *testing.T, a *Actor, name string) (gate chan struct{}, got chan interface{}) {
+	t.Helper()
+	gate, got = make(chan struct{}), make(chan interface{}, 16)
+	entered := make(chan struct{}, 1)
+	a.MailboxLen = 2
+	startFunc(t, a, name, funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		select {
+		case entered <- struct{}{}:
+		default:
+		}
+		<-gate
+		got <- msg
+		return NewGenRet(msg, nil)
+	}})
+	a.Cast(0)
+	recvMsg(t, entered, "first msg taken")
+	a.Cast(1)
+	a.Cast(2)
+	return gate, got
+}
+
+func expectHandled(t *testing.T, got chan interface{}, want ...interface{}) {
+	t.Helper()
+	for _, w := range want {
+		if msg := recvMsg(t, got, fmt.Sprint("msg ", w)); msg != w {
+			t.Fatalf("handled %v, want %v", msg, w)
+		}
+	}
+	select {
+	case msg := <-got:
+		t.Fatalf("handled %v after %v", msg, want)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  OverflowPolicy
+		block   time.Duration
+		err     ecode.VEI
+		dropped uint64
+		handled []interface{}
+	}{
+		{"drop_newest", OverflowDropNewest, 0, nil, 1, []interface{}{0, 1, 2}},
+		{"drop_oldest", OverflowDropOldest, 0, nil, 1, []interface{}{0, 2, 3}},
+		{"reject", OverflowReject, 0, ecode.ErrActorMailboxFull, 0, []interface{}{0, 1, 2}},
+		{"block_timeout", OverflowBlock, 20 * time.Millisecond, ecode.ErrActorMailboxFull, 1, []interface{}{0, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Actor{Overflow: tt.policy, BlockTimeout: tt.block}
+			gate, got := startGated(t, a, "mbt_"+tt.name)
+			if err := a.Cast(3); err != tt.err {
+				t.Fatalf("cast to full mailbox: %v, want %v", err, tt.err)
+			}
+			if a.Dropped() != tt.dropped || a.MailboxSize() != 2 {
+				t.Fatalf("dropped %v, size %v", a.Dropped(), a.MailboxSize())
+			}
+			close(gate)
+			expectHandled(t, got, tt.handled...)
+		})
+	}
+}
+
+// a call to a full mailbox fails at once, but waits its turn when the oldest is dropped
+func TestOverflowCall(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowDropNewest, OverflowReject} {
+		a := &Actor{Overflow: policy}
+		gate, _ := startGated(t, a, fmt.Sprint("mbt_call", policy))
+		begin := time.Now()
+		if _, err := a.Call("call"); err != ecode.ErrActorMailboxFull || time.Since(begin) > time.Second {
+			t.Fatalf("policy %v call: %v after %v", policy, err, time.Since(begin))
+		}
+		close(gate)
+	}
+
+	a := &Actor{Overflow: OverflowDropOldest}
+	gate, got := startGated(t, a, "mbt_call_oldest")
+	replies := make(chan interface{}, 1)
+	go func() {
+		reply, _ := a.Call("call")
+		replies <- reply
+	}()
+	waitFor(t, "oldest dropped", func() bool { return a.Dropped() == 1 })
+	close(gate)
+	expectHandled(t, got, 0, 2, "call")
+	if reply := recvMsg(t, replies, "reply"); reply != "call" {
+		t.Fatalf("reply %v", reply)
+	}
+
+	// a dropped call is answered at once, here as the oldest after 2
+	a = &Actor{Overflow: OverflowDropOldest}
+	gate, _ = startGated(t, a, "mbt_call_dropped")
+	dropped := make(chan ecode.VEI, 1)
+	go func() {
+		_, err := a.Call("first")
+		dropped <- err
+	}()
+	waitFor(t, "call queued", func() bool { return a.Dropped() == 1 })
+	a.Cast(3)
+	a.Cast(4)
+	if err := recvMsg(t, dropped, "dropped call"); err != ecode.ErrActorMailboxFull {
+		t.Fatalf("dropped call: %v", err)
+	}
+	close(gate)
+}
+
+// without BlockTimeout a sender waits for room, nothing is lost
+func TestOverflowBlock(t *testing.T) {
+	a := &Actor{}
+	gate, got := startGated(t, a, "mbt_block")
+	sent := make(chan ecode.VEI, 1)
+	go func() { sent <- a.Cast(3) }()
+	select {
+	case err := <-sent:
+		t.Fatalf("cast to a full mailbox returned %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(gate)
+	if err := recvMsg(t, sent, "blocked cast"); err != nil {
+		t.Fatal(err)
+	}
+	expectHandled(t, got, 0, 1, 2, 3)
+	if a.Dropped() != 0 {
+		t.Fatalf("dropped %v", a.Dropped())
+	}
+}
+
+// the system lane is never dropped by the overflow policy
+func TestOverflowSystemLane(t *testing.T) {
+	a := &Actor{Overflow: OverflowReject}
+	gate, got := startGated(t, a, "mbt_sys")
+	for i := 0; i < 2; i++ {
+		if err := a.CastPriority(PriorityHigh, "high"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.CastPriority(PriorityHigh, "high"); err != ecode.ErrActorMailboxFull {
+		t.Fatalf("full high lane: %v", err)
+	}
+	if err := a.CastPriority(PrioritySystem, "sys"); err != nil {
+		t.Fatalf("system lane: %v", err)
+	}
+	close(gate)
+	expectHandled(t, got, 0, "sys", "high", "high", 1, 2)
+}
+
+// higher lanes are drained first, each lane in order
+func TestPriority(t *testing.T) {
+	a := &Actor{}
+	gate, got := startGated(t, a, "mbt_prio")
+	a.CastPriority(PriorityHigh, "h1")
+	a.CastPriority(PrioritySystem, "s1")
+	replies := make(chan interface{}, 1)
+	go func() {
+		reply, _ := a.CallPriority(PriorityHigh, "call")
+		replies <- reply
+	}()
+	waitFor(t, "call queued", func() bool { return a.MailboxSize() == 5 })
+	close(gate)
+	expectHandled(t, got, 0, "s1", "h1", "call", 1, 2)
+	if reply := recvMsg(t, replies, "reply"); reply != "call" {
+		t.Fatalf("reply %v", reply)
+	}
+}
+
+// a stop does not wait behind queued mails, their callers are told the actor stopped
+func TestPriorityStop(t *testing.T) {
+	a := &Actor{}
+	gate, got := startGated(t, a, "mbt_prio_stop")
+	failed := make(chan ecode.VEI, 1)
+	go func() {
+		_, err := a.CallPriority(PriorityHigh, "call")
+		failed <- err
+	}()
+	waitFor(t, "call queued", func() bool { return a.MailboxSize() == 3 })
+	stopped := make(chan ecode.VEI, 1)
+	go func() { stopped <- a.Stop(StopReasonShutdown, time.Second) }()
+	waitFor(t, "stop queued", func() bool { return a.MailboxSize() == 4 })
+	close(gate)
+	if err := recvMsg(t, stopped, "stop"); err != nil {
+		t.Fatal(err)
+	}
+	expectHandled(t, got, 0)
+	if err := recvMsg(t, failed, "rejected call"); !errors.Is(err, ecode.ErrActorStopped) {
+		t.Fatalf("queued call: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+ * @Date: 2026-10-17 11:20:05
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 11:20:05
+ * @FilePath: /vlgo/gen/monitor.go
+ * @Description: actor monitor and link
+ */
+package gen
+
+import (
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+const logMonitor = "Monitor"
+
+// DownReason why a monitored or linked actor stopped
+type DownReason string
+
+const (
+	DownNormal   DownReason = "normal"   // handler return NewStopRet without error
+	DownError    DownReason = "error"    // handler return NewStopRet with error
+	DownPanic    DownReason = "panic"    // handler panic with StopOnPanic
+	DownShutdown DownReason = "shutdown" // stopped by supervisor
+	DownLinked   DownReason = "linked"   // stopped because a linked actor stopped abnormally
+)
+
+// ActorDown cast to watcher when the monitored actor stopped, or to a TrapExit actor when a linked actor stopped
+type ActorDown struct {
+	Name   string
+	Reason DownReason
+	Err    ecode.VEI
+	Linked bool
+}
+
+// MonitorRef used for Demonitor
+type MonitorRef struct {
+	target *Actor
+	id     uint64
+}
+
+func downReason(reason string, err ecode.VEI) DownReason {
+	switch {
+	case reason == stopReasonPanic:
+		return DownPanic
+	case reason == stopReasonShutdown:
+		return DownShutdown
+	case reason == stopReasonLinked:
+		return DownLinked
+	case err != nil:
+		return DownError
+	default:
+		return DownNormal
+	}
+}
+
+// Monitor cast *ActorDown to s once target stopped, at once if target already stopped. A full
+// mailbox of s never delays the exit of target, the down is delivered later
+func (s *Actor) Monitor(target *Actor) MonitorRef {
+	id := target.onExit(func(reason string, err ecode.VEI) {
+		s.postNoWait(s.Mailbox, &ActorCast{msg: &ActorDown{Name: target.Name, Reason: downReason(reason, err), Err: err}})
+	})
+	return MonitorRef{target: target, id: id}
+}
+
+// Demonitor cancel the monitor, ActorDown already cast is not recalled
+func (s *Actor) Demonitor(ref MonitorRef) {
+	if ref.target != nil {
+		ref.target.removeExitHook(ref.id)
+	}
+}
+
+// Link bidirectional, when one stopped abnormally the other stop too unless TrapExit
+func (s *Actor) Link(other *Actor) {
+	s.linkTo(other)
+	other.linkTo(s)
+}
+
+// Unlink remove link in both direction
+func (s *Actor) Unlink(other *Actor) {
+	s.unlinkFrom(other)
+	other.unlinkFrom(s)
+}
+
+// linkTo make s receive exit signal of other
+func (s *Actor) linkTo(other *Actor) {
+	s.exitMu.Lock()
+	if _, ok := s.links[other]; ok || s.exited {
+		s.exitMu.Unlock()
+		return
+	}
+	if s.links == nil {
+		s.links = make(map[*Actor]uint64)
+	}
+	s.links[other] = 0
+	s.exitMu.Unlock()
+
+	id := other.onExit(func(reason string, err ecode.VEI) {
+		s.exitSignal(other, reason, err)
+	})
+
+	s.exitMu.Lock()
+	if _, ok := s.links[other]; ok {
+		s.links[other] = id
+	}
+	s.exitMu.Unlock()
+}
+
+func (s *Actor) unlinkFrom(other *Actor) {
+	s.exitMu.Lock()
+	id, ok := s.links[other]
+	delete(s.links, other)
+	s.exitMu.Unlock()
+
+	if ok {
+		other.removeExitHook(id)
+	}
+}
+
+func (s *Actor) exitSignal(from *Actor, reason string, err ecode.VEI) {
+	s.exitMu.Lock()
+	delete(s.links, from)
+	s.exitMu.Unlock()
+
+	if s.IsStopped.Load() {
+		return
+	}
+
+	// run in the exiting actor, never wait on s
+	if s.TrapExit {
+		s.postNoWait(s.Mailbox, &ActorCast{msg: &ActorDown{Name: from.Name, Reason: downReason(reason, err), Err: err, Linked: true}})
+		return
+	}
+
+	if isAbnormalExit(reason, err) {
+		log.Warnf(logMonitor, logActor, "%v stop by linked %v, reason: %v, err: %v", s.Name, from.Name, reason, err)
+		s.postNoWait(s.sysBox, &actorShutdown{reason: stopReasonLinked, err: err})
+	}
+}
@@ -0,0 +1,202 @@
+/*
+ * @Date: 2026-10-18 15:42:18
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 15:42:18
+ * @FilePath: /vlgo/gen/monitor_test.go
+ * @Description: down reasons, demonitor, links, trap exit and downs to a full mailbox
+ */
+package gen
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+// startRecorder actor sending every msg it handles to the returned channel
+func startRecorder(t *testing.T, a *Actor, name string) chan interface{} {
+	t.Helper()
+	msgs := make(chan interface{}, 16)
+	startFunc(t, a, name, funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		msgs <- msg
+		return NewGenRet(nil, nil)
+	}})
+	return msgs
+}
+
+// startCrashy actor panicking on "panic", stopping on "stop" and failing on "fail"
+func startCrashy(t *testing.T, name string) *Actor {
+	t.Helper()
+	return startFunc(t, &Actor{StopOnPanic: true}, name, funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		switch msg {
+		case "panic":
+			panic("boom")
+		case "stop":
+			return NewStopRet(nil, nil)
+		case "fail":
+			return NewStopRet(nil, ecode.ErrActorStopped)
+		}
+		return NewGenRet(nil, nil)
+	}})
+}
+
+func recvDown(t *testing.T, msgs chan interface{}) *ActorDown {
+	t.Helper()
+	down, ok := recvMsg(t, msgs, "down").(*ActorDown)
+	if !ok {
+		t.Fatal("got a msg that is not a down")
+	}
+	return down
+}
+
+func TestMonitorReason(t *testing.T) {
+	w := &Actor{}
+	msgs := startRecorder(t, w, "mt_watcher")
+	tests := []struct {
+		name string
+		stop func(a *Actor)
+		want DownReason
+	}{
+		{"normal", func(a *Actor) { a.Cast("stop") }, DownNormal},
+		{"error", func(a *Actor) { a.Cast("fail") }, DownError},
+		{"panic", func(a *Actor) { a.Cast("panic") }, DownPanic},
+		{"shutdown", func(a *Actor) { a.Stop(StopReasonShutdown, 0) }, DownShutdown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := startCrashy(t, "mt_"+tt.name)
+			w.Monitor(a)
+			tt.stop(a)
+			down := recvDown(t, msgs)
+			if down.Name != "mt_"+tt.name || down.Reason != tt.want || down.Linked {
+				t.Fatalf("down %+v, want %v", down, tt.want)
+			}
+			if (down.Err != nil) != (tt.want == DownError) {
+				t.Fatalf("down err %v", down.Err)
+			}
+		})
+	}
+
+	// a target already stopped is down at once
+	a := startCrashy(t, "mt_gone")
+	a.Stop(StopReasonShutdown, 0)
+	w.Monitor(a)
+	if down := recvDown(t, msgs); down.Name != "mt_gone" {
+		t.Fatalf("down %+v", down)
+	}
+}
+
+func TestDemonitor(t *testing.T) {
+	w := &Actor{}
+	msgs := startRecorder(t, w, "mt_demon_watcher")
+	a := startCrashy(t, "mt_demon")
+	b := startCrashy(t, "mt_demon_kept")
+	w.Demonitor(w.Monitor(a))
+	w.Monitor(b)
+	a.Cast("stop")
+	b.Cast("stop")
+	if down := recvDown(t, msgs); down.Name != "mt_demon_kept" {
+		t.Fatalf("down of demonitored %v", down.Name)
+	}
+	select {
+	case msg := <-msgs:
+		t.Fatalf("got %v", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestLink(t *testing.T) {
+	// an abnormal exit stops the linked actors, a normal one does not
+	a := startCrashy(t, "mt_link_a")
+	b := startCrashy(t, "mt_link_b")
+	c := startCrashy(t, "mt_link_c")
+	a.Link(b)
+	b.Link(c)
+	a.Cast("panic")
+	for _, x := range []*Actor{b, c} {
+		select {
+		case <-x.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("%v still running after its link crashed", x.Name)
+		}
+	}
+
+	d := startCrashy(t, "mt_link_d")
+	e := startCrashy(t, "mt_link_e")
+	d.Link(e)
+	d.Cast("stop")
+	<-d.Done()
+	time.Sleep(20 * time.Millisecond)
+	if e.IsStopped.Load() {
+		t.Fatal("stopped by a normal exit of its link")
+	}
+
+	f := startCrashy(t, "mt_link_f")
+	e.Link(f)
+	e.Unlink(f)
+	f.Cast("panic")
+	<-f.Done()
+	time.Sleep(20 * time.Millisecond)
+	if e.IsStopped.Load() {
+		t.Fatal("stopped by an unlinked actor")
+	}
+}
+
+func TestLinkTrapExit(t *testing.T) {
+	w := &Actor{TrapExit: true}
+	msgs := startRecorder(t, w, "mt_trap")
+	a := startCrashy(t, "mt_trapped")
+	w.Link(a)
+	a.Cast("panic")
+	if down := recvDown(t, msgs); down.Name != "mt_trapped" || down.Reason != DownPanic || !down.Linked {
+		t.Fatalf("down %+v", down)
+	}
+	if w.IsStopped.Load() {
+		t.Fatal("trapping actor stopped")
+	}
+
+	// a trapping actor stopping abnormally still stops its links
+	b := startCrashy(t, "mt_trap_link")
+	b.Link(w)
+	w.postNoWait(w.sysBox, &actorShutdown{reason: stopReasonPanic})
+	select {
+	case <-b.Done():
+	case <-time.After(time.Second):
+		t.Fatal("link of a crashed trapping actor still running")
+	}
+}
+
+// a watcher with a full mailbox never holds the exit of its target
+func TestMonitorFullMailbox(t *testing.T) {
+	gate := make(chan struct{})
+	msgs := make(chan interface{}, 16)
+	w := startFunc(t, &Actor{MailboxLen: 1}, "mt_full", funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		if msg == "block" {
+			<-gate
+		}
+		msgs <- msg
+		return NewGenRet(nil, nil)
+	}})
+	w.Cast("block")
+	w.Cast("fill")
+
+	a := startCrashy(t, "mt_full_target")
+	w.Monitor(a)
+	a.Cast("panic")
+	select {
+	case <-a.Done():
+	case <-time.After(time.Second):
+		t.Fatal("target exit held by the full mailbox of its watcher")
+	}
+
+	close(gate)
+	for _, want := range []interface{}{"block", "fill"} {
+		if msg := recvMsg(t, msgs, "queued msg"); msg != want {
+			t.Fatalf("got %v, want %v", msg, want)
+		}
+	}
+	if down, ok := recvMsg(t, msgs, "down").(*ActorDown); !ok || down.Name != "mt_full_target" {
+		t.Fatalf("down %v", down)
+	}
+}
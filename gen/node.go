@@ -0,0 +1,615 @@
+/*
+ * @Date: 2026-10-17 19:10:05
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 19:10:05
+ * @FilePath: /vlgo/gen/node.go
+ * @Description: node layer, call and cast registered actors of other processes over tcp
+ */
+package gen
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+	"github.com/LiPengfei/vlgo/proto/pb_gen"
+	"github.com/LiPengfei/vlgo/utils/clock"
+	"go.uber.org/atomic"
+)
+
+const (
+	logNode = "Node"
+	logConn = "Conn"
+)
+
+// kind of pb_gen.NodeFrame
+const (
+	frameHello uint32 = iota + 1
+	frameCall
+	frameCast
+	frameReply
+	framePing
+)
+
+const (
+	// NodeHeartbeat ping interval, a peer silent for nodeDeadBeats heartbeats is down
+	NodeHeartbeat = time.Second
+	nodeDeadBeats = 3
+	maxFrameLen   = 16 << 20
+)
+
+// NodeDown cast to actors watching a node by MonitorNode when the connection is lost
+type NodeDown struct {
+	Node string
+}
+
+// Node one process in a cluster of nodes. Actors registered by name on a node can be reached
+// from connected nodes by RemoteRef, messages and replies must be registered by RegisterRemoteMsg
+type Node struct {
+	name string
+	ln   net.Listener
+	wt   Waiter
+
+	mu    sync.Mutex
+	peers map[string]*nodeConn
+	// conns running, peers and the ones replaced but left to the peer to close
+	conns    map[*nodeConn]struct{}
+	watchers map[string]map[*Actor]struct{}
+	closed   bool
+}
+
+// StartNode listen on addr, e.g. "127.0.0.1:0" for a random port
+func StartNode(name, addr string) (*Node, ecode.VEI) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Errorf(logNode, logStart, "%v listen %v failed: %v", name, addr, err)
+		return nil, ecode.CustomThirdPluginErr(err)
+	}
+
+	n := &Node{
+		name:     name,
+		ln:       ln,
+		wt:       NewWaiter("node_" + name),
+		peers:    make(map[string]*nodeConn),
+		conns:    make(map[*nodeConn]struct{}),
+		watchers: make(map[string]map[*Actor]struct{}),
+	}
+	n.wt.AddAndSpawnExec(logNode, n.accept)
+	log.Infof(logNode, logStart, "%v listen on %v", name, n.Addr())
+	return n, nil
+}
+
+// Name method
+func (n *Node) Name() string {
+	return n.name
+}
+
+// Addr listen address
+func (n *Node) Addr() string {
+	return n.ln.Addr().String()
+}
+
+// Connect dial the node listening on addr, return its name, with ErrNodeExists too if already
+// connected, or if addr is this node
+func (n *Node) Connect(addr string) (string, ecode.VEI) {
+	conn, err := net.DialTimeout("tcp", addr, genTimeOut)
+	if err != nil {
+		log.Errorf(logNode, logConn, "%v dial %v failed: %v", n.name, addr, err)
+		return "", ecode.CustomThirdPluginErr(err)
+	}
+
+	c := &nodeConn{node: n, conn: conn, dialed: true}
+	if verr := c.write(&pb_gen.NodeFrame{Kind: frameHello, Node: n.name}); verr != nil {
+		conn.Close()
+		return "", verr
+	}
+	peer, verr := c.readHello()
+	if verr != nil {
+		conn.Close()
+		return peer, verr
+	}
+	if verr = n.addPeer(peer, c, nil); verr != nil {
+		return peer, verr
+	}
+	return peer, nil
+}
+
+// Peers names of connected nodes
+func (n *Node) Peers() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	peers := make([]string, 0, len(n.peers))
+	for name := range n.peers {
+		peers = append(peers, name)
+	}
+	return peers
+}
+
+// Disconnect close the connection to peer, watchers got NodeDown
+func (n *Node) Disconnect(peer string) {
+	if c := n.peer(peer); c != nil {
+		c.close()
+	}
+}
+
+// MonitorNode cast *NodeDown to a when the connection to peer is lost, "" for any peer
+func (n *Node) MonitorNode(peer string, a *Actor) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.watchers[peer] == nil {
+		n.watchers[peer] = make(map[*Actor]struct{})
+	}
+	n.watchers[peer][a] = struct{}{}
+}
+
+// DemonitorNode undo MonitorNode
+func (n *Node) DemonitorNode(peer string, a *Actor) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.watchers[peer], a)
+}
+
+// Remote reference to actor registered as name on node peer, peer can be this node
+func (n *Node) Remote(peer, name string) RemoteRef {
+	return RemoteRef{node: n, peer: peer, name: name}
+}
+
+// Stop close the listener and all connections
+func (n *Node) Stop() {
+	n.mu.Lock()
+	n.closed = true
+	conns := make([]*nodeConn, 0, len(n.conns))
+	for c := range n.conns {
+		conns = append(conns, c)
+	}
+	n.mu.Unlock()
+
+	n.ln.Close()
+	for _, c := range conns {
+		c.close()
+	}
+	n.wt.Wait(WaitReason("stop node " + n.name))
+	DelWaiter(n.wt.Key)
+}
+
+func (n *Node) accept() {
+	for {
+		conn, err := n.ln.Accept()
+		if err != nil {
+			n.mu.Lock()
+			closed := n.closed
+			n.mu.Unlock()
+			if !closed {
+				log.Errorf(logNode, logConn, "%v accept failed: %v", n.name, err)
+			}
+			return
+		}
+
+		n.wt.AddAndSpawnExec(logConn, func() {
+			c := &nodeConn{node: n, conn: conn}
+			peer, verr := c.readHello()
+			if verr != nil {
+				conn.Close()
+			} else {
+				verr = n.addPeer(peer, c, &pb_gen.NodeFrame{Kind: frameHello, Node: n.name})
+			}
+			if verr != nil && verr != ecode.ErrNodeExists {
+				log.Errorf(logNode, logConn, "%v handshake with %v failed: %v", n.name, conn.RemoteAddr(), verr)
+			}
+		})
+	}
+}
+
+// addPeer keep one connection per peer, c is closed if not kept. hello is the reply of an accepted
+// c, sent once c is kept, or with the error if not. When two nodes dial each other at once both keep
+// the one dialed by the smaller name. The other one, if already in use, is not closed by the bigger
+// name but left running until the smaller closes it, so neither side sees NodeDown
+func (n *Node) addPeer(peer string, c *nodeConn, hello *pb_gen.NodeFrame) ecode.VEI {
+	if hello != nil {
+		// nothing is written to c before the hello once it is a peer
+		c.wmu.Lock()
+	}
+	n.mu.Lock()
+	old, ok := n.peers[peer]
+	var err ecode.VEI
+	switch {
+	case n.closed:
+		err = ecode.ErrNodeDown
+	case peer == n.name || ok && c.dialed == old.dialed:
+		err = ecode.ErrNodeExists
+	case ok && old.preferred(peer) && hello != nil:
+		// the dialer learns it from the hello and never uses c
+		err = ecode.ErrNodeExists
+	}
+	if err != nil {
+		n.mu.Unlock()
+		if hello != nil {
+			hello.Err = ecode.ErrInfo(err)
+			c.writeLocked(hello)
+			c.wmu.Unlock()
+		}
+		c.conn.Close()
+		return err
+	}
+
+	c.peer = peer
+	c.pending = make(map[uint64]chan *pb_gen.NodeFrame)
+	c.done = make(chan struct{})
+	n.conns[c] = struct{}{}
+	kept := !ok || c.preferred(peer)
+	if kept {
+		n.peers[peer] = c
+	}
+	n.mu.Unlock()
+
+	if hello != nil {
+		err = c.writeLocked(hello)
+		c.wmu.Unlock()
+		if err != nil {
+			c.close()
+			return err
+		}
+	}
+	n.wt.AddAndSpawnExec(logConn, c.readLoop)
+	n.wt.AddAndSpawnExec(logConn, c.heartbeat)
+	if !kept {
+		// dialed by the bigger name while the smaller dialed too, it closes this one
+		return ecode.ErrNodeExists
+	}
+	if ok && c.dialed {
+		log.Infof(logNode, logConn, "%v close connection to %v dialed at the same time", n.name, peer)
+		old.close()
+	}
+	log.Infof(logNode, logConn, "%v connected to %v %v", n.name, peer, c.conn.RemoteAddr())
+	return nil
+}
+
+func (n *Node) peer(name string) *nodeConn {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.peers[name]
+}
+
+// removePeer called once a connection closed, notify watchers unless it was replaced by addPeer
+func (n *Node) removePeer(c *nodeConn) {
+	n.mu.Lock()
+	delete(n.conns, c)
+	if n.peers[c.peer] != c {
+		n.mu.Unlock()
+		return
+	}
+	delete(n.peers, c.peer)
+	var watchers []*Actor
+	for _, key := range []string{c.peer, ""} {
+		for a := range n.watchers[key] {
+			if a.IsStopped != nil && a.IsStopped.Load() {
+				delete(n.watchers[key], a)
+				continue
+			}
+			watchers = append(watchers, a)
+		}
+	}
+	n.mu.Unlock()
+
+	log.Warnf(logNode, logConn, "%v lost %v", n.name, c.peer)
+	// reached from read loops, heartbeats and Disconnect, a full watcher mailbox must not hold them
+	for _, a := range watchers {
+		a.postNoWait(a.Mailbox, &ActorCast{msg: &NodeDown{Node: c.peer}})
+	}
+}
+
+// handleCall call the local actor out of the read loop and reply
+func (n *Node) handleCall(c *nodeConn, f *pb_gen.NodeFrame) {
+	reply := &pb_gen.NodeFrame{Kind: frameReply, Seq: f.Seq}
+	ret, err := n.callLocal(f)
+	if err == nil {
+		reply.MsgType, reply.Payload, err = encodeRemoteMsg(ret)
+	}
+	reply.Err = ecode.ErrInfo(err)
+	c.write(reply)
+}
+
+func (n *Node) callLocal(f *pb_gen.NodeFrame) (interface{}, ecode.VEI) {
+	a, ok := WhereIs(f.To)
+	if !ok {
+		return nil, ecode.ErrActorNotFound
+	}
+	msg, err := decodeRemoteMsg(f.MsgType, f.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := time.Duration(f.TimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = genTimeOut
+	}
+	return a.TimeCall(msg, timeout)
+}
+
+func (n *Node) handleCast(f *pb_gen.NodeFrame) {
+	a, ok := WhereIs(f.To)
+	if !ok {
+		log.Warnf(logNode, logCast, "%v cast %v to unknown %v", n.name, f.MsgType, f.To)
+		return
+	}
+	msg, err := decodeRemoteMsg(f.MsgType, f.Payload)
+	if err != nil {
+		log.Errorf(logNode, logCast, "%v cast %v to %v: %v", n.name, f.MsgType, f.To, err)
+		return
+	}
+	// called in the read loop, a full mailbox must not stall the replies and pings behind
+	a.postNoWait(a.Mailbox, &ActorCast{msg: msg})
+}
+
+// nodeConn one connection to a peer node
+type nodeConn struct {
+	node *Node
+	peer string
+	conn net.Conn
+	// dialed by this node, accepted otherwise
+	dialed bool
+
+	wmu sync.Mutex
+	seq atomic.Uint64
+
+	pmu     sync.Mutex
+	pending map[uint64]chan *pb_gen.NodeFrame
+
+	done chan struct{}
+	once sync.Once
+}
+
+// preferred dialed by the smaller of this node and peer
+func (c *nodeConn) preferred(peer string) bool {
+	return c.dialed == (c.node.name < peer)
+}
+
+func (c *nodeConn) readHello() (string, ecode.VEI) {
+	c.conn.SetReadDeadline(time.Now().Add(genTimeOut))
+	f, err := c.read()
+	if err != nil {
+		return "", ecode.CustomThirdPluginErr(err)
+	}
+	if f.Kind != frameHello || f.Node == "" {
+		return "", ecode.ErrActorMsgType
+	}
+	if f.Err != nil {
+		return f.Node, ecode.ErrInfo2VEI(f.Err)
+	}
+	return f.Node, nil
+}
+
+func (c *nodeConn) readLoop() {
+	defer c.close()
+
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(NodeHeartbeat * nodeDeadBeats))
+		f, err := c.read()
+		if err != nil {
+			select {
+			case <-c.done:
+			default:
+				log.Warnf(logNode, logConn, "%v read from %v: %v", c.node.name, c.peer, err)
+			}
+			return
+		}
+
+		switch f.Kind {
+		case frameCall:
+			go c.node.handleCall(c, f)
+		case frameCast:
+			c.node.handleCast(f)
+		case frameReply:
+			c.pmu.Lock()
+			ch := c.pending[f.Seq]
+			delete(c.pending, f.Seq)
+			c.pmu.Unlock()
+			if ch != nil {
+				ch <- f
+			}
+		case framePing:
+		default:
+			log.Errorf(logNode, logConn, "%v unexpected frame %v from %v", c.node.name, f.Kind, c.peer)
+		}
+	}
+}
+
+func (c *nodeConn) heartbeat() {
+	ticker := time.NewTicker(NodeHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.write(&pb_gen.NodeFrame{Kind: framePing}); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+// call send f and wait the reply until ctx done or connection lost
+func (c *nodeConn) call(ctx context.Context, f *pb_gen.NodeFrame) (*pb_gen.NodeFrame, ecode.VEI) {
+	f.Seq = c.seq.Inc()
+	ch := make(chan *pb_gen.NodeFrame, 1)
+	c.pmu.Lock()
+	c.pending[f.Seq] = ch
+	c.pmu.Unlock()
+	defer func() {
+		c.pmu.Lock()
+		delete(c.pending, f.Seq)
+		c.pmu.Unlock()
+	}()
+
+	if err := c.write(f); err != nil {
+		return nil, err
+	}
+
+	select {
+	case reply := <-ch:
+		return reply, nil
+	case <-c.done:
+		return nil, ecode.ErrNodeDown
+	case <-ctx.Done():
+		return nil, ctxErr(ctx, ecode.ErrActorCallTimeout)
+	}
+}
+
+func (c *nodeConn) write(f *pb_gen.NodeFrame) ecode.VEI {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.writeLocked(f)
+}
+
+// writeLocked write with wmu held
+func (c *nodeConn) writeLocked(f *pb_gen.NodeFrame) ecode.VEI {
+	body, err := f.Marshal()
+	if err != nil {
+		return ecode.CustomThirdPluginErr(err)
+	}
+	buf := make([]byte, 4+len(body))
+	binary.BigEndian.PutUint32(buf, uint32(len(body)))
+	copy(buf[4:], body)
+
+	c.conn.SetWriteDeadline(time.Now().Add(genTimeOut))
+	if _, err := c.conn.Write(buf); err != nil {
+		log.Warnf(logNode, logConn, "%v write to %v: %v", c.node.name, c.peer, err)
+		return ecode.ErrNodeDown
+	}
+	return nil
+}
+
+func (c *nodeConn) read() (*pb_gen.NodeFrame, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(c.conn, head[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(head[:])
+	if size > maxFrameLen {
+		return nil, io.ErrShortBuffer
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(c.conn, body); err != nil {
+		return nil, err
+	}
+	f := &pb_gen.NodeFrame{}
+	if err := f.Unmarshal(body); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (c *nodeConn) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.conn.Close()
+		c.node.removePeer(c)
+	})
+}
+
+// RemoteRef address of an actor registered on a node, Call and Cast like a local Actor
+type RemoteRef struct {
+	node *Node
+	peer string
+	name string
+}
+
+// Node name of the node the actor lives on
+func (r RemoteRef) Node() string {
+	return r.peer
+}
+
+// Name registered name of the actor
+func (r RemoteRef) Name() string {
+	return r.name
+}
+
+// Cast method, ErrNodeDown if not connected
+func (r RemoteRef) Cast(msg interface{}) ecode.VEI {
+	if r.peer == r.node.name {
+		return CastByName(r.name, msg)
+	}
+
+	c := r.node.peer(r.peer)
+	if c == nil {
+		return ecode.ErrNodeDown
+	}
+	msgType, payload, err := encodeRemoteMsg(msg)
+	if err != nil {
+		return err
+	}
+	return c.write(&pb_gen.NodeFrame{Kind: frameCast, To: r.name, MsgType: msgType, Payload: payload})
+}
+
+// Call method
+func (r RemoteRef) Call(msg interface{}) (interface{}, ecode.VEI) {
+	return r.CallCtx(context.Background(), msg)
+}
+
+// TimeCall method
+func (r RemoteRef) TimeCall(msg interface{}, overDuration time.Duration) (interface{}, ecode.VEI) {
+	ctx, cancel := clock.WithTimeout(context.Background(), overDuration)
+	defer cancel()
+	return r.CallCtx(ctx, msg)
+}
+
+// CallCtx call with ctx deadline, genTimeOut if no deadline. Timeout on either node is ErrActorCallTimeout
+func (r RemoteRef) CallCtx(ctx context.Context, msg interface{}) (interface{}, ecode.VEI) {
+	if r.peer == r.node.name {
+		a, ok := WhereIs(r.name)
+		if !ok {
+			return nil, ecode.ErrActorNotFound
+		}
+		return a.CallCtx(ctx, msg)
+	}
+
+	c := r.node.peer(r.peer)
+	if c == nil {
+		return nil, ecode.ErrNodeDown
+	}
+	msgType, payload, err := encodeRemoteMsg(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = clock.WithTimeout(ctx, genTimeOut)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+	left := clock.Until(deadline).Milliseconds()
+	if left <= 0 {
+		return nil, ecode.ErrActorCallTimeout
+	}
+
+	reply, err := c.call(ctx, &pb_gen.NodeFrame{
+		Kind:      frameCall,
+		To:        r.name,
+		MsgType:   msgType,
+		Payload:   payload,
+		TimeoutMs: left,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reply.Err != nil {
+		if err = ecode.ErrInfo2VEI(reply.Err); err == ecode.ErrActorHandleTimeout {
+			// whichever side noticed the deadline first, caller see one timeout error
+			err = ecode.ErrActorCallTimeout
+		}
+		return nil, err
+	}
+	return decodeRemoteMsg(reply.MsgType, reply.Payload)
+}
@@ -0,0 +1,339 @@
+/*
+ * @Date: 2026-10-18 10:20:41
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 10:20:41
+ * @FilePath: /vlgo/gen/node_test.go
+ * @Description: several nodes on localhost, remote casts, calls and node monitors
+ */
+package gen
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+	"github.com/LiPengfei/vlgo/proto/pb_gen"
+)
+
+// nodeTestH answer *pb_gen.People by greeting it, forward those with Id "cast" to casts and
+// block on Id "block" until gate closed
+type nodeTestH struct {
+	casts chan *pb_gen.People
+	gate  chan struct{}
+}
+
+func (h nodeTestH) Init(ctx ActorCtx, msg, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func (h nodeTestH) Handle(ctx ActorCtx, msg interface{}, state interface{}) ActorRet {
+	p, ok := msg.(*pb_gen.People)
+	if !ok {
+		return NewGenRet(msg, nil)
+	}
+	switch p.Id {
+	case "slow":
+		time.Sleep(200 * time.Millisecond)
+	case "block":
+		<-h.gate
+	case "cast":
+		h.casts <- p
+	}
+	return NewGenRet(&pb_gen.People{Id: p.Id, Name: "hi " + p.Name}, nil)
+}
+
+func (h nodeTestH) Stop(ctx ActorCtx, msg interface{}, state interface{}) {}
+
+func (h nodeTestH) Tick(ctx ActorCtx, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func (h nodeTestH) Timeout(ctx ActorCtx, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func startTestNodes(t *testing.T, names ...string) []*Node {
+	t.Helper()
+	RegisterRemoteMsg(&pb_gen.People{})
+
+	nodes := make([]*Node, 0, len(names))
+	for _, name := range names {
+		n, err := StartNode(name, "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("start node %v: %v", name, err)
+		}
+		t.Cleanup(n.Stop)
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+func startTestActor(t *testing.T, name string, h nodeTestH, mailboxLen int) *Actor {
+	t.Helper()
+	a := &Actor{MailboxLen: mailboxLen}
+	if _, err := a.Start(Ctx(name), nil, nil, h); err != nil {
+		t.Fatalf("start %v: %v", name, err)
+	}
+	t.Cleanup(func() { a.Stop(StopReasonShutdown, 0) })
+	return a
+}
+
+func waitPeers(t *testing.T, n *Node, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for len(n.Peers()) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("node %v peers %v, want %v", n.Name(), n.Peers(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNodeConnect(t *testing.T) {
+	nodes := startTestNodes(t, "ntc_a", "ntc_b", "ntc_c")
+	a, b, c := nodes[0], nodes[1], nodes[2]
+
+	for _, n := range []*Node{b, c} {
+		peer, err := n.Connect(a.Addr())
+		if err != nil || peer != a.Name() {
+			t.Fatalf("%v connect: %v %v", n.Name(), peer, err)
+		}
+	}
+	if peer, err := b.Connect(a.Addr()); err != ecode.ErrNodeExists || peer != a.Name() {
+		t.Fatalf("connect twice: %v %v", peer, err)
+	}
+	if peer, err := a.Connect(a.Addr()); err != ecode.ErrNodeExists || peer != a.Name() {
+		t.Fatalf("connect self: %v %v", peer, err)
+	}
+	if _, err := b.Connect(c.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	waitPeers(t, a, 2)
+	waitPeers(t, b, 2)
+	waitPeers(t, c, 2)
+
+	b.Disconnect(a.Name())
+	waitPeers(t, a, 1)
+	waitPeers(t, b, 1)
+}
+
+// nodes dialing each other at once keep the same single connection
+func TestNodeConnectEachOther(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		nodes := startTestNodes(t, fmt.Sprintf("nte_a%v", i), fmt.Sprintf("nte_b%v", i))
+		a, b := nodes[0], nodes[1]
+		downs := make(chan interface{}, 4)
+		w := &Actor{}
+		if _, err := w.Start(Ctx(fmt.Sprintf("nte_watch%v", i)), nil, downs, nodeDownRecorder{}); err != nil {
+			t.Fatal(err)
+		}
+		a.MonitorNode("", w)
+		b.MonitorNode("", w)
+
+		var wg sync.WaitGroup
+		for _, pair := range [][2]*Node{{a, b}, {b, a}} {
+			wg.Add(1)
+			go func(from, to *Node) {
+				defer wg.Done()
+				if _, err := from.Connect(to.Addr()); err != nil && err != ecode.ErrNodeExists {
+					t.Errorf("%v connect %v: %v", from.Name(), to.Name(), err)
+				}
+			}(pair[0], pair[1])
+		}
+		wg.Wait()
+
+		waitPeers(t, a, 1)
+		waitPeers(t, b, 1)
+		ca, cb := a.peer(b.Name()), b.peer(a.Name())
+		if ca == nil || cb == nil || !ca.dialed || cb.dialed {
+			t.Fatalf("round %v: kept %+v %+v, want the one dialed by %v", i, ca, cb, a.Name())
+		}
+		select {
+		case d := <-downs:
+			t.Fatalf("round %v: down on replaced connection %v", i, d)
+		case <-time.After(10 * time.Millisecond):
+		}
+		w.Stop(StopReasonShutdown, 0)
+	}
+}
+
+func TestNodeRemoteCallCast(t *testing.T) {
+	nodes := startTestNodes(t, "ntr_a", "ntr_b", "ntr_c")
+	a, b, c := nodes[0], nodes[1], nodes[2]
+	for _, n := range []*Node{b, c} {
+		if _, err := n.Connect(a.Addr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	casts := make(chan *pb_gen.People, 4)
+	startTestActor(t, "ntr_echo", nodeTestH{casts: casts}, 0)
+
+	tests := []struct {
+		name string
+		from *Node
+		to   string
+		msg  interface{}
+		tm   time.Duration
+		want string
+		err  ecode.VEI
+	}{
+		{"call", b, "ntr_echo", &pb_gen.People{Id: "1", Name: "bob"}, 0, "hi bob", nil},
+		{"call from other node", c, "ntr_echo", &pb_gen.People{Id: "2", Name: "amy"}, 0, "hi amy", nil},
+		{"timeout", b, "ntr_echo", &pb_gen.People{Id: "slow"}, 50 * time.Millisecond, "", ecode.ErrActorCallTimeout},
+		{"unknown actor", b, "ntr_nobody", &pb_gen.People{}, 0, "", ecode.ErrActorNotFound},
+		{"not a remote msg", b, "ntr_echo", 1, 0, "", ecode.ErrActorMsgType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := tt.from.Remote(a.Name(), tt.to)
+			var reply interface{}
+			var err ecode.VEI
+			if tt.tm > 0 {
+				reply, err = ref.TimeCall(tt.msg, tt.tm)
+			} else {
+				reply, err = ref.Call(tt.msg)
+			}
+			if err != tt.err {
+				t.Fatalf("err %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && reply.(*pb_gen.People).Name != tt.want {
+				t.Fatalf("reply %v, want %v", reply, tt.want)
+			}
+		})
+	}
+	if err := b.Remote(a.Name(), "ntr_echo").Cast(&pb_gen.People{Id: "cast", Name: "tom"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-casts:
+		if p.Id != "cast" || p.Name != "tom" {
+			t.Fatalf("cast got %v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cast not delivered")
+	}
+
+	if _, err := b.Remote("ntr_unknown", "ntr_echo").Call(&pb_gen.People{}); err != ecode.ErrNodeDown {
+		t.Fatalf("unknown node: %v", err)
+	}
+}
+
+// a cast to a full mailbox must not stall the connection it came from
+func TestNodeCastFullMailbox(t *testing.T) {
+	nodes := startTestNodes(t, "ntf_a", "ntf_b")
+	a, b := nodes[0], nodes[1]
+	if _, err := b.Connect(a.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	gate := make(chan struct{})
+	defer close(gate)
+	startTestActor(t, "ntf_slow", nodeTestH{gate: gate}, 1)
+	startTestActor(t, "ntf_echo", nodeTestH{}, 0)
+
+	slow := b.Remote(a.Name(), "ntf_slow")
+	for i := 0; i < 8; i++ {
+		if err := slow.Cast(&pb_gen.People{Id: "block"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reply, err := b.Remote(a.Name(), "ntf_echo").TimeCall(&pb_gen.People{Name: "bob"}, time.Second)
+	if err != nil || reply.(*pb_gen.People).Name != "hi bob" {
+		t.Fatalf("call behind full mailbox: %v %v", reply, err)
+	}
+}
+
+func TestNodeMonitor(t *testing.T) {
+	nodes := startTestNodes(t, "ntm_a", "ntm_b", "ntm_c")
+	a, b, c := nodes[0], nodes[1], nodes[2]
+	for _, n := range []*Node{b, c} {
+		if _, err := n.Connect(a.Addr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	downs := make(chan interface{}, 4)
+	w := &Actor{}
+	if _, err := w.Start(Ctx("ntm_watch"), nil, downs, nodeDownRecorder{}); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop(StopReasonShutdown, 0)
+
+	b.MonitorNode(a.Name(), w)
+	c.MonitorNode(a.Name(), w)
+	c.DemonitorNode(a.Name(), w)
+	a.Stop()
+
+	select {
+	case d := <-downs:
+		if d.(*NodeDown).Node != a.Name() {
+			t.Fatalf("down %v", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no node down")
+	}
+	select {
+	case d := <-downs:
+		t.Fatalf("demonitored node down delivered: %v", d)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, err := b.Remote(a.Name(), "ntm_watch").Call(&pb_gen.People{}); err != ecode.ErrNodeDown {
+		t.Fatalf("call stopped node: %v", err)
+	}
+}
+
+type nodeDownRecorder struct{}
+
+func (nodeDownRecorder) Init(ctx ActorCtx, msg, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func (nodeDownRecorder) Handle(ctx ActorCtx, msg interface{}, state interface{}) ActorRet {
+	if d, ok := msg.(*NodeDown); ok {
+		state.(chan interface{}) <- d
+	}
+	return NewGenRet(nil, nil)
+}
+
+func (nodeDownRecorder) Stop(ctx ActorCtx, msg interface{}, state interface{}) {}
+
+func (nodeDownRecorder) Tick(ctx ActorCtx, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func (nodeDownRecorder) Timeout(ctx ActorCtx, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+// a watcher disconnecting in its own handler with a full mailbox, as the cluster actor does
+func TestNodeDisconnectFromWatcher(t *testing.T) {
+	nodes := startTestNodes(t, "ntd_a", "ntd_b")
+	a, b := nodes[0], nodes[1]
+	if _, err := b.Connect(a.Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	dropped := make(chan struct{})
+	downs := make(chan interface{}, 1)
+	w := startFunc(t, &Actor{MailboxLen: 1}, "ntd_watch", funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		switch msg := msg.(type) {
+		case string:
+			if msg == "drop" {
+				ctx.Self().Cast("fill")
+				b.Disconnect(a.Name())
+				close(dropped)
+			}
+		case *NodeDown:
+			downs <- msg
+		}
+		return NewGenRet(nil, nil)
+	}})
+	b.MonitorNode(a.Name(), w)
+
+	w.Cast("drop")
+	recvMsg(t, dropped, "disconnect return")
+	if d := recvMsg(t, downs, "node down"); d.(*NodeDown).Node != a.Name() {
+		t.Fatalf("down %v", d)
+	}
+}
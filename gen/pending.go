@@ -0,0 +1,121 @@
+/*
+ * @Date: 2026-10-17 13:05:47
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 13:05:47
+ * @FilePath: /vlgo/gen/pending.go
+ * @Description: track callers waiting for reply
+ */
+package gen
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+	"github.com/LiPengfei/vlgo/utils/clock"
+)
+
+const logPending = "Pending"
+
+// pendingSweepLen sweep callers already gave up when pending table reach this size
+const pendingSweepLen = 1024
+
+type pendingCall struct {
+	ch    chan ActorRet
+	msg   string
+	ctx   context.Context
+	since time.Time
+}
+
+// PendingCall a caller still waiting for reply, used for debug
+type PendingCall struct {
+	Token   uint64
+	Msg     string
+	Since   time.Time
+	Expired bool // caller ctx done, it will never get the reply
+}
+
+// addPending track the call until replied, return the caller with reply token
+func (s *Actor) addPending(call *ActorCall) ActorCaller {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	if s.pending == nil {
+		s.pending = make(map[uint64]*pendingCall)
+	}
+	if len(s.pending) >= pendingSweepLen {
+		s.sweepPending()
+	}
+
+	s.replySeq++
+	s.pending[s.replySeq] = &pendingCall{ch: call.caller.ch, msg: typeName(call.msg), ctx: call.ctx, since: clock.Now()}
+	return ActorCaller{ch: call.caller.ch, token: s.replySeq, owner: s}
+}
+
+// donePending remove token, false if replied already or actor stopped
+func (s *Actor) donePending(token uint64, v ActorRet) bool {
+	s.pendingMu.Lock()
+	p, ok := s.pending[token]
+	delete(s.pending, token)
+	s.pendingMu.Unlock()
+
+	if !ok {
+		log.Warnf(logPending, logReply, "%v duplicate or late reply, token %v, ret %v, err %v", s.Name, token, v.ret(), v.err())
+		return false
+	}
+	if p.ctx != nil && p.ctx.Err() != nil {
+		log.Warnf(logPending, logReply, "%v reply %v after caller gone, waited %v", s.Name, p.msg, clock.Since(p.since))
+	}
+	return true
+}
+
+// sweepPending drop callers already gave up, must hold pendingMu
+func (s *Actor) sweepPending() {
+	for token, p := range s.pending {
+		if p.ctx != nil && p.ctx.Err() != nil {
+			log.Warnf(logPending, logReply, "%v never replied %v, caller gone after %v", s.Name, p.msg, clock.Since(p.since))
+			delete(s.pending, token)
+		}
+	}
+}
+
+// rejectPending reply err to all callers still waiting
+func (s *Actor) rejectPending(err ecode.VEI) {
+	s.pendingMu.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.pendingMu.Unlock()
+
+	for _, p := range pending {
+		log.Warnf(logPending, logReply, "%v reject pending %v with %v", s.Name, p.msg, err)
+		safeSendRet(p.ch, NewGenRet(nil, err))
+	}
+}
+
+// PendingCalls callers still waiting for reply, order by token
+func (s *Actor) PendingCalls() []PendingCall {
+	s.pendingMu.Lock()
+	ret := make([]PendingCall, 0, len(s.pending))
+	for token, p := range s.pending {
+		ret = append(ret, PendingCall{
+			Token:   token,
+			Msg:     p.msg,
+			Since:   p.since,
+			Expired: p.ctx != nil && p.ctx.Err() != nil,
+		})
+	}
+	s.pendingMu.Unlock()
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Token < ret[j].Token })
+	return ret
+}
+
+// DumpPending log callers still waiting for reply
+func (s *Actor) DumpPending() {
+	calls := s.PendingCalls()
+	log.Infof(logPending, logActor, "%v has %v pending calls", s.Name, len(calls))
+	for _, c := range calls {
+		log.Infof(logPending, logActor, "%v token %v msg %v waited %v expired %v", s.Name, c.Token, c.Msg, clock.Since(c.Since), c.Expired)
+	}
+}
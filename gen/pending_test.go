@@ -0,0 +1,120 @@
+/*
+ * @Date: 2026-10-18 17:02:31
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 17:02:31
+ * @FilePath: /vlgo/gen/pending_test.go
+ * @Description: deferred replies, duplicate replies, pending table and rejection on stop
+ */
+package gen
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+// startDeferred actor holding callers of "later" until "flush", which replies each of them twice
+func startDeferred(t *testing.T, name string) *Actor {
+	t.Helper()
+	var held []ActorCaller
+	return startFunc(t, &Actor{}, name, funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		switch msg {
+		case "later":
+			held = append(held, ctx.Caller())
+			return NewGenRet(CallNoRep, nil)
+		case "flush":
+			for _, c := range held {
+				c.SendReply("done", nil)
+				c.SendReply("again", nil)
+			}
+			held = nil
+		case "early":
+			ctx.Caller().SendReply("early", nil)
+		}
+		return NewGenRet(msg, nil)
+	}})
+}
+
+func callLater(a *Actor, ctx context.Context) chan interface{} {
+	replies := make(chan interface{}, 2)
+	go func() {
+		reply, err := a.CallCtx(ctx, "later")
+		if err != nil {
+			replies <- err
+			return
+		}
+		replies <- reply
+	}()
+	return replies
+}
+
+func TestDeferredReply(t *testing.T) {
+	a := startDeferred(t, "pt_deferred")
+	first := callLater(a, context.Background())
+	second := callLater(a, context.Background())
+	waitFor(t, "calls pending", func() bool { return len(a.PendingCalls()) == 2 })
+
+	calls := a.PendingCalls()
+	if calls[0].Token >= calls[1].Token || calls[0].Msg != "string" || calls[0].Expired {
+		t.Fatalf("pending %+v", calls)
+	}
+	a.DumpPending()
+
+	// a second reply to the same caller is dropped
+	a.Cast("flush")
+	for _, replies := range []chan interface{}{first, second} {
+		if reply := recvMsg(t, replies, "deferred reply"); reply != "done" {
+			t.Fatalf("deferred reply %v", reply)
+		}
+	}
+	waitFor(t, "pending replied", func() bool { return len(a.PendingCalls()) == 0 })
+	select {
+	case reply := <-first:
+		t.Fatalf("second reply %v delivered", reply)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// a reply sent in the handler wins over the one returned
+	if reply, err := a.Call("early"); reply != "early" || err != nil {
+		t.Fatalf("early reply: %v %v", reply, err)
+	}
+	if reply, err := a.Call("plain"); reply != "plain" || err != nil {
+		t.Fatalf("plain reply: %v %v", reply, err)
+	}
+}
+
+func TestPendingExpired(t *testing.T) {
+	a := startDeferred(t, "pt_expired")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	replies := callLater(a, ctx)
+	if err := recvMsg(t, replies, "timeout"); err != ecode.ErrActorHandleTimeout {
+		t.Fatalf("call: %v", err)
+	}
+	if calls := a.PendingCalls(); len(calls) != 1 || !calls[0].Expired {
+		t.Fatalf("pending %+v", calls)
+	}
+	// a late reply is only logged
+	a.Cast("flush")
+	waitFor(t, "late reply", func() bool { return len(a.PendingCalls()) == 0 })
+}
+
+func TestPendingRejectOnStop(t *testing.T) {
+	a := startDeferred(t, "pt_stop")
+	replies := callLater(a, context.Background())
+	waitFor(t, "call pending", func() bool { return len(a.PendingCalls()) == 1 })
+	begin := time.Now()
+	a.Stop(StopReasonShutdown, 0)
+	if err, _ := recvMsg(t, replies, "rejected call").(ecode.VEI); !errors.Is(err, ecode.ErrActorStopped) {
+		t.Fatalf("pending call: %v", err)
+	}
+	if waited := time.Since(begin); waited > time.Second {
+		t.Fatalf("caller waited %v", waited)
+	}
+	if calls := a.PendingCalls(); len(calls) != 0 {
+		t.Fatalf("pending after stop %+v", calls)
+	}
+}
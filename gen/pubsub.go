@@ -0,0 +1,245 @@
+/*
+ * @Date: 2026-10-17 16:20:03
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 16:20:03
+ * @FilePath: /vlgo/gen/pubsub.go
+ * @Description: topic based publish subscribe between actors
+ */
+package gen
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+const (
+	logPubSub = "PubSub"
+	logPub    = "Publish"
+)
+
+// topic segments are separated by '.', in patterns '*' match one segment and '#' as the last segment
+// match zero or more, e.g. "player.*.login", "config.#"
+const (
+	topicSep       = "."
+	topicWildOne   = "*"
+	topicWildTrail = "#"
+)
+
+// TopicMsg cast to subscribers for each published message
+type TopicMsg struct {
+	Topic string
+	Msg   interface{}
+}
+
+type topicSub struct {
+	hook   uint64
+	topics map[string]struct{}
+}
+
+type topicPattern struct {
+	segs []string
+	subs map[*Actor]struct{}
+}
+
+// PubSub topics to subscriber actors, subscriptions of an actor removed when it stops
+type PubSub struct {
+	mu       sync.RWMutex
+	exact    map[string]map[*Actor]struct{}
+	patterns map[string]*topicPattern
+	subs     map[*Actor]*topicSub
+}
+
+// defaultBus used by package level Subscribe/Unsubscribe/Publish
+var defaultBus = NewPubSub()
+
+// NewPubSub create a bus isolated from the default one
+func NewPubSub() *PubSub {
+	return &PubSub{
+		exact:    make(map[string]map[*Actor]struct{}),
+		patterns: make(map[string]*topicPattern),
+		subs:     make(map[*Actor]*topicSub),
+	}
+}
+
+// Subscribe a receive *TopicMsg for topics matching pattern on the default bus
+func Subscribe(a *Actor, pattern string) {
+	defaultBus.Subscribe(a, pattern)
+}
+
+// Unsubscribe remove one subscription on the default bus
+func Unsubscribe(a *Actor, pattern string) {
+	defaultBus.Unsubscribe(a, pattern)
+}
+
+// Publish cast msg to subscribers of topic on the default bus without waiting, return their number
+func Publish(topic string, msg interface{}) int {
+	return defaultBus.Publish(topic, msg)
+}
+
+// Subscribe a receive *TopicMsg for topics matching pattern, subscribe twice is the same as once
+func (ps *PubSub) Subscribe(a *Actor, pattern string) {
+	ps.mu.Lock()
+	sub, ok := ps.subs[a]
+	if !ok {
+		sub = &topicSub{topics: make(map[string]struct{})}
+		ps.subs[a] = sub
+	}
+	sub.topics[pattern] = struct{}{}
+
+	if isTopicPattern(pattern) {
+		p := ps.patterns[pattern]
+		if p == nil {
+			p = &topicPattern{segs: strings.Split(pattern, topicSep), subs: make(map[*Actor]struct{})}
+			ps.patterns[pattern] = p
+		}
+		p.subs[a] = struct{}{}
+	} else {
+		if ps.exact[pattern] == nil {
+			ps.exact[pattern] = make(map[*Actor]struct{})
+		}
+		ps.exact[pattern][a] = struct{}{}
+	}
+	ps.mu.Unlock()
+
+	if ok {
+		return
+	}
+	// outside the lock, the hook runs at once if a already stopped
+	hook := a.onExit(func(reason string, err ecode.VEI) {
+		ps.UnsubscribeAll(a)
+	})
+
+	ps.mu.Lock()
+	if ps.subs[a] == sub {
+		sub.hook = hook
+		hook = 0
+	}
+	ps.mu.Unlock()
+	if hook != 0 {
+		// unsubscribed meanwhile
+		a.removeExitHook(hook)
+	}
+}
+
+// Unsubscribe remove one subscription of a
+func (ps *PubSub) Unsubscribe(a *Actor, pattern string) {
+	ps.mu.Lock()
+	sub := ps.subs[a]
+	if sub == nil {
+		ps.mu.Unlock()
+		return
+	}
+	ps.remove(a, pattern)
+	delete(sub.topics, pattern)
+	if len(sub.topics) > 0 {
+		ps.mu.Unlock()
+		return
+	}
+	delete(ps.subs, a)
+	ps.mu.Unlock()
+
+	a.removeExitHook(sub.hook)
+}
+
+// UnsubscribeAll remove all subscriptions of a
+func (ps *PubSub) UnsubscribeAll(a *Actor) {
+	ps.mu.Lock()
+	sub := ps.subs[a]
+	if sub == nil {
+		ps.mu.Unlock()
+		return
+	}
+	for pattern := range sub.topics {
+		ps.remove(a, pattern)
+	}
+	delete(ps.subs, a)
+	ps.mu.Unlock()
+
+	a.removeExitHook(sub.hook)
+}
+
+// Publish cast &TopicMsg{topic, msg} once to every running actor subscribed to a matching pattern
+// and return their number. The publisher never waits: a full mailbox gets the msg later by its
+// overflow policy, after msgs published since, and a drop or reject is only logged
+func (ps *PubSub) Publish(topic string, msg interface{}) int {
+	n := 0
+	tm := &TopicMsg{Topic: topic, Msg: msg}
+	for a := range ps.match(topic) {
+		if a.IsStopped.Load() {
+			continue
+		}
+		name := a.Name
+		a.postNoWaitOr(a.Mailbox, &ActorCast{msg: tm}, func(err ecode.VEI) {
+			log.Warnf(logPubSub, logPub, "publish %v to %v failed: %v", topic, name, err)
+		})
+		n++
+	}
+	return n
+}
+
+// Subscribers number of actors subscribed to topic exactly or by pattern
+func (ps *PubSub) Subscribers(topic string) int {
+	return len(ps.match(topic))
+}
+
+// match actors subscribed to topic, each once
+func (ps *PubSub) match(topic string) map[*Actor]struct{} {
+	segs := strings.Split(topic, topicSep)
+
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	targets := make(map[*Actor]struct{}, len(ps.exact[topic]))
+	for a := range ps.exact[topic] {
+		targets[a] = struct{}{}
+	}
+	for _, p := range ps.patterns {
+		if matchTopic(p.segs, segs) {
+			for a := range p.subs {
+				targets[a] = struct{}{}
+			}
+		}
+	}
+	return targets
+}
+
+// remove called with mu locked
+func (ps *PubSub) remove(a *Actor, pattern string) {
+	if isTopicPattern(pattern) {
+		if p := ps.patterns[pattern]; p != nil {
+			delete(p.subs, a)
+			if len(p.subs) == 0 {
+				delete(ps.patterns, pattern)
+			}
+		}
+		return
+	}
+
+	if subs := ps.exact[pattern]; subs != nil {
+		delete(subs, a)
+		if len(subs) == 0 {
+			delete(ps.exact, pattern)
+		}
+	}
+}
+
+func isTopicPattern(pattern string) bool {
+	return strings.Contains(pattern, topicWildOne) || strings.Contains(pattern, topicWildTrail)
+}
+
+func matchTopic(pattern, topic []string) bool {
+	for i, seg := range pattern {
+		if seg == topicWildTrail && i == len(pattern)-1 {
+			return true
+		}
+		if i >= len(topic) {
+			return false
+		}
+		if seg != topicWildOne && seg != topic[i] {
+			return false
+		}
+	}
+	return len(pattern) == len(topic)
+}
@@ -0,0 +1,150 @@
+/*
+ * @Date: 2026-10-18 18:12:49
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 18:12:49
+ * @FilePath: /vlgo/gen/pubsub_test.go
+ * @Description: topic patterns, delivery once per actor, unsubscribe on stop and publish without waiting
+ */
+package gen
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern, topic string
+		want           bool
+	}{
+		{"a.b.c", "a.b.c", true},
+		{"a.*.c", "a.b.c", true},
+		{"a.*.c", "a.b.d", false},
+		{"a.*", "a", false},
+		{"a.*", "a.b.c", false},
+		{"a.#", "a", true},
+		{"a.#", "a.b.c", true},
+		{"a.#", "b.c", false},
+		{"#", "x.y", true},
+		{"*.*", "x.y", true},
+		{"a.b", "a.b.c", false},
+	}
+	for _, tt := range tests {
+		if got := matchTopic(strings.Split(tt.pattern, topicSep), strings.Split(tt.topic, topicSep)); got != tt.want {
+			t.Errorf("match %v %v: %v, want %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func expectTopic(t *testing.T, msgs chan interface{}, topic string, msg interface{}) {
+	t.Helper()
+	tm, ok := recvMsg(t, msgs, "topic msg "+topic).(*TopicMsg)
+	if !ok || tm.Topic != topic || tm.Msg != msg {
+		t.Fatalf("got %+v, want %v %v", tm, topic, msg)
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	ps := NewPubSub()
+	a, b := &Actor{}, &Actor{}
+	amsgs := startRecorder(t, a, "pst_a")
+	bmsgs := startRecorder(t, b, "pst_b")
+	ps.Subscribe(a, "player.login")
+	ps.Subscribe(a, "player.*")
+	ps.Subscribe(a, "player.*")
+	ps.Subscribe(b, "player.#")
+
+	// once per actor whatever the number of matching subscriptions
+	if n := ps.Publish("player.login", 1); n != 2 {
+		t.Fatalf("published to %v", n)
+	}
+	expectTopic(t, amsgs, "player.login", 1)
+	expectTopic(t, bmsgs, "player.login", 1)
+	if n := ps.Publish("player", 2); n != 1 {
+		t.Fatalf("published to %v", n)
+	}
+	expectTopic(t, bmsgs, "player", 2)
+	if n := ps.Publish("guild.create", 3); n != 0 || ps.Subscribers("player.logout") != 2 {
+		t.Fatalf("published to %v", n)
+	}
+	// the default bus is another one
+	if n := Publish("player.login", 4); n != 0 {
+		t.Fatalf("default bus published to %v", n)
+	}
+
+	ps.Unsubscribe(a, "player.*")
+	if n := ps.Subscribers("player.logout"); n != 1 {
+		t.Fatalf("subscribers %v", n)
+	}
+	ps.Unsubscribe(a, "player.login")
+	if n := ps.Subscribers("player.login"); n != 1 {
+		t.Fatalf("subscribers %v", n)
+	}
+
+	// a stopped actor is unsubscribed
+	b.Stop(StopReasonShutdown, 0)
+	waitFor(t, "unsubscribed on stop", func() bool { return ps.Subscribers("player.login") == 0 })
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	if len(ps.subs) != 0 || len(ps.exact) != 0 || len(ps.patterns) != 0 {
+		t.Fatalf("left %v %v %v", ps.subs, ps.exact, ps.patterns)
+	}
+}
+
+// a publisher never waits on a full mailbox, its own included
+func TestPublishFull(t *testing.T) {
+	ps := NewPubSub()
+	gate := make(chan struct{})
+	got := make(chan interface{}, 16)
+	block := func(ctx ActorCtx, msg interface{}) ActorRet {
+		if msg == "block" {
+			<-gate
+		}
+		got <- msg
+		return NewGenRet(nil, nil)
+	}
+	slow := startFunc(t, &Actor{MailboxLen: 1}, "pst_slow", funcH{handle: block})
+	slow.Cast("block")
+	slow.Cast("fill")
+	ps.Subscribe(slow, "news")
+	drop := startFunc(t, &Actor{MailboxLen: 1, Overflow: OverflowDropNewest}, "pst_drop", funcH{handle: block})
+	drop.Cast("block")
+	waitFor(t, "block taken", func() bool { return drop.MailboxSize() == 0 })
+	drop.Cast("fill")
+	ps.Subscribe(drop, "news")
+
+	published := make(chan int, 1)
+	self := startFunc(t, &Actor{MailboxLen: 1}, "pst_self", funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		if msg == "go" {
+			ctx.Self().Cast("fill")
+			published <- ps.Publish("news", 1)
+		}
+		return NewGenRet(nil, nil)
+	}})
+	ps.Subscribe(self, "news")
+	self.Cast("go")
+	if n := recvMsg(t, published, "publish"); n != 3 {
+		t.Fatalf("published to %v", n)
+	}
+
+	// the blocking subscriber gets it once it has room, the dropping one never
+	waitFor(t, "news dropped", func() bool { return drop.Dropped() == 1 })
+	close(gate)
+	msgs := map[interface{}]int{}
+	for i := 0; i < 5; i++ {
+		msg := recvMsg(t, got, "msg")
+		if tm, ok := msg.(*TopicMsg); ok {
+			msg = tm.Topic
+		}
+		msgs[msg]++
+	}
+	if msgs["block"] != 2 || msgs["fill"] != 2 || msgs["news"] != 1 {
+		t.Fatalf("handled %v", msgs)
+	}
+	select {
+	case msg := <-got:
+		t.Fatalf("got %v", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
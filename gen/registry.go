@@ -0,0 +1,81 @@
+/*
+ * @Date: 2026-10-17 11:02:40
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 11:02:40
+ * @FilePath: /vlgo/gen/registry.go
+ * @Description: process wide actor name registry
+ */
+package gen
+
+import (
+	"sync"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+const logRegistry = "Registry"
+
+// allActors name -> *Actor, filled by Actor.Start and cleaned when actor loop exit
+var allActors sync.Map
+
+// Register bind name to actor, fail if name already in use
+func Register(name string, a *Actor) ecode.VEI {
+	if _, loaded := allActors.LoadOrStore(name, a); loaded {
+		log.Errorf(logRegistry, logStart, "register %s already in use", name)
+		return ecode.ErrActorNameExists
+	}
+
+	log.Debugf(logRegistry, logStart, "register %s", name)
+	return nil
+}
+
+// Unregister remove name whatever actor it bound to
+func Unregister(name string) {
+	if _, loaded := allActors.LoadAndDelete(name); loaded {
+		log.Debugf(logRegistry, logActor, "unregister %s", name)
+	}
+}
+
+// unregisterActor remove name only if it still bound to a, a restarted actor may reuse the name
+func unregisterActor(name string, a *Actor) {
+	if allActors.CompareAndDelete(name, a) {
+		log.Debugf(logRegistry, logActor, "unregister %s", name)
+	}
+}
+
+// WhereIs find actor by name
+func WhereIs(name string) (*Actor, bool) {
+	if v, ok := allActors.Load(name); ok {
+		return v.(*Actor), true
+	}
+	return nil, false
+}
+
+// Registered all registered names
+func Registered() []string {
+	var names []string
+	allActors.Range(func(key, value any) bool {
+		names = append(names, key.(string))
+		return true
+	})
+	return names
+}
+
+// CallByName call actor registered as name
+func CallByName(name string, msg interface{}) (interface{}, ecode.VEI) {
+	a, ok := WhereIs(name)
+	if !ok {
+		return nil, ecode.ErrActorNotFound
+	}
+	return a.Call(msg)
+}
+
+// CastByName cast to actor registered as name
+func CastByName(name string, msg interface{}) ecode.VEI {
+	a, ok := WhereIs(name)
+	if !ok {
+		log.Warnf(logRegistry, logCast, "cast %v to unregistered %s", typeName(msg), name)
+		return ecode.ErrActorNotFound
+	}
+	return a.Cast(msg)
+}
@@ -0,0 +1,124 @@
+/*
+ * @Date: 2026-10-18 14:10:25
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 14:10:25
+ * @FilePath: /vlgo/gen/registry_test.go
+ * @Description: name registration, lookup while starting and reuse after stop
+ */
+package gen
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+func TestRegistry(t *testing.T) {
+	a := startFunc(t, &Actor{}, "rt_echo", echoFuncH())
+	if got, ok := WhereIs("rt_echo"); !ok || got != a {
+		t.Fatal("rt_echo not found")
+	}
+	names := Registered()
+	sort.Strings(names)
+	if i := sort.SearchStrings(names, "rt_echo"); i == len(names) || names[i] != "rt_echo" {
+		t.Fatalf("registered %v", names)
+	}
+
+	if _, err := (&Actor{}).Start(Ctx("rt_echo"), nil, nil, echoFuncH()); err != ecode.ErrActorNameExists {
+		t.Fatalf("start twice: %v", err)
+	}
+	if reply, err := CallByName("rt_echo", 1); reply != 1 || err != nil {
+		t.Fatalf("call by name: %v %v", reply, err)
+	}
+	if err := CastByName("rt_echo", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CallByName("rt_nobody", 1); err != ecode.ErrActorNotFound {
+		t.Fatalf("call unknown: %v", err)
+	}
+	if err := CastByName("rt_nobody", 1); err != ecode.ErrActorNotFound {
+		t.Fatalf("cast unknown: %v", err)
+	}
+
+	a.Stop(StopReasonShutdown, 0)
+	if _, ok := WhereIs("rt_echo"); ok {
+		t.Fatal("found after stop")
+	}
+}
+
+// a name is found only once the actor can take mails, even while Init still runs
+func TestRegistryLookupWhileStarting(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("rt_starting%v", i)
+		gate := make(chan struct{})
+		h := echoFuncH()
+		h.init = func(ctx ActorCtx, msg interface{}) ActorRet {
+			<-gate
+			return NewGenRet(nil, nil)
+		}
+
+		a := &Actor{}
+		started := make(chan ecode.VEI, 1)
+		go func() {
+			_, err := a.Start(Ctx(name), nil, nil, h)
+			started <- err
+		}()
+
+		replies := make(chan interface{}, 1)
+		waitFor(t, name+" registered", func() bool {
+			if err := CastByName(name, "cast"); err == ecode.ErrActorNotFound {
+				return false
+			} else if err != nil {
+				t.Fatalf("cast while starting: %v", err)
+			}
+			go func() {
+				reply, _ := CallByName(name, "call")
+				replies <- reply
+			}()
+			return true
+		})
+		close(gate)
+		if reply := recvMsg(t, replies, "reply"); reply != "call" {
+			t.Fatalf("reply %v", reply)
+		}
+		if err := recvMsg(t, started, "start"); err != nil {
+			t.Fatal(err)
+		}
+		a.Stop(StopReasonShutdown, 0)
+	}
+}
+
+// a name is taken again as soon as WhereIs misses it
+func TestRegistryRestartSameName(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		a := &Actor{}
+		if _, err := a.Start(Ctx("rt_restart"), nil, nil, echoFuncH()); err != nil {
+			t.Fatalf("round %v: %v", i, err)
+		}
+		a.Cast("stop")
+		waitFor(t, "rt_restart unregistered", func() bool {
+			_, ok := WhereIs("rt_restart")
+			return !ok
+		})
+	}
+	a := startFunc(t, &Actor{}, "rt_restart", echoFuncH())
+	if reply, err := a.Call(1); reply != 1 || err != nil {
+		t.Fatalf("call restarted: %v %v", reply, err)
+	}
+}
+
+// unregistering a stopped actor leaves the name of a newer one alone
+func TestUnregisterActor(t *testing.T) {
+	old := &Actor{}
+	a := startFunc(t, &Actor{}, "rt_owner", echoFuncH())
+	unregisterActor("rt_owner", old)
+	if got, ok := WhereIs("rt_owner"); !ok || got != a {
+		t.Fatal("name removed by another actor")
+	}
+	Unregister("rt_owner")
+	if _, ok := WhereIs("rt_owner"); ok {
+		t.Fatal("found after Unregister")
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ * @Date: 2026-10-17 19:10:05
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 19:10:05
+ * @FilePath: /vlgo/gen/remote_msg.go
+ * @Description: messages crossing nodes, protobuf generated by proto/make_proto.sh
+ */
+package gen
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+// RemoteMsg implemented by the messages generated from proto/*.proto
+type RemoteMsg interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// remoteTypes name -> pointer type, remoteNames the reverse
+var (
+	remoteMu    sync.RWMutex
+	remoteTypes = make(map[string]reflect.Type)
+	remoteNames = make(map[reflect.Type]string)
+)
+
+// RegisterRemoteMsg allow messages of the same type as samples to be sent to and replied by other
+// nodes, register the same types on every node, e.g. RegisterRemoteMsg(&pb_gen.People{})
+func RegisterRemoteMsg(samples ...RemoteMsg) {
+	remoteMu.Lock()
+	defer remoteMu.Unlock()
+
+	for _, sample := range samples {
+		t := reflect.TypeOf(sample)
+		if t.Kind() != reflect.Ptr {
+			log.Fatalf(logNode, logStart, "remote msg %v must be a pointer", t)
+		}
+		name := t.Elem().String()
+		remoteTypes[name] = t
+		remoteNames[t] = name
+	}
+}
+
+func encodeRemoteMsg(msg interface{}) (string, []byte, ecode.VEI) {
+	if msg == nil {
+		return "", nil, nil
+	}
+
+	remoteMu.RLock()
+	name, ok := remoteNames[reflect.TypeOf(msg)]
+	remoteMu.RUnlock()
+	if !ok {
+		log.Errorf(logNode, logSend, "remote msg %v not registered", typeName(msg))
+		return "", nil, ecode.ErrActorMsgType
+	}
+
+	data, err := msg.(RemoteMsg).Marshal()
+	if err != nil {
+		return "", nil, ecode.CustomThirdPluginErr(err)
+	}
+	return name, data, nil
+}
+
+func decodeRemoteMsg(name string, data []byte) (interface{}, ecode.VEI) {
+	if name == "" {
+		return nil, nil
+	}
+
+	remoteMu.RLock()
+	t, ok := remoteTypes[name]
+	remoteMu.RUnlock()
+	if !ok {
+		log.Errorf(logNode, logActor, "remote msg %v not registered", name)
+		return nil, ecode.ErrActorMsgType
+	}
+
+	msg := reflect.New(t.Elem()).Interface().(RemoteMsg)
+	if err := msg.Unmarshal(data); err != nil {
+		return nil, ecode.CustomThirdPluginErr(err)
+	}
+	return msg, nil
+}
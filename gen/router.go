@@ -0,0 +1,362 @@
+/*
+ * @Date: 2026-10-17 17:02:51
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 17:02:51
+ * @FilePath: /vlgo/gen/router.go
+ * @Description: pool of identical actors behind one router
+ */
+package gen
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+	"github.com/LiPengfei/vlgo/utils/clock"
+	"go.uber.org/atomic"
+)
+
+const logRouter = "Router"
+
+// routerVNodes virtual nodes per worker on the hash ring, more nodes spread keys more evenly
+const routerVNodes = 64
+
+// RouteStrategy how Router pick a worker for a message
+type RouteStrategy int
+
+const (
+	RoundRobin     RouteStrategy = iota // workers in turn
+	LeastLoaded                         // worker with the smallest mailbox
+	ConsistentHash                      // same key same worker while the pool size unchanged, few keys move on resize
+)
+
+// RouterOpts options of NewRouter, worker actors share DefaultOut, MailboxLen and Sched
+type RouterOpts struct {
+	Size     int
+	Strategy RouteStrategy
+	// Key extract the hash key from a message, required by ConsistentHash
+	Key func(msg interface{}) string
+
+	InitMsg    interface{}
+	DefaultOut time.Duration
+	MailboxLen int
+	Sched      *Scheduler
+
+	// Intensity more than Intensity worker restarts in Period stop restarting, the pool shrinks until
+	// the next Resize. DefaultSupIntensity and DefaultSupPeriod if 0
+	Intensity int
+	Period    time.Duration
+
+	// Factory create the handler and state of one worker
+	Factory func() (ActorHandlerI, interface{})
+}
+
+type ringNode struct {
+	hash   uint32
+	worker *Actor
+}
+
+// Router dispatch Call/Cast to a pool of workers started from one factory, workers are named
+// name_1, name_2 ... Workers removed by Resize handle mails already queued before they stop.
+// A worker stopped by itself or by a panic is taken out of the pool and restarted with its name,
+// within the restart intensity of opts
+type Router struct {
+	name string
+	opts RouterOpts
+
+	// resizeMu serialize Resize, which start workers without holding mu
+	resizeMu sync.Mutex
+
+	mu      sync.RWMutex
+	workers []*Actor
+	ring    []ringNode
+	size    int
+	seq     int
+	closed  bool
+	rr      atomic.Uint64
+
+	restarts []time.Time
+}
+
+// NewRouter start opts.Size workers, at least one
+func NewRouter(name string, opts RouterOpts) (*Router, ecode.VEI) {
+	if opts.Strategy == ConsistentHash && opts.Key == nil {
+		log.Errorf(logRouter, logStart, "%v consistent hash without Key, use round robin", name)
+		opts.Strategy = RoundRobin
+	}
+	if opts.Size <= 0 {
+		opts.Size = 1
+	}
+	if opts.Intensity <= 0 {
+		opts.Intensity = DefaultSupIntensity
+	}
+	if opts.Period <= 0 {
+		opts.Period = DefaultSupPeriod
+	}
+
+	r := &Router{name: name, opts: opts}
+	if err := r.Resize(opts.Size); err != nil {
+		r.Stop()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Cast method
+func (r *Router) Cast(msg interface{}) ecode.VEI {
+	a, err := r.pick(msg)
+	if err != nil {
+		return err
+	}
+	return a.Cast(msg)
+}
+
+// Call method
+func (r *Router) Call(msg interface{}) (interface{}, ecode.VEI) {
+	a, err := r.pick(msg)
+	if err != nil {
+		return nil, err
+	}
+	return a.Call(msg)
+}
+
+// CallCtx method
+func (r *Router) CallCtx(ctx context.Context, msg interface{}) (interface{}, ecode.VEI) {
+	a, err := r.pick(msg)
+	if err != nil {
+		return nil, err
+	}
+	return a.CallCtx(ctx, msg)
+}
+
+// Size number of workers
+func (r *Router) Size() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.workers)
+}
+
+// Workers current workers in start order
+func (r *Router) Workers() []*Actor {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*Actor(nil), r.workers...)
+}
+
+// Resize start or stop workers until there are n, the newest are stopped first. New workers are
+// started before joining the pool, routing is not held meanwhile
+func (r *Router) Resize(n int) ecode.VEI {
+	if n <= 0 {
+		n = 1
+	}
+	r.resizeMu.Lock()
+	defer r.resizeMu.Unlock()
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ecode.ErrActorStopped
+	}
+	r.size = n
+	var stopping []*Actor
+	if len(r.workers) > n {
+		stopping = append(stopping, r.workers[n:]...)
+		r.workers = r.workers[:n]
+		r.buildRing()
+	}
+	var names []string
+	for i := len(r.workers); i < n; i++ {
+		r.seq++
+		names = append(names, r.name+"_"+strconv.Itoa(r.seq))
+	}
+	r.mu.Unlock()
+
+	for _, a := range stopping {
+		if e := a.Stop(StopReasonShutdown, 0); e != nil {
+			log.Errorf(logRouter, logActor, "%v stop worker %v failed: %v", r.name, a.Name, e)
+		}
+	}
+
+	var err ecode.VEI
+	var started []*Actor
+	for _, name := range names {
+		var a *Actor
+		if a, err = r.startWorker(name); err != nil {
+			break
+		}
+		started = append(started, a)
+	}
+	if len(started) > 0 {
+		r.join(started...)
+	}
+	log.Infof(logRouter, logActor, "%v resize to %v, err: %v", r.name, n, err)
+	return err
+}
+
+// Stop stop all workers
+func (r *Router) Stop() {
+	r.mu.Lock()
+	workers := r.workers
+	r.workers, r.ring, r.closed = nil, nil, true
+	r.mu.Unlock()
+
+	for i := len(workers) - 1; i >= 0; i-- {
+		workers[i].Stop(StopReasonShutdown, 0)
+	}
+}
+
+func (r *Router) startWorker(name string) (*Actor, ecode.VEI) {
+	handle, state := r.opts.Factory()
+	a := &Actor{
+		DefaultOut:  r.opts.DefaultOut,
+		MailboxLen:  r.opts.MailboxLen,
+		Sched:       r.opts.Sched,
+		DrainOnStop: true,
+		StopOnPanic: true,
+	}
+	a.onExit(func(reason string, err ecode.VEI) {
+		// not in the exiting worker, restart may wait its name
+		go r.workerDown(a, reason, err)
+	})
+	if _, err := a.Start(Ctx(name), r.opts.InitMsg, state, handle); err != nil {
+		log.Errorf(logRouter, logStart, "%v start worker %v failed: %v", r.name, name, err)
+		return nil, err
+	}
+	return a, nil
+}
+
+// join add started workers, stop them if the router stopped or is already full
+func (r *Router) join(workers ...*Actor) {
+	var extra []*Actor
+	r.mu.Lock()
+	for _, a := range workers {
+		if r.closed || len(r.workers) >= r.size {
+			extra = append(extra, a)
+			continue
+		}
+		r.workers = append(r.workers, a)
+	}
+	r.buildRing()
+	r.mu.Unlock()
+
+	for _, a := range extra {
+		a.Stop(StopReasonShutdown, 0)
+	}
+}
+
+// workerDown take a stopped worker out of the pool and restart it with the same name, so it keeps
+// its keys on the hash ring. Workers stopped by Resize or Stop are already out
+func (r *Router) workerDown(a *Actor, reason string, err ecode.VEI) {
+	r.mu.Lock()
+	i := -1
+	for j, w := range r.workers {
+		if w == a {
+			i = j
+			break
+		}
+	}
+	if i < 0 {
+		r.mu.Unlock()
+		return
+	}
+	r.workers = append(r.workers[:i:i], r.workers[i+1:]...)
+	r.buildRing()
+	restart := r.addRestart()
+	r.mu.Unlock()
+
+	if !restart {
+		log.Errorf(logRouter, logRestart, "%v worker %v stopped, reason: %v, err: %v, reached max restart intensity %v in %v, pool shrinks",
+			r.name, a.Name, reason, err, r.opts.Intensity, r.opts.Period)
+		return
+	}
+	log.Warnf(logRouter, logRestart, "%v worker %v stopped, reason: %v, err: %v, restart", r.name, a.Name, reason, err)
+	b, e := r.startWorker(a.Name)
+	if e != nil {
+		log.Errorf(logRouter, logRestart, "%v restart worker %v failed: %v, pool shrinks", r.name, a.Name, e)
+		return
+	}
+	r.join(b)
+}
+
+// addRestart called with mu locked, record one restart, false if intensity exceeded
+func (r *Router) addRestart() bool {
+	now := clock.Now()
+	restarts := r.restarts[:0]
+	for _, tm := range r.restarts {
+		if now.Sub(tm) < r.opts.Period {
+			restarts = append(restarts, tm)
+		}
+	}
+	if len(restarts) >= r.opts.Intensity {
+		r.restarts = restarts
+		return false
+	}
+	r.restarts = append(restarts, now)
+	return true
+}
+
+func (r *Router) pick(msg interface{}) (*Actor, ecode.VEI) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.workers) == 0 {
+		return nil, ecode.ErrActorStopped
+	}
+
+	switch r.opts.Strategy {
+	case LeastLoaded:
+		best := r.workers[0]
+		min := best.MailboxSize()
+		for _, a := range r.workers[1:] {
+			if n := a.MailboxSize(); n < min {
+				best, min = a, n
+			}
+		}
+		return best, nil
+
+	case ConsistentHash:
+		h := hashKey(r.opts.Key(msg))
+		i := sort.Search(len(r.ring), func(i int) bool { return r.ring[i].hash >= h })
+		if i == len(r.ring) {
+			i = 0
+		}
+		return r.ring[i].worker, nil
+
+	default:
+		return r.workers[(r.rr.Inc()-1)%uint64(len(r.workers))], nil
+	}
+}
+
+// buildRing called with mu locked, nodes hashed by worker name so a worker keep its keys across resize
+func (r *Router) buildRing() {
+	if r.opts.Strategy != ConsistentHash {
+		return
+	}
+
+	ring := make([]ringNode, 0, len(r.workers)*routerVNodes)
+	for _, a := range r.workers {
+		for i := 0; i < routerVNodes; i++ {
+			ring = append(ring, ringNode{hashKey(fmt.Sprintf("%s#%d", a.Name, i)), a})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	r.ring = ring
+}
+
+// hashKey fnv spread by the murmur3 finalizer, fnv alone clusters keys differing in the last bytes
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
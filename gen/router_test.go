@@ -0,0 +1,211 @@
+/*
+ * @Date: 2026-10-18 18:31:05
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 18:31:05
+ * @FilePath: /vlgo/gen/router_test.go
+ * @Description: routing strategies, resize, stop and worker restarts
+ */
+package gen
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// whoFuncH answer every msg with the worker name, stop on "stop", panic on "panic"
+func whoFuncH() (ActorHandlerI, interface{}) {
+	return funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		switch msg {
+		case "stop":
+			return NewStopRet(nil, nil)
+		case "panic":
+			panic("boom")
+		}
+		return NewGenRet(ctx.Name(), nil)
+	}}, nil
+}
+
+func startTestRouter(t *testing.T, name string, opts RouterOpts) *Router {
+	t.Helper()
+	if opts.Factory == nil {
+		opts.Factory = whoFuncH
+	}
+	r, err := NewRouter(name, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Stop)
+	return r
+}
+
+func TestRouterRoundRobin(t *testing.T) {
+	r := startTestRouter(t, "rtt_rr", RouterOpts{Size: 3})
+	seen := map[interface{}]int{}
+	for i := 0; i < 9; i++ {
+		who, err := r.Call(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[who]++
+	}
+	if len(seen) != 3 || seen["rtt_rr_1"] != 3 || seen["rtt_rr_2"] != 3 || seen["rtt_rr_3"] != 3 {
+		t.Fatalf("spread %v", seen)
+	}
+}
+
+func TestRouterLeastLoaded(t *testing.T) {
+	gate := make(chan struct{})
+	defer close(gate)
+	r := startTestRouter(t, "rtt_ll", RouterOpts{Size: 2, Strategy: LeastLoaded, Factory: func() (ActorHandlerI, interface{}) {
+		return funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+			if msg == "block" {
+				<-gate
+			}
+			return NewGenRet(ctx.Name(), nil)
+		}}, nil
+	}})
+	// the first worker is busy with queued mails
+	first := r.Workers()[0]
+	for i := 0; i < 3; i++ {
+		first.Cast("block")
+	}
+	for i := 0; i < 5; i++ {
+		if who, err := r.Call(i); who != "rtt_ll_2" || err != nil {
+			t.Fatalf("picked %v %v", who, err)
+		}
+	}
+}
+
+func TestRouterConsistentHash(t *testing.T) {
+	r := startTestRouter(t, "rtt_ch", RouterOpts{Size: 4, Strategy: ConsistentHash,
+		Key: func(msg interface{}) string { return fmt.Sprint(msg) }})
+	before := map[int]interface{}{}
+	for i := 0; i < 200; i++ {
+		before[i], _ = r.Call(i)
+		if who, _ := r.Call(i); who != before[i] {
+			t.Fatalf("key %v moved from %v to %v", i, before[i], who)
+		}
+	}
+
+	// a new worker only takes keys, the others keep theirs
+	if err := r.Resize(5); err != nil {
+		t.Fatal(err)
+	}
+	moved := 0
+	for i := 0; i < 200; i++ {
+		if who, _ := r.Call(i); who != before[i] {
+			if who != "rtt_ch_5" {
+				t.Fatalf("key %v moved from %v to %v", i, before[i], who)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > 100 {
+		t.Fatalf("%v keys moved", moved)
+	}
+}
+
+func TestRouterResize(t *testing.T) {
+	r := startTestRouter(t, "rtt_resize", RouterOpts{Size: 2})
+	if err := r.Resize(4); err != nil || r.Size() != 4 {
+		t.Fatalf("grow %v %v", r.Size(), err)
+	}
+
+	// the newest workers stop first
+	removed := r.Workers()[1:]
+	if err := r.Resize(1); err != nil || r.Size() != 1 {
+		t.Fatalf("shrink %v %v", r.Size(), err)
+	}
+	for _, a := range removed {
+		select {
+		case <-a.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("%v not stopped", a.Name)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if who, _ := r.Call(i); who != "rtt_resize_1" {
+			t.Fatalf("routed to %v", who)
+		}
+	}
+	// workers stopped by Resize are not restarted
+	time.Sleep(20 * time.Millisecond)
+	if r.Size() != 1 {
+		t.Fatalf("size %v", r.Size())
+	}
+}
+
+func TestRouterStop(t *testing.T) {
+	r := startTestRouter(t, "rtt_stop", RouterOpts{Size: 2})
+	workers := r.Workers()
+	r.Stop()
+	for _, a := range workers {
+		select {
+		case <-a.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("%v not stopped", a.Name)
+		}
+	}
+	if _, err := r.Call(1); err == nil {
+		t.Fatal("call after stop")
+	}
+	if r.Cast(1) == nil {
+		t.Fatal("cast after stop")
+	}
+}
+
+// a worker stopped by itself or by a panic comes back with its name
+func TestRouterRestart(t *testing.T) {
+	r := startTestRouter(t, "rtt_restart", RouterOpts{Size: 2})
+	for _, msg := range []string{"stop", "panic"} {
+		old := r.Workers()[0]
+		old.Cast(msg)
+		select {
+		case <-old.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("%v: worker not stopped", msg)
+		}
+		waitFor(t, "restarted "+msg, func() bool {
+			w := r.Workers()
+			return len(w) == 2 && w[0] != old && w[1] != old
+		})
+		names := map[interface{}]bool{}
+		for i := 0; i < 4; i++ {
+			who, err := r.Call(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names[who] = true
+		}
+		if !names["rtt_restart_1"] || !names["rtt_restart_2"] {
+			t.Fatalf("%v: workers %v", msg, names)
+		}
+	}
+}
+
+// past the intensity a crashing worker is no more restarted and the pool shrinks
+func TestRouterRestartLimit(t *testing.T) {
+	r := startTestRouter(t, "rtt_limit", RouterOpts{Size: 2, Intensity: 2, Period: time.Minute})
+	for i := 0; i < 3; i++ {
+		w := r.Workers()
+		if len(w) != 2 {
+			t.Fatalf("size %v after %v crashes", len(w), i)
+		}
+		w[0].Cast("panic")
+		<-w[0].Done()
+		if i < 2 {
+			waitFor(t, "restarted", func() bool { return r.Size() == 2 && r.Workers()[1] != w[0] && r.Workers()[0] != w[0] })
+		}
+	}
+	waitFor(t, "pool shrunk", func() bool { return r.Size() == 1 })
+	time.Sleep(20 * time.Millisecond)
+	if r.Size() != 1 {
+		t.Fatalf("size %v", r.Size())
+	}
+
+	// Resize fills the pool again
+	if err := r.Resize(2); err != nil || r.Size() != 2 {
+		t.Fatalf("resize %v %v", r.Size(), err)
+	}
+}
@@ -0,0 +1,315 @@
+/*
+ * @Date: 2026-10-17 10:30:12
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 10:30:12
+ * @FilePath: /vlgo/gen/sched.go
+ * @Description: worker pool scheduler, many actors share a bounded number of goroutines
+ */
+package gen
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/LiPengfei/vlgo/utils"
+	"github.com/LiPengfei/vlgo/utils/clock"
+	"github.com/petermattis/goid"
+	"go.uber.org/atomic"
+)
+
+const (
+	logSched = "Sched"
+)
+
+// DefaultSchedBudget max events one actor handles before yielding its worker
+const DefaultSchedBudget = 64
+
+// Scheduler run actors with Sched set on a fixed pool of workers. An actor with pending events is
+// queued once and handled by one worker at a time, so its state is still accessed by one goroutine
+// at a time. After Budget events the actor is put back to the tail of the queue to keep fairness.
+// Handlers run on shared workers, they should not block long: a Call between actors of the same
+// scheduler, or OverflowBlock on a full mailbox, holds a worker until it returns
+type Scheduler struct {
+	name   string
+	budget int
+	wt     Waiter
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []*Actor
+	closed bool
+}
+
+// actorSched per actor state used when running on a Scheduler
+type actorSched struct {
+	queued atomic.Bool
+
+	inited  bool
+	initMsg interface{}
+	initRet chan ActorRet
+
+	tickEvery time.Duration
+	tick      clock.Timer
+	tickGen   atomic.Uint64
+	tickDue   atomic.Bool
+
+	out    clock.Timer
+	outGen atomic.Uint64
+	outDue atomic.Bool
+}
+
+// NewScheduler start workers goroutines, runtime.NumCPU() if workers <= 0, DefaultSchedBudget if budget <= 0
+func NewScheduler(name string, workers, budget int) *Scheduler {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if budget <= 0 {
+		budget = DefaultSchedBudget
+	}
+
+	sc := &Scheduler{name: name, budget: budget, wt: NewWaiter("sched_" + name)}
+	sc.cond = sync.NewCond(&sc.mu)
+	for i := 0; i < workers; i++ {
+		sc.wt.AddAndSpawnExec(logSched, sc.work)
+	}
+	log.Infof(logSched, logStart, "%v started with %v workers, budget %v", name, workers, budget)
+	return sc
+}
+
+// Close stop workers after queued actors handled their current batch, actors still alive are not
+// stopped and will not run anymore, stop them before Close
+func (sc *Scheduler) Close() {
+	sc.mu.Lock()
+	sc.closed = true
+	sc.mu.Unlock()
+	sc.cond.Broadcast()
+
+	sc.wt.Wait(WaitReason("close " + sc.name))
+	DelWaiter(sc.wt.Key)
+}
+
+func (sc *Scheduler) submit(a *Actor) {
+	sc.mu.Lock()
+	if sc.closed {
+		sc.mu.Unlock()
+		log.Errorf(logSched, logActor, "%v closed, drop run of %v", sc.name, a.Name)
+		return
+	}
+	sc.queue = append(sc.queue, a)
+	sc.mu.Unlock()
+	sc.cond.Signal()
+}
+
+func (sc *Scheduler) next() *Actor {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for len(sc.queue) == 0 {
+		if sc.closed {
+			return nil
+		}
+		sc.cond.Wait()
+	}
+
+	a := sc.queue[0]
+	sc.queue[0] = nil
+	sc.queue = sc.queue[1:]
+	return a
+}
+
+func (sc *Scheduler) work() {
+	for a := sc.next(); a != nil; a = sc.next() {
+		a.runSched(sc.budget)
+	}
+}
+
+// startSched queue the actor to run Init on a worker
+func (s *Actor) startSched(initMsg interface{}, initRet chan ActorRet) {
+	s.sched.initMsg = initMsg
+	s.sched.initRet = initRet
+	s.Wt.Add(1, logStart)
+	s.wake()
+}
+
+// wake queue the actor if it runs on a Scheduler and not queued yet
+func (s *Actor) wake() {
+	if s.Sched != nil && s.sched.queued.CompareAndSwap(false, true) {
+		s.Sched.submit(s)
+	}
+}
+
+// runSched handle at most budget events in the calling worker
+func (s *Actor) runSched(budget int) {
+	s.loopGoID = goid.Get()
+	loopActors.Store(s.loopGoID, s)
+
+	if s.runBudget(budget) {
+		s.stopSchedTimers()
+		s.exit()
+		s.Wt.DoneOne(logStart)
+		return
+	}
+
+	loopActors.Delete(s.loopGoID)
+	s.sched.queued.Store(false)
+	// events arrived after the last check but before queued reset did not wake us
+	if s.hasEvent() {
+		s.wake()
+	}
+}
+
+func (s *Actor) runBudget(budget int) bool {
+	if !s.sched.inited {
+		s.sched.inited = true
+		ret := s.safeInit()
+		s.sched.initRet <- ret
+		s.sched.initMsg, s.sched.initRet = nil, nil
+		if s.applySchedRet(ret) {
+			return true
+		}
+	}
+
+	for i := 0; i < budget; i++ {
+		stopped, handled := s.step()
+		if stopped {
+			return true
+		}
+		if !handled {
+			return false
+		}
+	}
+	return false
+}
+
+func (s *Actor) safeInit() (ret ActorRet) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Gen", "Panic", "stack: %s, err %v", utils.Stack(), r)
+			s.stopReason = stopReasonPanic
+			ret = NewStopRet(nil, nil)
+		}
+	}()
+	return s.H.Init(s.Ctx, s.sched.initMsg, s.State)
+}
+
+// step handle one event in loop priority order, handled false if nothing to do
+func (s *Actor) step() (stopped, handled bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Gen", "Panic", "stack: %s, err %v", utils.Stack(), r)
+			s.curChain = nil
+			if s.StopOnPanic {
+				s.stopReason = stopReasonPanic
+				stopped = true
+				return
+			}
+			s.armOut(s.outDur(0))
+		}
+	}()
+
+	if s.stats.suspended {
+		if msg, ok := s.suspendedMail(); ok {
+			return s.applySchedRet(s.handleMail(s.Ctx, msg)), true
+		}
+		return false, false
+	}
+
+	if msg, ok := s.priorMail(); ok {
+		return s.applySchedRet(s.handleMail(s.Ctx, msg)), true
+	}
+
+	select {
+	case tm := <-s.InterruptBox:
+		s.setSchedTick(tm)
+		s.armOut(s.outDur(0))
+		return false, true
+	default:
+	}
+
+	if s.sched.tickDue.CompareAndSwap(true, false) {
+		ret := s.H.Tick(s.Ctx, s.State)
+		if s.sched.tick != nil {
+			s.sched.tick.Reset(s.sched.tickEvery)
+		}
+		return s.applySchedRet(ret), true
+	}
+
+	select {
+	case msg := <-s.Mailbox:
+		return s.applySchedRet(s.handleMail(s.Ctx, msg)), true
+	default:
+	}
+
+	if s.sched.outDue.CompareAndSwap(true, false) {
+		return s.applySchedRet(s.H.Timeout(s.Ctx, s.State)), true
+	}
+	return false, false
+}
+
+// hasEvent any mail, ticker change or due timer waiting
+func (s *Actor) hasEvent() bool {
+	if s.stats.suspended {
+		return len(s.sysBox) > 0
+	}
+	return len(s.sysBox) > 0 || len(s.highBox) > 0 || len(s.Mailbox) > 0 || len(s.InterruptBox) > 0 ||
+		s.sched.tickDue.Load() || s.sched.outDue.Load()
+}
+
+func (s *Actor) applySchedRet(ret ActorRet) bool {
+	if s.retStopped(ret) {
+		return true
+	}
+	s.armOut(s.outDur(ret.tm()))
+	return false
+}
+
+// armOut restart the idle timeout, same as a new out timer in own goroutine loop
+func (s *Actor) armOut(d time.Duration) {
+	if s.sched.out != nil {
+		s.sched.out.Stop()
+		s.sched.out = nil
+	}
+	gen := s.sched.outGen.Inc()
+	s.sched.outDue.Store(false)
+	s.stats.outAt = time.Time{}
+	if d <= 0 {
+		return
+	}
+	s.stats.outAt = clock.Now().Add(d)
+
+	s.sched.out = clock.AfterFunc(d, func() {
+		if s.sched.outGen.Load() == gen {
+			s.sched.outDue.Store(true)
+			s.wake()
+		}
+	})
+}
+
+// setSchedTick replace the ticker, stop it if tm <= 0
+func (s *Actor) setSchedTick(tm time.Duration) {
+	if s.sched.tick != nil {
+		s.sched.tick.Stop()
+		s.sched.tick = nil
+	}
+	gen := s.sched.tickGen.Inc()
+	s.sched.tickDue.Store(false)
+	s.sched.tickEvery = tm
+	s.stats.tickEvery = 0
+	if tm <= 0 {
+		return
+	}
+	s.stats.tickEvery = tm
+
+	s.sched.tick = clock.AfterFunc(tm, func() {
+		if s.sched.tickGen.Load() == gen {
+			s.sched.tickDue.Store(true)
+			s.wake()
+		}
+	})
+}
+
+func (s *Actor) stopSchedTimers() {
+	s.setSchedTick(0)
+	s.armOut(0)
+}
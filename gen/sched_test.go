@@ -0,0 +1,148 @@
+/*
+ * @Date: 2026-10-18 17:28:40
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 17:28:40
+ * @FilePath: /vlgo/gen/sched_test.go
+ * @Description: actors on scheduler workers, order, exclusive state, budget, ticks and timeouts
+ */
+package gen
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestSched(t *testing.T, workers, budget int) *Scheduler {
+	t.Helper()
+	sc := NewScheduler(t.Name(), workers, budget)
+	t.Cleanup(sc.Close)
+	return sc
+}
+
+// many actors on few workers handle their mails in order, one worker at a time each
+func TestSched(t *testing.T) {
+	sc := newTestSched(t, 2, 4)
+	type seqState struct {
+		in   int32
+		next int
+	}
+	var overlap, outOfOrder int32
+	actors := make([]*Actor, 100)
+	for i := range actors {
+		s := &seqState{}
+		actors[i] = &Actor{Sched: sc}
+		h := funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+			if !atomic.CompareAndSwapInt32(&s.in, 0, 1) {
+				atomic.AddInt32(&overlap, 1)
+			}
+			defer atomic.StoreInt32(&s.in, 0)
+			if n, ok := msg.(int); ok {
+				if n != s.next {
+					atomic.AddInt32(&outOfOrder, 1)
+				}
+				s.next++
+			}
+			return NewGenRet(s.next, nil)
+		}}
+		startFunc(t, actors[i], fmt.Sprintf("sct_%v", i), h)
+	}
+	for j := 0; j < 50; j++ {
+		for _, a := range actors {
+			a.Cast(j)
+		}
+	}
+	for _, a := range actors {
+		if n, err := a.Call("done"); n != 50 || err != nil {
+			t.Fatalf("%v handled %v: %v", a.Name, n, err)
+		}
+	}
+	if overlap != 0 || outOfOrder != 0 {
+		t.Fatalf("overlap %v, out of order %v", overlap, outOfOrder)
+	}
+}
+
+// after budget events a busy actor yields its worker to the others
+func TestSchedBudget(t *testing.T) {
+	sc := newTestSched(t, 1, 2)
+	got := make(chan interface{}, 32)
+	gate := make(chan struct{})
+	h := funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+		if msg == "block" {
+			<-gate
+			return NewGenRet(nil, nil)
+		}
+		got <- msg
+		return NewGenRet(nil, nil)
+	}}
+	blocker := startFunc(t, &Actor{Sched: sc}, "sct_blocker", h)
+	busy := startFunc(t, &Actor{Sched: sc}, "sct_busy", h)
+	other := startFunc(t, &Actor{Sched: sc}, "sct_other", h)
+
+	// hold the only worker until both actors are queued
+	blocker.Cast("block")
+	for i := 0; i < 6; i++ {
+		busy.Cast(i)
+	}
+	other.Cast("other")
+	close(gate)
+	expectHandled(t, got, 0, 1, "other", 2, 3, 4, 5)
+}
+
+func TestSchedEvents(t *testing.T) {
+	sc := newTestSched(t, 2, 0)
+	var ticks, outs int32
+	h := funcH{
+		handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+			switch msg {
+			case "tick":
+				ctx.Self().StartTicker(5 * time.Millisecond)
+			case "untick":
+				ctx.Self().StopTicker()
+			case "panic":
+				panic("boom")
+			case "stop":
+				return NewStopRet(nil, nil)
+			}
+			return NewGenRet(msg, nil)
+		},
+		tick: func(ctx ActorCtx) ActorRet {
+			atomic.AddInt32(&ticks, 1)
+			return NewGenRet(nil, nil)
+		},
+		timeout: func(ctx ActorCtx) ActorRet {
+			atomic.AddInt32(&outs, 1)
+			return NewGenRet(nil, nil)
+		},
+	}
+	a := startFunc(t, &Actor{Sched: sc, DefaultOut: 10 * time.Millisecond}, "sct_events", h)
+
+	a.Cast("tick")
+	waitFor(t, "ticks", func() bool { return atomic.LoadInt32(&ticks) >= 3 })
+	a.Cast("untick")
+	if reply, err := a.Call("sync"); reply != "sync" || err != nil {
+		t.Fatalf("call: %v %v", reply, err)
+	}
+	stopped := atomic.LoadInt32(&ticks)
+	waitFor(t, "idle timeout", func() bool { return atomic.LoadInt32(&outs) >= 1 })
+	if n := atomic.LoadInt32(&ticks); n > stopped+1 {
+		t.Fatalf("%v ticks after StopTicker", n-stopped)
+	}
+
+	// a panic is skipped as in the own goroutine loop
+	a.Cast("panic")
+	if reply, err := a.Call(1); reply != 1 || err != nil {
+		t.Fatalf("call after panic: %v %v", reply, err)
+	}
+
+	a.Cast("stop")
+	select {
+	case <-a.Done():
+	case <-time.After(time.Second):
+		t.Fatal("not stopped")
+	}
+	if err := a.Stop(StopReasonShutdown, time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,274 @@
+/*
+ * @Date: 2026-10-17 17:48:26
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 17:48:26
+ * @FilePath: /vlgo/gen/shard.go
+ * @Description: entity actors started on demand by id and passivated when idle
+ */
+package gen
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+	"github.com/LiPengfei/vlgo/timerpool"
+)
+
+const (
+	logShard     = "Shard"
+	logPassivate = "Passivate"
+)
+
+// ShardOpts options of NewShard
+type ShardOpts struct {
+	// Idle passivate an entity without any event for Idle, by the actor DefaultOut. 0 never passivate
+	Idle time.Duration
+	// MaxEntities evict the least recently used entity when more are live, 0 no limit
+	MaxEntities int
+
+	InitMsg interface{}
+	Sched   *Scheduler
+	// Wheel timers of entities, see Actor.Wheel
+	Wheel *timerpool.Wheel
+
+	// Factory create the handler and state of entity id, handler Stop is the place to persist state,
+	// it receive StopReasonPassivate when the entity is passivated or evicted
+	Factory func(id string) (ActorHandlerI, interface{})
+}
+
+type entity struct {
+	id    string
+	actor *Actor
+	err   ecode.VEI
+	elem  *list.Element // nil once evicted
+
+	ready chan struct{} // closed after Start returned
+	gone  chan struct{} // closed after the actor exited and left the shard
+}
+
+// Shard one actor per entity id named name/id. Entities start on the first message, a message
+// racing with passivation wait the old actor exit and go to a new one
+type Shard struct {
+	name string
+	opts ShardOpts
+
+	mu       sync.Mutex
+	entities map[string]*entity
+	lru      *list.List // front most recently used
+	closed   bool
+}
+
+// NewShard create an empty shard
+func NewShard(name string, opts ShardOpts) *Shard {
+	return &Shard{
+		name:     name,
+		opts:     opts,
+		entities: make(map[string]*entity),
+		lru:      list.New(),
+	}
+}
+
+// Ask call entity id, start it if not live
+func (sh *Shard) Ask(id string, msg interface{}) (interface{}, ecode.VEI) {
+	return sh.AskCtx(context.Background(), id, msg)
+}
+
+// AskCtx Ask with ctx deadline, genTimeOut if no deadline
+func (sh *Shard) AskCtx(ctx context.Context, id string, msg interface{}) (ret interface{}, err ecode.VEI) {
+	err = sh.route(id, func(a *Actor) ecode.VEI {
+		ret, err = a.CallCtx(ctx, msg)
+		return err
+	})
+	return ret, err
+}
+
+// Tell cast to entity id, start it if not live
+func (sh *Shard) Tell(id string, msg interface{}) ecode.VEI {
+	return sh.route(id, func(a *Actor) ecode.VEI {
+		return a.Cast(msg)
+	})
+}
+
+// Passivate stop entity id now if live
+func (sh *Shard) Passivate(id string) ecode.VEI {
+	sh.mu.Lock()
+	e := sh.entities[id]
+	if e != nil {
+		sh.evict(e)
+	}
+	sh.mu.Unlock()
+
+	if e == nil {
+		return nil
+	}
+	return sh.stopEntity(e)
+}
+
+// Live number of live entities, evicted ones still stopping are not counted
+func (sh *Shard) Live() int {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return sh.lru.Len()
+}
+
+// Stop passivate all entities, later messages got ErrActorStopped
+func (sh *Shard) Stop() {
+	sh.mu.Lock()
+	sh.closed = true
+	var all []*entity
+	for _, e := range sh.entities {
+		if e.elem != nil {
+			sh.evict(e)
+			all = append(all, e)
+		}
+	}
+	sh.mu.Unlock()
+
+	for _, e := range all {
+		sh.stopEntity(e)
+	}
+}
+
+// route send by f to the live actor of id, again to a new actor while the old one stopped before
+// taking the mail, until the shard stops. A mail taken by a stopping actor is never sent twice
+func (sh *Shard) route(id string, f func(a *Actor) ecode.VEI) ecode.VEI {
+	for {
+		e, err := sh.entity(id)
+		if err != nil {
+			return err
+		}
+		if err = f(e.actor); err != errNotHandled {
+			return err
+		}
+		<-e.gone
+	}
+}
+
+// entity find or start the entity of id
+func (sh *Shard) entity(id string) (*entity, ecode.VEI) {
+	for {
+		sh.mu.Lock()
+		if sh.closed {
+			sh.mu.Unlock()
+			return nil, ecode.ErrActorStopped
+		}
+
+		e := sh.entities[id]
+		if e != nil && e.elem == nil {
+			// evicted, still stopping
+			sh.mu.Unlock()
+			<-e.gone
+			continue
+		}
+		if e != nil {
+			sh.lru.MoveToFront(e.elem)
+			sh.mu.Unlock()
+
+			<-e.ready
+			if e.err != nil {
+				return nil, e.err
+			}
+			return e, nil
+		}
+
+		e = &entity{id: id, ready: make(chan struct{}), gone: make(chan struct{})}
+		e.elem = sh.lru.PushFront(e)
+		sh.entities[id] = e
+		var victims []*entity
+		for sh.opts.MaxEntities > 0 && sh.lru.Len() > sh.opts.MaxEntities {
+			victim := sh.lru.Back().Value.(*entity)
+			sh.evict(victim)
+			victims = append(victims, victim)
+		}
+		sh.mu.Unlock()
+
+		for _, v := range victims {
+			log.Infof(logShard, logPassivate, "%v evict %v, live over %v", sh.name, v.id, sh.opts.MaxEntities)
+			// messages to the victim wait it gone, not this one
+			go sh.stopEntity(v)
+		}
+
+		sh.startEntity(e)
+		if e.err != nil {
+			return nil, e.err
+		}
+		return e, nil
+	}
+}
+
+func (sh *Shard) startEntity(e *entity) {
+	defer close(e.ready)
+
+	handle, state := sh.opts.Factory(e.id)
+	a := &Actor{DefaultOut: sh.opts.Idle, Sched: sh.opts.Sched, Wheel: sh.opts.Wheel}
+	a.onExit(func(reason string, err ecode.VEI) {
+		sh.remove(e)
+	})
+
+	if _, err := a.Start(Ctx(sh.name+"/"+e.id), sh.opts.InitMsg, state, entityHandler{handle, sh.opts.Idle}); err != nil {
+		log.Errorf(logShard, logStart, "%v start entity %v failed: %v", sh.name, e.id, err)
+		e.err = err
+		if err == ecode.ErrActorNameExists {
+			// never ran
+			sh.remove(e)
+			return
+		}
+		// the actor may still be in Init and hold its name, forgotten once it exited
+		sh.mu.Lock()
+		sh.evict(e)
+		sh.mu.Unlock()
+		go a.Stop(stopReasonPassivate, 0)
+		return
+	}
+	e.actor = a
+}
+
+// stopEntity wait start finished then stop the actor
+func (sh *Shard) stopEntity(e *entity) ecode.VEI {
+	<-e.ready
+	if e.actor == nil {
+		return nil
+	}
+	return e.actor.Stop(stopReasonPassivate, 0)
+}
+
+// evict called with mu locked, e stay in entities until its actor exited
+func (sh *Shard) evict(e *entity) {
+	if e.elem != nil {
+		sh.lru.Remove(e.elem)
+		e.elem = nil
+	}
+}
+
+func (sh *Shard) remove(e *entity) {
+	sh.mu.Lock()
+	sh.evict(e)
+	if sh.entities[e.id] == e {
+		delete(sh.entities, e.id)
+	}
+	select {
+	case <-e.gone:
+	default:
+		close(e.gone)
+	}
+	sh.mu.Unlock()
+}
+
+// entityHandler passivate on idle timeout instead of calling the entity Timeout
+type entityHandler struct {
+	ActorHandlerI
+	idle time.Duration
+}
+
+func (h entityHandler) Timeout(ctx ActorCtx, state interface{}) ActorRet {
+	if h.idle == 0 {
+		return h.ActorHandlerI.Timeout(ctx, state)
+	}
+
+	log.Debugf(logShard, logPassivate, "%v idle over %v", ctx.Name(), h.idle)
+	ctx.Self().stopReason = stopReasonPassivate
+	return NewStopRet(nil, nil)
+}
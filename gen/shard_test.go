@@ -0,0 +1,223 @@
+/*
+ * @Date: 2026-10-18 18:52:37
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 18:52:37
+ * @FilePath: /vlgo/gen/shard_test.go
+ * @Description: entities on demand, passivation, eviction, init failures and stop
+ */
+package gen
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+	"github.com/LiPengfei/vlgo/utils/clock"
+)
+
+// counterEntities entities counting their msgs, the count saved by id on stop
+type counterEntities struct {
+	mu    sync.Mutex
+	saved map[string]int
+	// stopGate held by Stop of entities when not nil
+	stopGate chan struct{}
+}
+
+func (c *counterEntities) factory(id string) (ActorHandlerI, interface{}) {
+	n := 0
+	return funcH{
+		handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+			n++
+			return NewGenRet(n, nil)
+		},
+		stop: func(ctx ActorCtx, reason interface{}) {
+			if c.stopGate != nil {
+				<-c.stopGate
+			}
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.saved[id+" "+reason.(string)] = n
+		},
+	}, nil
+}
+
+func (c *counterEntities) savedAs(key string) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, ok := c.saved[key]
+	return n, ok
+}
+
+func startTestShard(t *testing.T, name string, opts ShardOpts, c *counterEntities) *Shard {
+	t.Helper()
+	if opts.Factory == nil {
+		opts.Factory = c.factory
+	}
+	sh := NewShard(name, opts)
+	t.Cleanup(sh.Stop)
+	return sh
+}
+
+func TestShard(t *testing.T) {
+	c := &counterEntities{saved: map[string]int{}}
+	sh := startTestShard(t, "sht", ShardOpts{}, c)
+	for i := 1; i <= 3; i++ {
+		if n, err := sh.Ask("a", "x"); n != i || err != nil {
+			t.Fatalf("ask %v %v", n, err)
+		}
+	}
+	if err := sh.Tell("b", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := WhereIs("sht/a"); !ok || a == nil {
+		t.Fatal("entity not named sht/a")
+	}
+	if sh.Live() != 2 {
+		t.Fatalf("live %v", sh.Live())
+	}
+
+	// passivated state is saved, the next msg starts a new actor
+	if err := sh.Passivate("a"); err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := c.savedAs("a passivate"); !ok || n != 3 {
+		t.Fatalf("saved %v", c.saved)
+	}
+	if n, err := sh.Ask("a", "x"); n != 1 || err != nil {
+		t.Fatalf("ask after passivate %v %v", n, err)
+	}
+
+	sh.Stop()
+	if _, err := sh.Ask("a", "x"); err != ecode.ErrActorStopped {
+		t.Fatalf("ask after stop: %v", err)
+	}
+	if sh.Live() != 0 {
+		t.Fatalf("live %v", sh.Live())
+	}
+	if _, ok := c.savedAs("b passivate"); !ok {
+		t.Fatalf("saved %v", c.saved)
+	}
+}
+
+func TestShardIdle(t *testing.T) {
+	c := &counterEntities{saved: map[string]int{}}
+	sh := startTestShard(t, "sht_idle", ShardOpts{Idle: 20 * time.Millisecond}, c)
+	sh.Ask("a", "x")
+	sh.Ask("a", "x")
+	waitFor(t, "passivated", func() bool { return sh.Live() == 0 })
+	waitFor(t, "saved", func() bool {
+		n, ok := c.savedAs("a passivate")
+		return ok && n == 2
+	})
+}
+
+// the least recently used entity is evicted without holding the msg to the new one
+func TestShardEvict(t *testing.T) {
+	c := &counterEntities{saved: map[string]int{}, stopGate: make(chan struct{})}
+	sh := startTestShard(t, "sht_evict", ShardOpts{MaxEntities: 2}, c)
+	sh.Ask("a", "x")
+	sh.Ask("b", "x")
+	sh.Ask("a", "x")
+
+	// b is evicted and stays in its Stop meanwhile
+	done := make(chan interface{}, 1)
+	go func() {
+		n, _ := sh.Ask("c", "x")
+		done <- n
+	}()
+	if n := recvMsg(t, done, "ask while evicting"); n != 1 {
+		t.Fatalf("ask %v", n)
+	}
+	if sh.Live() != 2 {
+		t.Fatalf("live %v", sh.Live())
+	}
+
+	// a msg to b waits for the old actor gone
+	go func() {
+		n, _ := sh.Ask("b", "x")
+		done <- n
+	}()
+	select {
+	case n := <-done:
+		t.Fatalf("ask to the evicted entity answered %v while it stops", n)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(c.stopGate)
+	if n := recvMsg(t, done, "ask after evicted"); n != 1 {
+		t.Fatalf("ask %v", n)
+	}
+	if n, ok := c.savedAs("b passivate"); !ok || n != 1 {
+		t.Fatalf("saved %v", c.saved)
+	}
+}
+
+// many callers of one new entity share a single actor
+func TestShardConcurrent(t *testing.T) {
+	c := &counterEntities{saved: map[string]int{}}
+	sh := startTestShard(t, "sht_conc", ShardOpts{}, c)
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := sh.Ask("a", "x"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n, err := sh.Ask("a", "x"); n != 31 || err != nil {
+		t.Fatalf("ask %v %v", n, err)
+	}
+}
+
+// an entity timed out in Init is stopped, the next msg gets a new actor under the same name
+func TestShardInitTimeout(t *testing.T) {
+	fc := clock.NewFake(time.Now())
+	restore := clock.Set(fc)
+	defer restore()
+
+	gate := make(chan struct{})
+	first := true
+	sh := startTestShard(t, "sht_init", ShardOpts{Factory: func(id string) (ActorHandlerI, interface{}) {
+		h := echoFuncH()
+		if first {
+			first = false
+			h.init = func(ctx ActorCtx, msg interface{}) ActorRet {
+				<-gate
+				return NewGenRet(nil, nil)
+			}
+		}
+		return h, nil
+	}}, nil)
+
+	errs := make(chan ecode.VEI, 1)
+	go func() {
+		_, err := sh.Ask("a", "x")
+		errs <- err
+	}()
+	fc.BlockUntil(1)
+	fc.Advance(GenInitTimeout)
+	if err := recvMsg(t, errs, "init timeout"); err != ecode.ErrActorInitTimeout {
+		t.Fatalf("ask %v", err)
+	}
+
+	replies := make(chan interface{}, 1)
+	go func() {
+		reply, err := sh.Ask("a", "again")
+		if err != nil {
+			reply = err
+		}
+		replies <- reply
+	}()
+	select {
+	case reply := <-replies:
+		t.Fatalf("ask answered %v while the timed out actor holds the name", reply)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(gate)
+	if reply := recvMsg(t, replies, "ask after init timeout"); reply != "again" {
+		t.Fatalf("ask %v", reply)
+	}
+}
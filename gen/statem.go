@@ -0,0 +1,269 @@
+/*
+ * @Date: 2026-10-17 14:05:37
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 14:05:37
+ * @FilePath: /vlgo/gen/statem.go
+ * @Description: finite state machine behaviour on top of Actor, like erlang gen_statem
+ */
+package gen
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+const logStatem = "Statem"
+
+// StateHandler handle one event in a state, data is the state machine data passed to Start
+type StateHandler func(ctx ActorCtx, msg interface{}, data interface{}) Transition
+
+// StateCallback called on entering a state with the previous one, or on exiting with the next one
+type StateCallback func(ctx ActorCtx, other string, data interface{})
+
+// StateTimeout delivered as an event when the state timeout of Transition.Timeout expired,
+// register a handler with On(state, &StateTimeout{}, h) to receive it
+type StateTimeout struct {
+	Msg interface{}
+}
+
+// Transition result of a StateHandler, build by Keep/Next/Postpone/StopState
+type Transition struct {
+	next     string
+	ret      interface{}
+	err      ecode.VEI
+	timeout  time.Duration
+	tmMsg    interface{}
+	postpone bool
+	stop     bool
+}
+
+// Keep stay in current state and reply ret, err to caller
+func Keep(ret interface{}, err ecode.VEI) Transition {
+	return Transition{ret: ret, err: err}
+}
+
+// Next move to state and reply ret, err to caller
+func Next(state string, ret interface{}, err ecode.VEI) Transition {
+	return Transition{next: state, ret: ret, err: err}
+}
+
+// Postpone keep the event and deliver it again after the next state change, caller keep waiting
+func Postpone() Transition {
+	return Transition{postpone: true}
+}
+
+// StopState reply ret, err to caller and stop the state machine with err
+func StopState(ret interface{}, err ecode.VEI) Transition {
+	return Transition{ret: ret, err: err, stop: true}
+}
+
+// Timeout deliver StateTimeout{msg} after d unless the state changed before, a new Timeout replace the old one
+func (t Transition) Timeout(d time.Duration, msg interface{}) Transition {
+	t.timeout, t.tmMsg = d, msg
+	return t
+}
+
+type smKey struct {
+	state string
+	typ   reflect.Type
+}
+
+// smEvent an event waiting to be handled again, ctx keep the caller for postponed calls
+type smEvent struct {
+	ctx ActorCtx
+	msg interface{}
+}
+
+// smTimeout state timeout fired, stale if seq changed
+type smTimeout struct {
+	seq uint64
+	msg interface{}
+}
+
+type smGetState struct{}
+
+// StateMachine dispatch events by (state, message type). Register handlers and callbacks before Start,
+// they are not safe to change once running
+type StateMachine struct {
+	*Actor
+
+	state    string
+	data     interface{}
+	handlers map[smKey]StateHandler
+	enter    map[string]StateCallback
+	exit     map[string]StateCallback
+
+	postponed []smEvent
+	tmSeq     uint64
+	tm        *ActorTimer
+}
+
+// NewStateMachine create a state machine start in initial state
+func NewStateMachine(initial string) *StateMachine {
+	return &StateMachine{
+		state:    initial,
+		handlers: make(map[smKey]StateHandler),
+		enter:    make(map[string]StateCallback),
+		exit:     make(map[string]StateCallback),
+	}
+}
+
+// On handle messages of the same type as sample in state
+func (sm *StateMachine) On(state string, sample interface{}, h StateHandler) *StateMachine {
+	sm.handlers[smKey{state, reflect.TypeOf(sample)}] = h
+	return sm
+}
+
+// OnAny handle messages without a handler by type in state
+func (sm *StateMachine) OnAny(state string, h StateHandler) *StateMachine {
+	sm.handlers[smKey{state: state}] = h
+	return sm
+}
+
+// OnEnter f called after moving into state, also for the initial state on Start
+func (sm *StateMachine) OnEnter(state string, f StateCallback) *StateMachine {
+	sm.enter[state] = f
+	return sm
+}
+
+// OnExit f called before leaving state
+func (sm *StateMachine) OnExit(state string, f StateCallback) *StateMachine {
+	sm.exit[state] = f
+	return sm
+}
+
+// Start start the actor loop, set sm.Actor before Start to run with actor options like Sched
+func (sm *StateMachine) Start(ctx ActorCtx, data interface{}) ecode.VEI {
+	if sm.Actor == nil {
+		sm.Actor = &Actor{}
+	}
+	sm.data = data
+	_, err := sm.Actor.Start(ctx, nil, sm, smHandler{})
+	return err
+}
+
+// CurrentState ask the running state machine its state
+func (sm *StateMachine) CurrentState() (string, ecode.VEI) {
+	return CallAs[string](sm.Actor, &smGetState{})
+}
+
+type smHandler struct{}
+
+func (smHandler) Init(ctx ActorCtx, msg, state interface{}) ActorRet {
+	sm := state.(*StateMachine)
+	if f := sm.enter[sm.state]; f != nil {
+		f(ctx, "", sm.data)
+	}
+	return NewGenRet(nil, nil)
+}
+
+func (smHandler) Handle(ctx ActorCtx, msg interface{}, state interface{}) ActorRet {
+	sm := state.(*StateMachine)
+
+	switch msg := msg.(type) {
+	case *smGetState:
+		return NewGenRet(sm.state, nil)
+
+	case *smTimeout:
+		if msg.seq != sm.tmSeq {
+			return NewGenRet(nil, nil)
+		}
+		sm.tm = nil
+		return sm.run(smEvent{ctx, &StateTimeout{msg.msg}})
+
+	default:
+		return sm.run(smEvent{ctx, msg})
+	}
+}
+
+func (smHandler) Stop(ctx ActorCtx, msg interface{}, state interface{}) {
+	sm := state.(*StateMachine)
+	sm.cancelTimeout()
+	sm.postponed = nil
+}
+
+func (smHandler) Tick(ctx ActorCtx, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func (smHandler) Timeout(ctx ActorCtx, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+// run handle ev and the postponed events released by state changes, replies are sent here
+// so events handled again later can still reach their callers
+func (sm *StateMachine) run(ev smEvent) ActorRet {
+	queue := []smEvent{ev}
+	for len(queue) > 0 {
+		ev, queue = queue[0], queue[1:]
+
+		t := sm.dispatch(ev)
+		if t.postpone {
+			sm.postponed = append(sm.postponed, ev)
+			continue
+		}
+
+		if isCall(ev.ctx) {
+			ev.ctx.caller.SendReply(t.ret, t.err)
+		}
+		if t.stop {
+			return NewStopRet(CallNoRep, t.err)
+		}
+
+		if t.next != "" && t.next != sm.state {
+			sm.transit(ev.ctx, t.next)
+			// postponed events go before the rest, in the order they arrived
+			queue = append(sm.postponed, queue...)
+			sm.postponed = nil
+		}
+		if t.timeout > 0 {
+			sm.setTimeout(t.timeout, t.tmMsg)
+		}
+	}
+	return NewGenRet(CallNoRep, nil)
+}
+
+func (sm *StateMachine) dispatch(ev smEvent) Transition {
+	h := sm.handlers[smKey{sm.state, reflect.TypeOf(ev.msg)}]
+	if h == nil {
+		h = sm.handlers[smKey{state: sm.state}]
+	}
+	if h == nil {
+		log.Errorf(logStatem, logActor, "%v unexpected msg %v in state %v", ev.ctx.Name(), typeName(ev.msg), sm.state)
+		return Keep(nil, ecode.ErrActorMsgType)
+	}
+	return h(ev.ctx, ev.msg, sm.data)
+}
+
+func (sm *StateMachine) transit(ctx ActorCtx, next string) {
+	prev := sm.state
+	sm.cancelTimeout()
+	if f := sm.exit[prev]; f != nil {
+		f(ctx, next, sm.data)
+	}
+	sm.state = next
+	log.Debugf(logStatem, logActor, "%v state %v -> %v", ctx.Name(), prev, next)
+	if f := sm.enter[next]; f != nil {
+		f(ctx, prev, sm.data)
+	}
+}
+
+func (sm *StateMachine) setTimeout(d time.Duration, msg interface{}) {
+	sm.cancelTimeout()
+	sm.tm = sm.AfterCast(d, &smTimeout{seq: sm.tmSeq, msg: msg})
+}
+
+// cancelTimeout stop the timer, a timeout already in mailbox is dropped by seq
+func (sm *StateMachine) cancelTimeout() {
+	sm.tmSeq++
+	if sm.tm != nil {
+		sm.tm.Stop()
+		sm.tm = nil
+	}
+}
+
+func isCall(ctx ActorCtx) bool {
+	return ctx.caller.ch != nil
+}
@@ -0,0 +1,190 @@
+/*
+ * @Date: 2026-10-18 17:41:15
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 17:41:15
+ * @FilePath: /vlgo/gen/statem_test.go
+ * @Description: state machine transitions, callbacks, postponed events and state timeouts
+ */
+package gen
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+type doorData struct {
+	mu     sync.Mutex
+	events []string
+	relock time.Duration
+}
+
+func (d *doorData) add(ev string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.events = append(d.events, ev)
+}
+
+func (d *doorData) take() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	events := d.events
+	d.events = nil
+	return events
+}
+
+type doorPush struct{ n int }
+
+// startDoor locked until "1234", pushes postponed while locked, open relocks after relock or on "lock"
+func startDoor(t *testing.T, name string, d *doorData) *StateMachine {
+	t.Helper()
+	sm := NewStateMachine("locked").
+		OnEnter("locked", func(ctx ActorCtx, other string, data interface{}) {
+			data.(*doorData).add("enter locked from " + other)
+		}).
+		OnExit("locked", func(ctx ActorCtx, other string, data interface{}) {
+			data.(*doorData).add("exit locked to " + other)
+		}).
+		On("locked", "", func(ctx ActorCtx, msg interface{}, data interface{}) Transition {
+			if msg == "1234" {
+				return Next("open", "opened", nil).Timeout(data.(*doorData).relock, "relock")
+			}
+			return Keep("wrong code", nil)
+		}).
+		On("locked", &doorPush{}, func(ctx ActorCtx, msg interface{}, data interface{}) Transition {
+			return Postpone()
+		}).
+		On("open", &doorPush{}, func(ctx ActorCtx, msg interface{}, data interface{}) Transition {
+			data.(*doorData).add(fmt.Sprint("push ", msg.(*doorPush).n))
+			return Keep(msg.(*doorPush).n, nil)
+		}).
+		On("open", "", func(ctx ActorCtx, msg interface{}, data interface{}) Transition {
+			switch msg {
+			case "lock":
+				return Next("locked", "locked", nil)
+			case "break":
+				return StopState("broken", ecode.ErrActorStopped)
+			}
+			return Keep("already open", nil)
+		}).
+		On("open", &StateTimeout{}, func(ctx ActorCtx, msg interface{}, data interface{}) Transition {
+			data.(*doorData).add("timeout " + msg.(*StateTimeout).Msg.(string))
+			return Next("locked", nil, nil)
+		})
+	if err := sm.Start(Ctx(name), d); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sm.Stop(StopReasonShutdown, 0) })
+	return sm
+}
+
+func expectState(t *testing.T, sm *StateMachine, want string) {
+	t.Helper()
+	if state, err := sm.CurrentState(); state != want || err != nil {
+		t.Fatalf("state %v %v, want %v", state, err, want)
+	}
+}
+
+func TestStateMachine(t *testing.T) {
+	d := &doorData{relock: time.Minute}
+	sm := startDoor(t, "smt_door", d)
+	expectState(t, sm, "locked")
+
+	if reply, _ := sm.Call("0000"); reply != "wrong code" {
+		t.Fatalf("wrong code: %v", reply)
+	}
+	if reply, _ := sm.Call("1234"); reply != "opened" {
+		t.Fatalf("code: %v", reply)
+	}
+	expectState(t, sm, "open")
+	if reply, _ := sm.Call("1234"); reply != "already open" {
+		t.Fatalf("open again: %v", reply)
+	}
+	if reply, _ := sm.Call("lock"); reply != "locked" {
+		t.Fatalf("lock: %v", reply)
+	}
+	expectState(t, sm, "locked")
+
+	// no handler for the type in this state
+	if _, err := sm.Call(1.5); err != ecode.ErrActorMsgType {
+		t.Fatalf("unknown msg: %v", err)
+	}
+
+	want := []string{"enter locked from ", "exit locked to open", "enter locked from open"}
+	if events := d.take(); len(events) != len(want) || events[0] != want[0] || events[1] != want[1] || events[2] != want[2] {
+		t.Fatalf("events %v", events)
+	}
+}
+
+// postponed events wait for the next state change and keep their order and callers
+func TestStateMachinePostpone(t *testing.T) {
+	d := &doorData{relock: time.Minute}
+	sm := startDoor(t, "smt_postpone", d)
+	replies := make([]chan interface{}, 3)
+	for i := range replies {
+		n, ch := i+1, make(chan interface{}, 1)
+		replies[i] = ch
+		go func() {
+			reply, _ := sm.Call(&doorPush{n})
+			ch <- reply
+		}()
+		waitFor(t, "push postponed", func() bool { return len(sm.PendingCalls()) == n })
+	}
+	select {
+	case reply := <-replies[0]:
+		t.Fatalf("postponed call answered with %v while locked", reply)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	sm.Cast("1234")
+	for i, ch := range replies {
+		if reply := recvMsg(t, ch, "postponed reply"); reply != i+1 {
+			t.Fatalf("postponed reply %v, want %v", reply, i+1)
+		}
+	}
+	if calls := sm.PendingCalls(); len(calls) != 0 {
+		t.Fatalf("pending %+v", calls)
+	}
+	if events := d.take(); len(events) != 5 || events[2] != "push 1" || events[3] != "push 2" || events[4] != "push 3" {
+		t.Fatalf("events %v", events)
+	}
+}
+
+func TestStateMachineTimeout(t *testing.T) {
+	d := &doorData{relock: 20 * time.Millisecond}
+	sm := startDoor(t, "smt_timeout", d)
+	sm.Call("1234")
+	waitFor(t, "relocked", func() bool {
+		state, _ := sm.CurrentState()
+		return state == "locked"
+	})
+	if events := d.take(); len(events) != 4 || events[2] != "timeout relock" {
+		t.Fatalf("events %v", events)
+	}
+
+	// a state change cancels the timeout
+	sm.Call("1234")
+	sm.Call("lock")
+	time.Sleep(40 * time.Millisecond)
+	for _, ev := range d.take() {
+		if ev == "timeout relock" {
+			t.Fatal("timeout fired after the state changed")
+		}
+	}
+}
+
+func TestStateMachineStop(t *testing.T) {
+	sm := startDoor(t, "smt_stop", &doorData{relock: time.Minute})
+	sm.Call("1234")
+	if reply, err := sm.Call("break"); reply != "broken" || err != ecode.ErrActorStopped {
+		t.Fatalf("break: %v %v", reply, err)
+	}
+	select {
+	case <-sm.Done():
+	case <-time.After(time.Second):
+		t.Fatal("not stopped by StopState")
+	}
+}
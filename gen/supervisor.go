@@ -0,0 +1,374 @@
+/*
+ * @Date: 2026-10-17 10:30:12
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 10:30:12
+ * @FilePath: /vlgo/gen/supervisor.go
+ * @Description: supervisor tree for actors
+ */
+package gen
+
+import (
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+	"github.com/LiPengfei/vlgo/timerpool"
+	"github.com/LiPengfei/vlgo/utils/clock"
+)
+
+const (
+	logSup     = "Supervisor"
+	logRestart = "Restart"
+)
+
+const (
+	DefaultSupIntensity = 3
+	DefaultSupPeriod    = 5 * time.Second
+
+	// a child failed to restart is retried after supRetryMin, doubled on each failure up to Period
+	supRetryMin   = 100 * time.Millisecond
+	supRetryTimer = "sup_retry_"
+)
+
+// RestartType decide whether a terminated child should be restarted
+type RestartType int
+
+const (
+	Permanent RestartType = iota // always restart
+	Transient                    // restart only when terminated abnormally (panic or stop with error)
+	Temporary                    // never restart
+)
+
+// Strategy decide which children are restarted when one terminated
+type Strategy int
+
+const (
+	OneForOne  Strategy = iota // only restart the terminated child
+	OneForAll                  // terminate and restart all children
+	RestForOne                 // terminate and restart the terminated child and those started after it
+)
+
+// SupFlags more than Intensity restarts in Period make the supervisor stop and escalate to its parent
+type SupFlags struct {
+	Strategy  Strategy
+	Intensity int
+	Period    time.Duration
+}
+
+// ChildSpec how to start a child actor
+type ChildSpec struct {
+	Name       string
+	Restart    RestartType
+	InitMsg    interface{}
+	DefaultOut time.Duration
+	// Shutdown max time to wait the child stop, stopTimeOut if 0
+	Shutdown time.Duration
+	// Sched run the child on scheduler workers, own goroutine if nil
+	Sched *Scheduler
+	// Wheel timers of the child, see Actor.Wheel
+	Wheel *timerpool.Wheel
+
+	// Factory create the handler and a fresh state on every (re)start
+	Factory func() (ActorHandlerI, interface{})
+}
+
+type supChild struct {
+	spec  ChildSpec
+	actor *Actor
+	retry time.Duration
+}
+
+type supChildExit struct {
+	child  *supChild
+	actor  *Actor
+	reason string
+	err    ecode.VEI
+}
+
+type supStartChild struct {
+	spec ChildSpec
+}
+
+type supTerminateChild struct {
+	name string
+}
+
+type supWhichChildren struct{}
+
+// Supervisor start children from specs and restart them by Strategy when they terminate
+type Supervisor struct {
+	*Actor
+
+	flags    SupFlags
+	specs    []ChildSpec
+	children []*supChild
+	restarts []time.Time
+}
+
+// StartSupervisor start a top level supervisor and all children in specs order
+func StartSupervisor(ctx ActorCtx, flags SupFlags, specs ...ChildSpec) (*Supervisor, ecode.VEI) {
+	sup := newSupervisor(flags, specs)
+	_, err := (&Actor{}).Start(ctx, nil, sup, supHandler{})
+	return sup, err
+}
+
+// SupervisorSpec child spec for a nested supervisor
+func SupervisorSpec(name string, flags SupFlags, specs ...ChildSpec) ChildSpec {
+	return ChildSpec{
+		Name:    name,
+		Restart: Permanent,
+		Factory: func() (ActorHandlerI, interface{}) {
+			return supHandler{}, newSupervisor(flags, specs)
+		},
+	}
+}
+
+func newSupervisor(flags SupFlags, specs []ChildSpec) *Supervisor {
+	if flags.Intensity <= 0 {
+		flags.Intensity = DefaultSupIntensity
+	}
+	if flags.Period <= 0 {
+		flags.Period = DefaultSupPeriod
+	}
+	return &Supervisor{flags: flags, specs: specs}
+}
+
+// StartChild add a child spec and start it
+func (sup *Supervisor) StartChild(spec ChildSpec) (*Actor, ecode.VEI) {
+	ret, err := sup.Call(&supStartChild{spec})
+	a, _ := ret.(*Actor)
+	return a, err
+}
+
+// TerminateChild stop the child and delete its spec
+func (sup *Supervisor) TerminateChild(name string) ecode.VEI {
+	_, err := sup.Call(&supTerminateChild{name})
+	return err
+}
+
+// Children running children by name
+func (sup *Supervisor) Children() map[string]*Actor {
+	ret, _ := sup.Call(&supWhichChildren{})
+	children, _ := ret.(map[string]*Actor)
+	return children
+}
+
+type supHandler struct{}
+
+func (supHandler) Init(ctx ActorCtx, msg, state interface{}) ActorRet {
+	sup := state.(*Supervisor)
+	sup.Actor = ctx.Self()
+
+	for _, spec := range sup.specs {
+		c := &supChild{spec: spec}
+		if err := sup.startChild(c); err != nil {
+			log.Errorf(logSup, logStart, "%v start child %v failed: %v", ctx.Name(), spec.Name, err)
+			return NewStopRet(nil, err)
+		}
+		sup.children = append(sup.children, c)
+	}
+	return NewGenRet(nil, nil)
+}
+
+func (supHandler) Handle(ctx ActorCtx, msg interface{}, state interface{}) ActorRet {
+	sup := state.(*Supervisor)
+
+	switch msg := msg.(type) {
+	case *supChildExit:
+		return sup.handleChildExit(msg)
+
+	case *supStartChild:
+		return NewGenRet(sup.addChild(msg.spec))
+
+	case *supTerminateChild:
+		return NewGenRet(nil, sup.deleteChild(msg.name))
+
+	case *supWhichChildren:
+		children := make(map[string]*Actor, len(sup.children))
+		for _, c := range sup.children {
+			if c.actor != nil {
+				children[c.spec.Name] = c.actor
+			}
+		}
+		return NewGenRet(children, nil)
+
+	default:
+		log.Errorf(logSup, logActor, "%v unexpected msg %v", ctx.Name(), typeName(msg))
+		return NewGenRet(nil, nil)
+	}
+}
+
+func (supHandler) Stop(ctx ActorCtx, msg interface{}, state interface{}) {
+	sup := state.(*Supervisor)
+	sup.terminateChildren(sup.children)
+}
+
+func (supHandler) Tick(ctx ActorCtx, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func (supHandler) Timeout(ctx ActorCtx, state interface{}) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func (sup *Supervisor) startChild(c *supChild) ecode.VEI {
+	handle, state := c.spec.Factory()
+	a := &Actor{DefaultOut: c.spec.DefaultOut, StopOnPanic: true, Sched: c.spec.Sched, Wheel: c.spec.Wheel}
+	a.onExit(func(reason string, err ecode.VEI) {
+		// the child is exiting, a supervisor with a full system lane must not hold it
+		sup.postNoWait(sup.sysBox, &ActorCast{msg: &supChildExit{child: c, actor: a, reason: reason, err: err}})
+	})
+
+	if _, err := a.Start(Ctx(c.spec.Name), c.spec.InitMsg, state, handle); err != nil {
+		return err
+	}
+	c.actor = a
+	c.retry = 0
+	return nil
+}
+
+// terminateChildren stop children in reverse start order and wait them exit
+func (sup *Supervisor) terminateChildren(children []*supChild) {
+	for i := len(children) - 1; i >= 0; i-- {
+		c := children[i]
+		if c.actor == nil {
+			continue
+		}
+
+		a := c.actor
+		c.actor = nil
+		if err := a.Stop(stopReasonShutdown, c.spec.Shutdown); err != nil {
+			log.Errorf(logSup, logActor, "%v terminate child %v failed: %v", sup.Name, c.spec.Name, err)
+		}
+	}
+}
+
+func (sup *Supervisor) handleChildExit(msg *supChildExit) ActorRet {
+	c := msg.child
+	if c.actor != msg.actor || sup.indexOf(c) < 0 {
+		// terminated by supervisor itself, or the child was deleted
+		return NewGenRet(nil, nil)
+	}
+	c.actor = nil
+
+	abnormal := isAbnormalExit(msg.reason, msg.err)
+	log.Infof(logSup, logRestart, "%v child %v exit, reason: %v, err: %v", sup.Name, c.spec.Name, msg.reason, msg.err)
+
+	switch {
+	case c.spec.Restart == Temporary:
+		sup.removeChild(c)
+		return NewGenRet(nil, nil)
+
+	case c.spec.Restart == Transient && !abnormal:
+		return NewGenRet(nil, nil)
+	}
+
+	if !sup.addRestart() {
+		log.Errorf(logSup, logRestart, "%v reached max restart intensity %v in %v, escalate",
+			sup.Name, sup.flags.Intensity, sup.flags.Period)
+		return NewStopRet(nil, ecode.ErrActorMaxRestart)
+	}
+
+	sup.restart(c)
+	return NewGenRet(nil, nil)
+}
+
+// restart terminate the siblings affected by Strategy and start them again in order
+func (sup *Supervisor) restart(c *supChild) {
+	var group []*supChild
+	switch sup.flags.Strategy {
+	case OneForAll:
+		group = append(group, sup.children...)
+	case RestForOne:
+		group = append(group, sup.children[sup.indexOf(c):]...)
+	default:
+		group = append(group, c)
+	}
+
+	sup.terminateChildren(group)
+
+	for _, g := range group {
+		if g != c && g.spec.Restart == Temporary {
+			sup.removeChild(g)
+			continue
+		}
+
+		if err := sup.startChild(g); err != nil {
+			sup.retryLater(g, err)
+		}
+	}
+}
+
+// retryLater restart c again by a timer, counted as another restart. The supervisor never waits on
+// its own mailbox, and a child failing at once does not spin it
+func (sup *Supervisor) retryLater(c *supChild, err ecode.VEI) {
+	c.retry *= 2
+	if c.retry < supRetryMin {
+		c.retry = supRetryMin
+	}
+	if c.retry > sup.flags.Period {
+		c.retry = sup.flags.Period
+	}
+	log.Errorf(logSup, logRestart, "%v restart child %v failed: %v, retry in %v", sup.Name, c.spec.Name, err, c.retry)
+	sup.StartTimer(supRetryTimer+c.spec.Name, c.retry, &supChildExit{child: c, err: err})
+}
+
+// addRestart record one restart, false if intensity exceeded
+func (sup *Supervisor) addRestart() bool {
+	now := clock.Now()
+	restarts := sup.restarts[:0]
+	for _, tm := range sup.restarts {
+		if now.Sub(tm) < sup.flags.Period {
+			restarts = append(restarts, tm)
+		}
+	}
+	sup.restarts = append(restarts, now)
+	return len(sup.restarts) <= sup.flags.Intensity
+}
+
+func (sup *Supervisor) addChild(spec ChildSpec) (*Actor, ecode.VEI) {
+	if sup.findChild(spec.Name) != nil {
+		return nil, ecode.ErrActorChildExists
+	}
+
+	c := &supChild{spec: spec}
+	if err := sup.startChild(c); err != nil {
+		return nil, err
+	}
+	sup.children = append(sup.children, c)
+	return c.actor, nil
+}
+
+func (sup *Supervisor) deleteChild(name string) ecode.VEI {
+	c := sup.findChild(name)
+	if c == nil {
+		return ecode.ErrActorChildNotFound
+	}
+
+	sup.terminateChildren([]*supChild{c})
+	sup.removeChild(c)
+	return nil
+}
+
+func (sup *Supervisor) findChild(name string) *supChild {
+	for _, c := range sup.children {
+		if c.spec.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (sup *Supervisor) removeChild(c *supChild) {
+	if i := sup.indexOf(c); i >= 0 {
+		sup.children = append(sup.children[:i], sup.children[i+1:]...)
+	}
+}
+
+func (sup *Supervisor) indexOf(c *supChild) int {
+	for i, v := range sup.children {
+		if v == c {
+			return i
+		}
+	}
+	return -1
+}
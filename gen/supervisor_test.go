@@ -0,0 +1,231 @@
+/*
+ * @Date: 2026-10-18 15:20:41
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 15:20:41
+ * @FilePath: /vlgo/gen/supervisor_test.go
+ * @Description: restart strategies, restart types, intensity escalation and restart retry
+ */
+package gen
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+// supTestSpec child counting its inits, panics on "panic" and stops on "stop"
+func supTestSpec(name string, restart RestartType, inits *int32) ChildSpec {
+	return ChildSpec{Name: name, Restart: restart, Factory: func() (ActorHandlerI, interface{}) {
+		h := echoFuncH()
+		h.init = func(ctx ActorCtx, msg interface{}) ActorRet {
+			atomic.AddInt32(inits, 1)
+			return NewGenRet(nil, nil)
+		}
+		h.handle = func(ctx ActorCtx, msg interface{}) ActorRet {
+			switch msg {
+			case "panic":
+				panic("boom")
+			case "stop":
+				return NewStopRet(nil, nil)
+			}
+			return NewGenRet(msg, nil)
+		}
+		return h, nil
+	}}
+}
+
+func startTestSup(t *testing.T, name string, flags SupFlags, specs ...ChildSpec) *Supervisor {
+	t.Helper()
+	sup, err := StartSupervisor(Ctx(name), flags, specs...)
+	if err != nil {
+		t.Fatalf("start %v: %v", name, err)
+	}
+	t.Cleanup(func() { sup.Stop(StopReasonShutdown, 0) })
+	return sup
+}
+
+func waitInits(t *testing.T, inits []int32, want ...int32) {
+	t.Helper()
+	waitFor(t, "restarts", func() bool {
+		for i := range want {
+			if atomic.LoadInt32(&inits[i]) != want[i] {
+				return false
+			}
+		}
+		return true
+	})
+	// nothing else restarted late
+	time.Sleep(20 * time.Millisecond)
+	for i := range want {
+		if got := atomic.LoadInt32(&inits[i]); got != want[i] {
+			t.Fatalf("child %v started %v times, want %v", i, got, want[i])
+		}
+	}
+}
+
+func TestSupervisorStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy Strategy
+		want     []int32
+	}{
+		{"one_for_one", OneForOne, []int32{1, 2, 1}},
+		{"one_for_all", OneForAll, []int32{2, 2, 2}},
+		{"rest_for_one", RestForOne, []int32{1, 2, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inits := make([]int32, 3)
+			names := []string{"st_" + tt.name + "_a", "st_" + tt.name + "_b", "st_" + tt.name + "_c"}
+			sup := startTestSup(t, "st_"+tt.name, SupFlags{Strategy: tt.strategy},
+				supTestSpec(names[0], Permanent, &inits[0]),
+				supTestSpec(names[1], Permanent, &inits[1]),
+				supTestSpec(names[2], Permanent, &inits[2]))
+			waitInits(t, inits, 1, 1, 1)
+
+			before := sup.Children()
+			before[names[1]].Cast("panic")
+			waitInits(t, inits, tt.want...)
+
+			after := sup.Children()
+			for i, name := range names {
+				if restarted := after[name] != before[name]; restarted != (tt.want[i] == 2) {
+					t.Fatalf("%v restarted %v", name, restarted)
+				}
+				if reply, err := after[name].Call("hi"); reply != "hi" || err != nil {
+					t.Fatalf("call %v: %v %v", name, reply, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSupervisorRestartType(t *testing.T) {
+	inits := make([]int32, 3)
+	sup := startTestSup(t, "st_types", SupFlags{},
+		supTestSpec("st_perm", Permanent, &inits[0]),
+		supTestSpec("st_trans", Transient, &inits[1]),
+		supTestSpec("st_temp", Temporary, &inits[2]))
+	children := sup.Children()
+
+	// a normal stop restarts only a permanent child, a temporary one is forgotten
+	children["st_perm"].Cast("stop")
+	children["st_trans"].Cast("stop")
+	children["st_temp"].Cast("stop")
+	waitInits(t, inits, 2, 1, 1)
+	if children = sup.Children(); len(children) != 1 || children["st_perm"] == nil {
+		t.Fatalf("children %v", children)
+	}
+
+	// a transient child is restarted after a crash
+	if err := sup.TerminateChild("st_trans"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sup.StartChild(supTestSpec("st_trans", Transient, &inits[1])); err != nil {
+		t.Fatal(err)
+	}
+	waitInits(t, inits, 2, 2, 1)
+	sup.Children()["st_trans"].Cast("panic")
+	waitInits(t, inits, 2, 3, 1)
+}
+
+func TestSupervisorChildren(t *testing.T) {
+	var inits int32
+	sup := startTestSup(t, "st_dyn", SupFlags{})
+	a, err := sup.StartChild(supTestSpec("st_dyn_a", Permanent, &inits))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if children := sup.Children(); len(children) != 1 || children["st_dyn_a"] != a {
+		t.Fatalf("children %v", children)
+	}
+	if err := sup.TerminateChild("st_dyn_a"); err != nil {
+		t.Fatal(err)
+	}
+	if !a.IsStopped.Load() || len(sup.Children()) != 0 {
+		t.Fatal("child left after TerminateChild")
+	}
+
+	// stopping the supervisor stops its children
+	b, err := sup.StartChild(supTestSpec("st_dyn_b", Permanent, &inits))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup.Stop(StopReasonShutdown, 0)
+	if !b.IsStopped.Load() {
+		t.Fatal("child running after its supervisor stopped")
+	}
+}
+
+// more than Intensity restarts in Period stop the supervisor, and its parent restarts it
+func TestSupervisorIntensity(t *testing.T) {
+	var inits int32
+	flags := SupFlags{Intensity: 2, Period: time.Minute}
+	sup := startTestSup(t, "st_intensity", flags, supTestSpec("st_crashy", Permanent, &inits))
+
+	for i := 1; i <= 2; i++ {
+		sup.Children()["st_crashy"].Cast("panic")
+		waitFor(t, "restart", func() bool { return atomic.LoadInt32(&inits) == int32(i+1) })
+	}
+	sup.Children()["st_crashy"].Cast("panic")
+	select {
+	case <-sup.Done():
+	case <-time.After(time.Second):
+		t.Fatal("supervisor not stopped by restart intensity")
+	}
+
+	var leaf int32
+	top := startTestSup(t, "st_top", SupFlags{Intensity: 5, Period: time.Minute},
+		SupervisorSpec("st_nested", flags, supTestSpec("st_leaf", Permanent, &leaf)))
+	nested := top.Children()["st_nested"]
+	for i := 0; i < 3; i++ {
+		a, _ := WhereIs("st_leaf")
+		a.Cast("panic")
+		want := int32(i + 2)
+		waitFor(t, "leaf restart", func() bool { return atomic.LoadInt32(&leaf) == want })
+	}
+	waitFor(t, "nested restarted", func() bool {
+		a, ok := top.Children()["st_nested"]
+		return ok && a != nested
+	})
+	if a, ok := WhereIs("st_leaf"); !ok || a.IsStopped.Load() {
+		t.Fatal("leaf not running after its supervisor restarted")
+	}
+}
+
+// a child failing to restart is retried later, the supervisor keeps answering meanwhile
+func TestSupervisorRestartRetry(t *testing.T) {
+	var inits, fails int32
+	spec := supTestSpec("st_retry", Permanent, &inits)
+	factory := spec.Factory
+	spec.Factory = func() (ActorHandlerI, interface{}) {
+		h, state := factory()
+		fh := h.(funcH)
+		init := fh.init
+		fh.init = func(ctx ActorCtx, msg interface{}) ActorRet {
+			if atomic.LoadInt32(&inits) > 0 && atomic.AddInt32(&fails, 1) <= 2 {
+				return NewStopRet(nil, ecode.ErrActorStopped)
+			}
+			return init(ctx, msg)
+		}
+		return fh, state
+	}
+	sup := startTestSup(t, "st_retrying", SupFlags{Intensity: 10, Period: time.Minute}, spec)
+
+	begin := time.Now()
+	sup.Children()["st_retry"].Cast("panic")
+	waitFor(t, "first restart failed", func() bool { return atomic.LoadInt32(&fails) >= 1 })
+	if children := sup.Children(); len(children) != 0 {
+		t.Fatalf("children %v while retrying", children)
+	}
+	waitFor(t, "restart retried", func() bool { return atomic.LoadInt32(&inits) == 2 })
+	// two failed restarts wait supRetryMin, then twice as long
+	if waited := time.Since(begin); waited < 3*supRetryMin {
+		t.Fatalf("restarted after %v, want backoff of %v", waited, 3*supRetryMin)
+	}
+	if reply, err := sup.Children()["st_retry"].Call("hi"); reply != "hi" || err != nil {
+		t.Fatalf("call restarted: %v %v", reply, err)
+	}
+}
@@ -0,0 +1,201 @@
+/*
+ * @Date: 2026-10-17 22:47:20
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 22:47:20
+ * @FilePath: /vlgo/gen/timer.go
+ * @Description: named one-shot and repeating timers owned by an actor
+ */
+package gen
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+	"github.com/LiPengfei/vlgo/utils/clock"
+)
+
+const logTimer = "Timer"
+
+// TimerInfo one active named timer, Every 0 for one-shot
+type TimerInfo struct {
+	Name   string
+	Msg    interface{}
+	Every  time.Duration
+	FireAt time.Time
+}
+
+type actorTimer struct {
+	TimerInfo
+	seq uint64
+	t   interface{ Stop() bool }
+	// a fire is in mailbox, later fires of a repeating timer are skipped until it is handled or lost
+	queued bool
+}
+
+// timerFired cast by the runtime timer, turned into the timer msg by the loop if still active
+type timerFired struct {
+	name string
+	seq  uint64
+}
+
+type actorTimers struct {
+	mu     sync.Mutex
+	seq    uint64
+	active map[string]*actorTimer
+	closed bool
+}
+
+// StartTimer cast msg to self once after d, restart the timer if name is active
+func (s *Actor) StartTimer(name string, d time.Duration, msg interface{}) {
+	s.startTimer(name, d, 0, msg)
+}
+
+// StartRepeatTimer cast msg to self every d until canceled, restart the timer if name is active.
+// A slow actor does not pile up fires, one is skipped while the previous is in mailbox. The timer
+// is rearmed as it fires, a fire dropped or rejected by the overflow policy never stops it
+func (s *Actor) StartRepeatTimer(name string, every time.Duration, msg interface{}) {
+	if every <= 0 {
+		log.Errorf(logTimer, logActor, "%v repeat timer %v with interval %v", s.Name, name, every)
+		return
+	}
+	s.startTimer(name, every, every, msg)
+}
+
+// CancelTimer stop timer name, a fire already in mailbox is dropped, false if not active
+func (s *Actor) CancelTimer(name string) bool {
+	s.timers.mu.Lock()
+	defer s.timers.mu.Unlock()
+
+	t, ok := s.timers.active[name]
+	if !ok {
+		return false
+	}
+	t.t.Stop()
+	delete(s.timers.active, name)
+	return true
+}
+
+// Timers active timers sorted by name
+func (s *Actor) Timers() []TimerInfo {
+	s.timers.mu.Lock()
+	defer s.timers.mu.Unlock()
+
+	infos := make([]TimerInfo, 0, len(s.timers.active))
+	for _, t := range s.timers.active {
+		infos = append(infos, t.TimerInfo)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+func (s *Actor) startTimer(name string, d, every time.Duration, msg interface{}) {
+	s.timers.mu.Lock()
+	defer s.timers.mu.Unlock()
+
+	if s.timers.closed {
+		log.Warnf(logTimer, logActor, "%v stopped, skip timer %v", s.Name, name)
+		return
+	}
+	if s.timers.active == nil {
+		s.timers.active = make(map[string]*actorTimer)
+	}
+	if old, ok := s.timers.active[name]; ok {
+		old.t.Stop()
+	}
+
+	s.timers.seq++
+	t := &actorTimer{TimerInfo: TimerInfo{Name: name, Msg: msg, Every: every}, seq: s.timers.seq}
+	s.timers.active[name] = t
+	s.armTimer(t, d)
+}
+
+// armTimer called with timers.mu locked
+func (s *Actor) armTimer(t *actorTimer, d time.Duration) {
+	t.FireAt = clock.Now().Add(d)
+	name, seq := t.Name, t.seq
+	f := func() {
+		s.fireTimer(name, seq)
+	}
+	if s.Wheel != nil {
+		t.t = s.Wheel.AfterFunc(d, f)
+		return
+	}
+	t.t = clock.AfterFunc(d, f)
+}
+
+// fireTimer run by the runtime timer, rearm a repeating timer and post the fire unless one is queued
+func (s *Actor) fireTimer(name string, seq uint64) {
+	s.timers.mu.Lock()
+	t, ok := s.timers.active[name]
+	if !ok || t.seq != seq || s.IsStopped.Load() {
+		s.timers.mu.Unlock()
+		return
+	}
+	if t.Every > 0 {
+		// keep the period from the planned fire time, without catching up missed ones
+		d := clock.Until(t.FireAt.Add(t.Every))
+		if d < 0 {
+			d = 0
+		}
+		s.armTimer(t, d)
+	}
+	queued := t.queued
+	t.queued = true
+	s.timers.mu.Unlock()
+
+	if queued {
+		return
+	}
+	// may run in the shared wheel goroutine
+	fired := &timerFired{name: name, seq: seq}
+	s.postNoWaitOr(s.Mailbox, &ActorCast{msg: fired}, func(err ecode.VEI) {
+		s.lostTimer(fired, err)
+	})
+}
+
+// lostTimer a fire dropped or rejected by the mailbox: a one-shot timer is over, a repeating one
+// posts its next fire
+func (s *Actor) lostTimer(fired *timerFired, err error) {
+	s.timers.mu.Lock()
+	defer s.timers.mu.Unlock()
+
+	t, ok := s.timers.active[fired.name]
+	if !ok || t.seq != fired.seq || !t.queued {
+		return
+	}
+	t.queued = false
+	if t.Every == 0 {
+		delete(s.timers.active, t.Name)
+	}
+	log.Warnf(logTimer, logActor, "%v timer %v fire lost: %v", s.Name, t.Name, err)
+}
+
+// firedTimer msg of the fired timer, ok false if canceled or restarted
+func (s *Actor) firedTimer(fired *timerFired) (interface{}, bool) {
+	s.timers.mu.Lock()
+	defer s.timers.mu.Unlock()
+
+	t, ok := s.timers.active[fired.name]
+	if !ok || t.seq != fired.seq {
+		return nil, false
+	}
+	t.queued = false
+	if t.Every == 0 {
+		delete(s.timers.active, t.Name)
+	}
+	return t.Msg, true
+}
+
+// cancelTimers called when the actor stops
+func (s *Actor) cancelTimers() {
+	s.timers.mu.Lock()
+	defer s.timers.mu.Unlock()
+
+	s.timers.closed = true
+	for _, t := range s.timers.active {
+		t.t.Stop()
+	}
+	s.timers.active = nil
+}
@@ -0,0 +1,163 @@
+/*
+ * @Date: 2026-10-18 19:37:26
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 19:37:26
+ * @FilePath: /vlgo/gen/timer_test.go
+ * @Description: named timers fire, restart, cancel, and repeating timers outlive lost fires
+ */
+package gen
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/utils/clock"
+)
+
+func newTimerClock(t *testing.T) *clock.Fake {
+	t.Helper()
+	fc := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	t.Cleanup(clock.Set(fc))
+	return fc
+}
+
+// advanceTimers move the fake clock by d a millisecond at a time, a call after each step lets a
+// handle the fires
+func advanceTimers(t *testing.T, fc *clock.Fake, a *Actor, d time.Duration) {
+	t.Helper()
+	for ; d > 0; d -= time.Millisecond {
+		fc.Advance(time.Millisecond)
+		if _, err := a.Call("sync"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTimer(t *testing.T) {
+	sc := newTestSched(t, 2, 4)
+	for _, tt := range []struct {
+		name  string
+		sched *Scheduler
+	}{{"tmt_loop", nil}, {"tmt_sched", sc}} {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := newTimerClock(t)
+			got := map[interface{}]int{}
+			gate := make(chan struct{})
+			a := startFunc(t, &Actor{Sched: tt.sched}, tt.name, funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+				switch msg {
+				case "sync":
+				case "block":
+					<-gate
+				default:
+					got[msg]++
+				}
+				return NewGenRet(nil, nil)
+			}})
+
+			a.StartRepeatTimer("beat", 10*time.Millisecond, "beat")
+			a.StartTimer("once", 15*time.Millisecond, "once")
+			a.StartTimer("cancel", 15*time.Millisecond, "cancel")
+			a.StartTimer("restart", 15*time.Millisecond, "old")
+			a.StartTimer("restart", 30*time.Millisecond, "new")
+			if !a.CancelTimer("cancel") || a.CancelTimer("none") {
+				t.Fatal("cancel")
+			}
+			ts := a.Timers()
+			if len(ts) != 3 || ts[0].Name != "beat" || ts[0].Every != 10*time.Millisecond || ts[1].Name != "once" || ts[1].Every != 0 {
+				t.Fatalf("timers %+v", ts)
+			}
+			if ts[2].Msg != "new" || !ts[2].FireAt.Equal(clock.Now().Add(30*time.Millisecond)) {
+				t.Fatalf("restarted %+v", ts[2])
+			}
+
+			advanceTimers(t, fc, a, 100*time.Millisecond)
+			if got["beat"] != 10 || got["once"] != 1 || got["new"] != 1 || got["old"] != 0 || got["cancel"] != 0 {
+				t.Fatalf("got %v", got)
+			}
+			if ts := a.Timers(); len(ts) != 1 || ts[0].Name != "beat" {
+				t.Fatalf("timers %+v", ts)
+			}
+
+			// a fire already in mailbox is dropped by cancel
+			a.Cast("block")
+			fc.Advance(10 * time.Millisecond)
+			a.CancelTimer("beat")
+			close(gate)
+			advanceTimers(t, fc, a, 20*time.Millisecond)
+			if got["beat"] != 10 {
+				t.Fatalf("beat %v after cancel", got["beat"])
+			}
+
+			a.StartTimer("late", time.Millisecond, "late")
+			a.Stop(StopReasonShutdown, 0)
+			if ts := a.Timers(); len(ts) != 0 {
+				t.Fatalf("timers %+v after stop", ts)
+			}
+			a.StartTimer("after", time.Millisecond, "after")
+			if ts := a.Timers(); len(ts) != 0 {
+				t.Fatalf("timer %+v started after stop", ts)
+			}
+		})
+	}
+}
+
+// a slow actor gets one fire of a repeating timer at a time
+func TestRepeatTimerSlow(t *testing.T) {
+	fc := newTimerClock(t)
+	a := &Actor{}
+	gate, got := startGated(t, a, "tmt_slow")
+	a.StartRepeatTimer("beat", 10*time.Millisecond, "beat")
+	fc.Advance(50 * time.Millisecond)
+	close(gate)
+	expectHandled(t, got, 0, 1, 2, "beat")
+	fc.Advance(10 * time.Millisecond)
+	expectHandled(t, got, "beat")
+}
+
+// a fire dropped or rejected by a full mailbox never stops a repeating timer
+func TestRepeatTimerLostFire(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowDropNewest, OverflowReject, OverflowDropOldest} {
+		fc := newTimerClock(t)
+		gate := make(chan struct{})
+		ticks := make(chan interface{}, 16)
+		a := startFunc(t, &Actor{MailboxLen: 1, Overflow: policy}, "", funcH{handle: func(ctx ActorCtx, msg interface{}) ActorRet {
+			switch msg {
+			case "block":
+				<-gate
+			case "tick":
+				ticks <- msg
+			}
+			return NewGenRet(nil, nil)
+		}})
+		a.Cast("block")
+		waitFor(t, "blocked", func() bool { return a.MailboxSize() == 0 })
+		a.Cast("fill")
+		a.StartRepeatTimer("tick", 5*time.Millisecond, "tick")
+		for i := 0; i < 4; i++ {
+			fc.Advance(5 * time.Millisecond)
+			time.Sleep(time.Millisecond)
+		}
+		close(gate)
+
+		for i := 0; i < 3; i++ {
+			deadline := time.Now().Add(time.Second)
+		wait:
+			for {
+				select {
+				case <-ticks:
+					break wait
+				default:
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("policy %v: timer stopped, timers %+v", policy, a.Timers())
+				}
+				fc.Advance(5 * time.Millisecond)
+				time.Sleep(time.Millisecond)
+			}
+		}
+		if ts := a.Timers(); len(ts) != 1 {
+			t.Fatalf("policy %v: timers %+v", policy, ts)
+		}
+		a.Stop(StopReasonShutdown, 0)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+ * @Date: 2026-10-17 11:41:18
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 11:41:18
+ * @FilePath: /vlgo/gen/typed.go
+ * @Description: type safe actor on top of Actor
+ */
+package gen
+
+import (
+	"context"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+const logTyped = "Typed"
+
+// TypedHandlerI like ActorHandlerI, but state, message and reply are checked at compile time.
+// S usually a pointer so Handle can modify it, M can be an interface to accept several message types
+type TypedHandlerI[S, M, R any] interface {
+	Init(ctx ActorCtx, state S) ActorRet
+
+	Handle(ctx ActorCtx, msg M, state S) TypedRet[R]
+	Stop(ctx ActorCtx, reason string, state S)
+	Tick(ctx ActorCtx, state S) ActorRet
+	Timeout(ctx ActorCtx, state S) ActorRet
+}
+
+// TypedRet ActorRet with a typed reply
+type TypedRet[R any] struct {
+	ActorRet
+}
+
+// Reply create a typed sendRet
+func Reply[R any](ret R, err ecode.VEI) TypedRet[R] {
+	return TypedRet[R]{NewGenRet(ret, err)}
+}
+
+// ReplyTime create a typed time sendRet
+func ReplyTime[R any](ret R, err ecode.VEI, tm time.Duration) TypedRet[R] {
+	return TypedRet[R]{NewTimeRet(ret, err, tm)}
+}
+
+// ReplyStop create a typed stop sendRet
+func ReplyStop[R any](ret R, err ecode.VEI) TypedRet[R] {
+	return TypedRet[R]{NewStopRet(ret, err)}
+}
+
+// NoReply reply later by ReplyTo
+func NoReply[R any]() TypedRet[R] {
+	return TypedRet[R]{NewGenRet(CallNoRep, nil)}
+}
+
+// ReplyTo typed ActorCaller.SendReply
+func ReplyTo[R any](caller ActorCaller, ret R, err ecode.VEI) {
+	caller.SendReply(ret, err)
+}
+
+// TypedActor Actor with typed Start/Call/Cast, the embedded Actor still work with untyped api
+type TypedActor[S, M, R any] struct {
+	Actor
+}
+
+// Start method
+func (t *TypedActor[S, M, R]) Start(ctx ActorCtx, state S, handle TypedHandlerI[S, M, R]) ecode.VEI {
+	_, err := t.Actor.Start(ctx, nil, state, typedHandler[S, M, R]{handle})
+	return err
+}
+
+// Cast method
+func (t *TypedActor[S, M, R]) Cast(msg M) ecode.VEI {
+	return t.Actor.Cast(msg)
+}
+
+// Call method
+func (t *TypedActor[S, M, R]) Call(msg M) (R, ecode.VEI) {
+	return CallAs[R](&t.Actor, msg)
+}
+
+// TimeCall method
+func (t *TypedActor[S, M, R]) TimeCall(msg M, overDuration time.Duration) (R, ecode.VEI) {
+	return replyAs[R](t.Actor.TimeCall(msg, overDuration))
+}
+
+// CallCtx method
+func (t *TypedActor[S, M, R]) CallCtx(ctx context.Context, msg M) (R, ecode.VEI) {
+	return replyAs[R](t.Actor.CallCtx(ctx, msg))
+}
+
+// CallAs call an untyped actor and assert the reply as R
+func CallAs[R any](a *Actor, msg interface{}) (R, ecode.VEI) {
+	return replyAs[R](a.Call(msg))
+}
+
+// CastAs cast to an untyped actor, msg type checked at compile time
+func CastAs[M any](a *Actor, msg M) ecode.VEI {
+	return a.Cast(msg)
+}
+
+func replyAs[R any](ret interface{}, err ecode.VEI) (R, ecode.VEI) {
+	var zero R
+	if ret == nil {
+		return zero, err
+	}
+
+	r, ok := ret.(R)
+	if !ok {
+		log.Errorf(logTyped, logReply, "unexpected reply type %T, want %T", ret, zero)
+		if err == nil {
+			err = ecode.ErrActorReplyType
+		}
+		return zero, err
+	}
+	return r, err
+}
+
+// typedHandler adapt TypedHandlerI to ActorHandlerI
+type typedHandler[S, M, R any] struct {
+	h TypedHandlerI[S, M, R]
+}
+
+func (t typedHandler[S, M, R]) Init(ctx ActorCtx, msg, state interface{}) ActorRet {
+	return t.h.Init(ctx, state.(S))
+}
+
+func (t typedHandler[S, M, R]) Handle(ctx ActorCtx, msg interface{}, state interface{}) ActorRet {
+	m, ok := msg.(M)
+	if !ok {
+		log.Errorf(logTyped, logActor, "%v unexpected msg type %T", ctx.Name(), msg)
+		return NewGenRet(nil, ecode.ErrActorMsgType)
+	}
+	return t.h.Handle(ctx, m, state.(S)).ActorRet
+}
+
+func (t typedHandler[S, M, R]) Stop(ctx ActorCtx, msg interface{}, state interface{}) {
+	reason, _ := msg.(string)
+	t.h.Stop(ctx, reason, state.(S))
+}
+
+func (t typedHandler[S, M, R]) Tick(ctx ActorCtx, state interface{}) ActorRet {
+	return t.h.Tick(ctx, state.(S))
+}
+
+func (t typedHandler[S, M, R]) Timeout(ctx ActorCtx, state interface{}) ActorRet {
+	return t.h.Timeout(ctx, state.(S))
+}
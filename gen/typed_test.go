@@ -0,0 +1,140 @@
+/*
+ * @Date: 2026-10-18 15:58:02
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 15:58:02
+ * @FilePath: /vlgo/gen/typed_test.go
+ * @Description: typed actor calls, deferred replies and reply or message type mismatch
+ */
+package gen
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+)
+
+type ttState struct {
+	n       int
+	pending ActorCaller
+	holding bool
+	stopped chan string
+}
+
+// ttMsg messages of the typed counter
+type ttMsg interface{ ttMsg() }
+
+type ttAdd struct{ d int }
+type ttHold struct{}
+type ttRelease struct{}
+type ttQuit struct{}
+
+func (ttAdd) ttMsg()     {}
+func (ttHold) ttMsg()    {}
+func (ttRelease) ttMsg() {}
+func (ttQuit) ttMsg()    {}
+
+// ttCounterH add to the state, hold a caller until released, stop on quit
+type ttCounterH struct{}
+
+func (ttCounterH) Init(ctx ActorCtx, s *ttState) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func (ttCounterH) Handle(ctx ActorCtx, msg ttMsg, s *ttState) TypedRet[int] {
+	switch msg := msg.(type) {
+	case ttAdd:
+		s.n += msg.d
+	case ttHold:
+		s.pending, s.holding = ctx.Caller(), true
+		return NoReply[int]()
+	case ttRelease:
+		ReplyTo(s.pending, s.n, nil)
+	case ttQuit:
+		return ReplyStop(s.n, nil)
+	}
+	return Reply(s.n, nil)
+}
+
+func (ttCounterH) Stop(ctx ActorCtx, reason string, s *ttState) {
+	s.stopped <- reason
+}
+
+func (ttCounterH) Tick(ctx ActorCtx, s *ttState) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func (ttCounterH) Timeout(ctx ActorCtx, s *ttState) ActorRet {
+	return NewGenRet(nil, nil)
+}
+
+func TestTypedActor(t *testing.T) {
+	var a TypedActor[*ttState, ttMsg, int]
+	s := &ttState{stopped: make(chan string, 1)}
+	if err := a.Start(Ctx("tt_counter"), s, ttCounterH{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Stop(StopReasonShutdown, 0) })
+
+	if err := a.Cast(ttAdd{2}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := a.Call(ttAdd{3}); n != 5 || err != nil {
+		t.Fatalf("call: %v %v", n, err)
+	}
+	if n, err := a.TimeCall(ttAdd{1}, time.Second); n != 6 || err != nil {
+		t.Fatalf("time call: %v %v", n, err)
+	}
+
+	// a held call is answered by ReplyTo from a later message
+	held := make(chan int, 1)
+	go func() {
+		n, _ := a.Call(ttHold{})
+		held <- n
+	}()
+	waitFor(t, "call held", func() bool {
+		var holding bool
+		a.ReplaceState(func(state interface{}) interface{} {
+			holding = state.(*ttState).holding
+			return state
+		})
+		return holding
+	})
+	a.Cast(ttAdd{4})
+	a.Cast(ttRelease{})
+	if n := recvMsg(t, held, "deferred reply"); n != 10 {
+		t.Fatalf("deferred reply %v", n)
+	}
+
+	if n, err := a.Call(ttQuit{}); n != 10 || err != nil {
+		t.Fatalf("quit: %v %v", n, err)
+	}
+	if reason := recvMsg(t, s.stopped, "stop"); reason != stopReasonRet {
+		t.Fatalf("stop reason %q", reason)
+	}
+}
+
+func TestTypedMismatch(t *testing.T) {
+	var a TypedActor[*ttState, ttMsg, int]
+	if err := a.Start(Ctx("tt_mismatch"), &ttState{stopped: make(chan string, 1)}, ttCounterH{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Stop(StopReasonShutdown, 0) })
+
+	// through the untyped api a message of another type is rejected, the actor keeps running
+	if _, err := a.Actor.Call("add"); err != ecode.ErrActorMsgType {
+		t.Fatalf("untyped msg: %v", err)
+	}
+	if s, err := CallAs[string](&a.Actor, ttAdd{1}); s != "" || err != ecode.ErrActorReplyType {
+		t.Fatalf("reply as string: %q %v", s, err)
+	}
+	if n, err := CallAs[int](&a.Actor, ttAdd{1}); n != 2 || err != nil {
+		t.Fatalf("reply as int: %v %v", n, err)
+	}
+	if err := CastAs[ttMsg](&a.Actor, ttAdd{1}); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := a.Call(ttAdd{0}); n != 3 {
+		t.Fatalf("state %v", n)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"vlgo/utils"
+	"vlgo/utils/clock"
 )
 
 type WaitReason string
@@ -137,22 +138,33 @@ func (w Waiter) WaitInfinity(reason WaitReason) {
 }
 
 func (w Waiter) Wait(reason WaitReason) {
+	w.WaitTimeout(reason, time.Second*7)
+}
+
+// WaitTimeout wait at most d, false if timeout or waiter not init
+func (w Waiter) WaitTimeout(reason WaitReason, d time.Duration) bool {
 	if w.wg != nil {
 		log.Infof(logSys, logWaiter, "[%s] wait for %v", w.Key, reason)
 
-		waitChan := make(chan struct{}, 0)
+		waitChan := make(chan struct{}, 1)
 		go func() {
 			w.wg.Wait()
 			waitChan <- struct{}{}
 		}()
-		overTimer := time.NewTimer(time.Second * 7)
+		overTimer := clock.NewTimer(d)
+		defer overTimer.Stop()
+
+		ok := false
 		select {
 		case <-waitChan:
-		case <-overTimer.C:
+			ok = true
+		case <-overTimer.C():
 		}
 		log.Infof(logSys, logWaiter, "[%s] wait returned %v", w.Key, reason)
+		return ok
 	} else {
 		log.Errorf(logSys, logWaiter, "waiter not init")
+		return false
 	}
 }
 
@@ -65,7 +65,7 @@ func (lr *Writer) Write(p []byte) (n int, err error) {
 	select {
 	case lr.LogCh <- logBuffer:
 		return
-	case <-t.C:
+	case <-t.C():
 		n = 0
 		_, _ = fmt.Fprintf(os.Stderr, "LogProxy ReceiveLog failed:log=%v\n", logBuffer)
 		err = errLogRoutineWriteFailed
@@ -22,7 +22,8 @@ type SimpleLogger struct {
 	AtomLogLevel zap.AtomicLevel
 }
 
-var SLog *SimpleLogger
+// SLog nop until InitSimpleLog, which sets it in place so packages holding SLog use the new logger
+var SLog = &SimpleLogger{Logger: zap.NewNop(), AtomLogLevel: zap.NewAtomicLevel()}
 
 func (l *SimpleLogger) Debugf(sys, tag, fmts string, infos ...interface{}) {
 	if l.Logger.Core().Enabled(zap.DebugLevel) {
@@ -55,7 +56,7 @@ func InitSimpleLog(fn string, param *InitParam) error {
 	if err != nil {
 		return err
 	}
-	SLog = retLog
+	*SLog = *retLog
 	return nil
 }
 
@@ -105,8 +106,10 @@ func initLog(fn string, param *InitParam) (*SimpleLogger, error) {
 	}
 	ret.AtomLogLevel.SetLevel(lv)
 
-	if l, err := initZapLogger(ret.Dir, fn, param, ret.AtomLogLevel); err != nil {
-		ret.Logger = l
+	l, err := initZapLogger(ret.Dir, fn, param, ret.AtomLogLevel)
+	if err != nil {
+		return nil, err
 	}
+	ret.Logger = l
 	return ret, nil
 }
@@ -13,7 +13,7 @@ fi
 plugin=gogofaster
 tool=protoc-gen-gogofaster
 version=v1.3.2
-protos=(inner_code.proto error_code.proto game.proto)
+protos=(inner_code.proto error_code.proto game.proto node.proto cluster.proto)
 bindir=../bin
 
 function install_tool() {
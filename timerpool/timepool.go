@@ -10,26 +10,32 @@ package timerpool
 import (
 	"sync"
 	"time"
+
+	"github.com/LiPengfei/vlgo/utils/clock"
 )
 
 var globalTimerPool = sync.Pool{}
 
-// GetTimer timer需要在同一个协程接收超时及回收，否则将会出现并发问题
-func GetTimer(d time.Duration) *time.Timer {
-	if t, _ := globalTimerPool.Get().(*time.Timer); t != nil {
-		t.Reset(d)
-		return t
+// GetTimer timer需要在同一个协程接收超时及回收，否则将会出现并发问题。只有真实时钟的timer会被复用
+func GetTimer(d time.Duration) clock.Timer {
+	if clock.IsReal() {
+		if t, _ := globalTimerPool.Get().(*clock.RealTimer); t != nil {
+			t.Reset(d)
+			return t
+		}
 	}
 
-	return time.NewTimer(d)
+	return clock.NewTimer(d)
 }
 
-func PutTimer(t *time.Timer) {
+func PutTimer(t clock.Timer) {
 	if !t.Stop() {
 		select {
-		case <-t.C:
+		case <-t.C():
 		default:
 		}
 	}
-	globalTimerPool.Put(t)
+	if rt, ok := t.(*clock.RealTimer); ok {
+		globalTimerPool.Put(rt)
+	}
 }
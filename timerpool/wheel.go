@@ -0,0 +1,269 @@
+/*
+ * @Author: lipengfei
+ * @Date: 2026-10-17 23:05:41
+ * @LastEditTime: 2026-10-17 23:05:41
+ * @FilePath: /vlgo/timerpool/wheel.go
+ * @Description: hierarchical timing wheel for large numbers of timers
+ */
+package timerpool
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/LiPengfei/vlgo/ecode"
+	"github.com/LiPengfei/vlgo/utils/clock"
+)
+
+const (
+	wheelBits   = 6
+	wheelSlots  = 1 << wheelBits
+	wheelMask   = wheelSlots - 1
+	wheelLevels = 5
+	// wheelSpan ticks covered by all levels, later timers wait in the last level and cascade again
+	wheelSpan = int64(1) << (wheelBits * wheelLevels)
+)
+
+// DefaultWheelTick resolution of the default wheel
+const DefaultWheelTick = 10 * time.Millisecond
+
+// Caster target of AfterCast, e.g. *gen.Actor
+type Caster interface {
+	Cast(msg interface{}) ecode.VEI
+}
+
+// WheelTimer one timer of a Wheel
+type WheelTimer struct {
+	w      *Wheel
+	expire int64
+	f      func()
+
+	// links in the slot list, slot nil if fired or stopped
+	slot       *wheelTimerList
+	prev, next *WheelTimer
+}
+
+type wheelTimerList struct {
+	head WheelTimer
+}
+
+// Wheel hierarchical timing wheel, 5 levels of 64 slots. Add and Stop are O(1), timers are fired
+// at tick resolution, never earlier than asked. Callbacks run one by one in the wheel goroutine,
+// they must not block, e.g. cast to a mailbox with a non blocking overflow policy
+type Wheel struct {
+	tick  time.Duration
+	clk   clock.Clock
+	start time.Time
+
+	mu     sync.Mutex
+	now    int64 // ticks advanced
+	levels [wheelLevels][wheelSlots]wheelTimerList
+	count  int
+
+	stop chan struct{}
+	once sync.Once
+}
+
+var (
+	defaultWheel     *Wheel
+	defaultWheelOnce sync.Once
+)
+
+// DefaultWheel shared wheel with DefaultWheelTick, started on first use
+func DefaultWheel() *Wheel {
+	defaultWheelOnce.Do(func() {
+		defaultWheel = NewWheel(DefaultWheelTick)
+	})
+	return defaultWheel
+}
+
+// NewWheel start a wheel advancing every tick of the clock in use, DefaultWheelTick if tick <= 0
+func NewWheel(tick time.Duration) *Wheel {
+	if tick <= 0 {
+		tick = DefaultWheelTick
+	}
+
+	clk := clock.Get()
+	w := &Wheel{tick: tick, clk: clk, start: clk.Now(), stop: make(chan struct{})}
+	for l := range w.levels {
+		for i := range w.levels[l] {
+			list := &w.levels[l][i]
+			list.head.prev, list.head.next = &list.head, &list.head
+		}
+	}
+	go w.run()
+	return w
+}
+
+// Tick resolution of the wheel
+func (w *Wheel) Tick() time.Duration {
+	return w.tick
+}
+
+// Len timers waiting
+func (w *Wheel) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.count
+}
+
+// AfterFunc call f in the wheel goroutine after d rounded up to the tick
+func (w *Wheel) AfterFunc(d time.Duration, f func()) *WheelTimer {
+	if d < 0 {
+		d = 0
+	}
+	// by the clock rather than now, which lags while the wheel catches up
+	at := w.clk.Now().Sub(w.start) + d
+	expire := int64((at + w.tick - 1) / w.tick)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	t := &WheelTimer{w: w, expire: expire, f: f}
+	w.add(t)
+	w.count++
+	return t
+}
+
+// AfterCast cast msg to target after d, the cast error is dropped. The cast runs in the wheel
+// goroutine, target must not block on it
+func (w *Wheel) AfterCast(d time.Duration, target Caster, msg interface{}) *WheelTimer {
+	return w.AfterFunc(d, func() {
+		target.Cast(msg)
+	})
+}
+
+// Close stop advancing, timers not fired are dropped
+func (w *Wheel) Close() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+}
+
+// Stop cancel the timer, false if already fired or stopped
+func (t *WheelTimer) Stop() bool {
+	w := t.w
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if t.slot == nil {
+		return false
+	}
+	t.unlink()
+	w.count--
+	return true
+}
+
+// add put t in the slot of its level, called with mu locked
+func (w *Wheel) add(t *WheelTimer) {
+	expire := t.expire
+	if expire <= w.now {
+		// slot of now already fired, take the next one
+		expire = w.now + 1
+	}
+	if expire-w.now >= wheelSpan {
+		expire = w.now + wheelSpan - 1
+	}
+
+	delta := expire - w.now
+	level := 0
+	for level < wheelLevels-1 && delta >= int64(1)<<(wheelBits*(level+1)) {
+		level++
+	}
+	idx := (expire >> (wheelBits * level)) & wheelMask
+	w.levels[level][idx].push(t)
+}
+
+func (w *Wheel) run() {
+	ticker := w.clk.NewTicker(w.tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C():
+			// catch up ticks lost by a slow callback or a busy machine
+			target := int64(w.clk.Now().Sub(w.start) / w.tick)
+			for w.advance(target) {
+			}
+		}
+	}
+}
+
+// advance one tick if behind target and fire due timers, false if already at target
+func (w *Wheel) advance(target int64) bool {
+	w.mu.Lock()
+	if w.now >= target {
+		w.mu.Unlock()
+		return false
+	}
+
+	w.now++
+	// move timers of higher levels down when the lower level wraps, the ones due now fire now
+	var due []*WheelTimer
+	for level := 1; level < wheelLevels; level++ {
+		if (w.now>>(wheelBits*(level-1)))&wheelMask != 0 {
+			break
+		}
+		list := &w.levels[level][(w.now>>(wheelBits*level))&wheelMask]
+		for t := list.pop(); t != nil; t = list.pop() {
+			if t.expire <= w.now {
+				due = append(due, t)
+				continue
+			}
+			w.add(t)
+		}
+	}
+
+	list := &w.levels[0][w.now&wheelMask]
+	for t := list.pop(); t != nil; t = list.pop() {
+		if t.expire > w.now {
+			// clamped by wheelSpan, not yet
+			w.add(t)
+			continue
+		}
+		due = append(due, t)
+	}
+	w.count -= len(due)
+	w.mu.Unlock()
+
+	for _, t := range due {
+		safeCall(t.f)
+	}
+	return true
+}
+
+func safeCall(f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "TimerWheel callback crash: %v, stack:%s\n", r, debug.Stack())
+		}
+	}()
+	f()
+}
+
+func (l *wheelTimerList) push(t *WheelTimer) {
+	t.slot = l
+	t.prev, t.next = l.head.prev, &l.head
+	l.head.prev.next = t
+	l.head.prev = t
+}
+
+func (l *wheelTimerList) pop() *WheelTimer {
+	t := l.head.next
+	if t == &l.head {
+		return nil
+	}
+	t.unlink()
+	return t
+}
+
+func (t *WheelTimer) unlink() {
+	t.prev.next = t.next
+	t.next.prev = t.prev
+	t.prev, t.next, t.slot = nil, nil, nil
+}
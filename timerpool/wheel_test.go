@@ -0,0 +1,205 @@
+/*
+ * @Author: lipengfei
+ * @Date: 2026-10-18 11:02:13
+ * @LastEditTime: 2026-10-18 11:02:13
+ * @FilePath: /vlgo/timerpool/wheel_test.go
+ * @Description: timing wheel levels, cascading, clamping and stop
+ */
+package timerpool
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/LiPengfei/vlgo/utils/clock"
+)
+
+const testTick = time.Millisecond
+
+// newTestWheel wheel on a fake clock never advanced, so its goroutine stays idle and the test
+// moves it by step
+func newTestWheel(t *testing.T) *Wheel {
+	t.Helper()
+	fc := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	restore := clock.Set(fc)
+	w := NewWheel(testTick)
+	restore()
+	t.Cleanup(w.Close)
+	return w
+}
+
+// step advance w to tick target, firing due timers in the test goroutine
+func step(w *Wheel, target int64) {
+	for w.advance(target) {
+	}
+}
+
+func (w *Wheel) testNow() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.now
+}
+
+func TestWheelFireTick(t *testing.T) {
+	tests := []struct {
+		name string
+		d    time.Duration
+		tick int64
+	}{
+		{"zero", 0, 1},
+		{"negative", -time.Second, 1},
+		{"one tick", testTick, 1},
+		{"rounded up", testTick + testTick/2, 2},
+		{"last of level 0", 63 * testTick, 63},
+		{"first of level 1", 64 * testTick, 64},
+		{"after level 1 start", 65 * testTick, 65},
+		{"last of level 1", 4095 * testTick, 4095},
+		{"first of level 2", 4096 * testTick, 4096},
+		{"cascade level 3", (1<<18 + 7) * testTick, 1<<18 + 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWheel(t)
+			fired := int64(0)
+			w.AfterFunc(tt.d, func() { fired = w.testNow() })
+
+			step(w, tt.tick-1)
+			if fired != 0 {
+				t.Fatalf("fired early at tick %v, want %v", fired, tt.tick)
+			}
+			step(w, tt.tick)
+			if fired != tt.tick {
+				t.Fatalf("fired at tick %v, want %v", fired, tt.tick)
+			}
+			if w.Len() != 0 {
+				t.Fatalf("len %v after fire", w.Len())
+			}
+		})
+	}
+}
+
+func TestWheelOrder(t *testing.T) {
+	w := newTestWheel(t)
+
+	var got []string
+	add := func(name string, ticks int64) {
+		w.AfterFunc(time.Duration(ticks)*testTick, func() { got = append(got, name) })
+	}
+	add("c", 4100)
+	add("a", 10)
+	add("b1", 70)
+	add("b2", 70)
+	add("d", 300000)
+	if w.Len() != 5 {
+		t.Fatalf("len %v, want 5", w.Len())
+	}
+
+	step(w, 300000)
+	want := []string{"a", "b1", "b2", "c", "d"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("fired %v, want %v", got, want)
+	}
+}
+
+func TestWheelStop(t *testing.T) {
+	w := newTestWheel(t)
+
+	fired := map[string]bool{}
+	keep := w.AfterFunc(5*testTick, func() { fired["keep"] = true })
+	drop := w.AfterFunc(5*testTick, func() { fired["drop"] = true })
+	far := w.AfterFunc(5000*testTick, func() { fired["far"] = true })
+
+	if !drop.Stop() || !far.Stop() {
+		t.Fatal("stop of waiting timer returned false")
+	}
+	if drop.Stop() {
+		t.Fatal("second stop returned true")
+	}
+	if w.Len() != 1 {
+		t.Fatalf("len %v, want 1", w.Len())
+	}
+
+	step(w, 6000)
+	if !fired["keep"] || fired["drop"] || fired["far"] {
+		t.Fatalf("fired %v", fired)
+	}
+	if keep.Stop() {
+		t.Fatal("stop after fire returned true")
+	}
+}
+
+// a timer beyond wheelSpan waits in the last level and cascades again until due
+func TestWheelClamp(t *testing.T) {
+	w := newTestWheel(t)
+
+	expire := wheelSpan + 100
+	fired := int64(0)
+	w.AfterFunc(time.Duration(expire)*testTick, func() { fired = w.testNow() })
+
+	// jump close to each cascade of the last level, nothing else is waiting
+	for _, at := range []int64{63 << 24, wheelSpan} {
+		w.mu.Lock()
+		w.now = at - 1
+		w.mu.Unlock()
+		step(w, at)
+		if fired != 0 {
+			t.Fatalf("fired at tick %v, want %v", fired, expire)
+		}
+		if w.Len() != 1 {
+			t.Fatalf("timer lost at tick %v", at)
+		}
+	}
+
+	step(w, expire-1)
+	if fired != 0 {
+		t.Fatalf("fired early at tick %v", fired)
+	}
+	step(w, expire)
+	if fired != expire {
+		t.Fatalf("fired at tick %v, want %v", fired, expire)
+	}
+}
+
+func TestWheelCallbackPanic(t *testing.T) {
+	w := newTestWheel(t)
+
+	fired := false
+	w.AfterFunc(testTick, func() { panic("boom") })
+	w.AfterFunc(testTick, func() { fired = true })
+	step(w, 1)
+	if !fired {
+		t.Fatal("timer after a panic not fired")
+	}
+}
+
+// the wheel goroutine follows the clock it was created with
+func TestWheelRun(t *testing.T) {
+	fc := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	defer clock.Set(fc)()
+	w := NewWheel(10 * time.Millisecond)
+	defer w.Close()
+
+	fired := make(chan time.Time, 2)
+	w.AfterFunc(25*time.Millisecond, func() { fired <- fc.Now() })
+	w.AfterFunc(time.Second, func() { fired <- fc.Now() })
+	// the ticker of the wheel goroutine
+	fc.BlockUntil(1)
+
+	fc.Advance(20 * time.Millisecond)
+	select {
+	case at := <-fired:
+		t.Fatalf("fired early at %v", at)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	fc.Advance(10 * time.Millisecond)
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("not fired after 30ms")
+	}
+	if w.Len() != 1 {
+		t.Fatalf("len %v, want 1", w.Len())
+	}
+}
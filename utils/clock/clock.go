@@ -0,0 +1,153 @@
+/*
+ * @Date: 2026-10-17 23:41:06
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 23:41:06
+ * @FilePath: /vlgo/utils/clock/clock.go
+ * @Description: pluggable clock, real by default, Fake for deterministic tests
+ */
+package clock
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Clock source of time and timers used by gen, timerpool and logproxy
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+	// AfterFunc call f after d, in its own goroutine for Real, in the goroutine advancing a Fake
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer like *time.Timer, C nil for AfterFunc timers
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker like *time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+	Reset(d time.Duration)
+}
+
+type holder struct {
+	c Clock
+}
+
+var current atomic.Value
+
+func init() {
+	current.Store(holder{Real{}})
+}
+
+// Get clock in use
+func Get() Clock {
+	return current.Load().(holder).c
+}
+
+// Set use c from now on, restore set back the previous one. Timers already created keep their clock,
+// set it before starting actors
+func Set(c Clock) (restore func()) {
+	prev := current.Swap(holder{c}).(holder)
+	return func() {
+		current.Store(prev)
+	}
+}
+
+// IsReal the clock in use is the wall clock
+func IsReal() bool {
+	_, ok := Get().(Real)
+	return ok
+}
+
+// Now of the clock in use
+func Now() time.Time {
+	return Get().Now()
+}
+
+// Since of the clock in use
+func Since(t time.Time) time.Duration {
+	return Get().Now().Sub(t)
+}
+
+// Until of the clock in use
+func Until(t time.Time) time.Duration {
+	return t.Sub(Get().Now())
+}
+
+// NewTimer of the clock in use
+func NewTimer(d time.Duration) Timer {
+	return Get().NewTimer(d)
+}
+
+// NewTicker of the clock in use
+func NewTicker(d time.Duration) Ticker {
+	return Get().NewTicker(d)
+}
+
+// AfterFunc of the clock in use
+func AfterFunc(d time.Duration, f func()) Timer {
+	return Get().AfterFunc(d, f)
+}
+
+// After of the clock in use, the timer is not recycled before it fires, prefer NewTimer in loops
+func After(d time.Duration) <-chan time.Time {
+	return Get().NewTimer(d).C()
+}
+
+// Sleep of the clock in use
+func Sleep(d time.Duration) {
+	<-After(d)
+}
+
+// WithTimeout context.WithTimeout driven by the clock in use
+func WithTimeout(parent context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	c := Get()
+	if _, ok := c.(Real); ok {
+		return context.WithTimeout(parent, d)
+	}
+	return newTimerCtx(parent, c, d)
+}
+
+// Real wall clock of package time
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+func (Real) NewTimer(d time.Duration) Timer {
+	return &RealTimer{time.NewTimer(d)}
+}
+
+func (Real) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (Real) AfterFunc(d time.Duration, f func()) Timer {
+	return &RealTimer{time.AfterFunc(d, f)}
+}
+
+// RealTimer timer of Real, exported for pooling by timerpool
+type RealTimer struct {
+	*time.Timer
+}
+
+// C channel of the timer
+func (t *RealTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
@@ -0,0 +1,253 @@
+/*
+ * @Date: 2026-10-17 23:41:06
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-17 23:41:06
+ * @FilePath: /vlgo/utils/clock/fake.go
+ * @Description: manual clock, time only moves by Advance
+ */
+package clock
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake manual clock for tests, timers fire only when Advance or Set pass their time. Channel timers
+// drop a fire if the previous one was not received, as package time does, AfterFunc callbacks run
+// in the goroutine calling Advance
+type Fake struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	seq     uint64
+	waiting []*fakeTimer
+}
+
+type fakeTimer struct {
+	c      *Fake
+	at     time.Time
+	seq    uint64
+	period time.Duration
+	ch     chan time.Time
+	f      func()
+	active bool
+}
+
+// NewFake clock starting at now
+func NewFake(now time.Time) *Fake {
+	c := &Fake{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *Fake) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{c: c, ch: make(chan time.Time, 1)}
+	c.arm(t, d)
+	return t
+}
+
+func (c *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	t := &fakeTimer{c: c, ch: make(chan time.Time, 1), period: d}
+	c.arm(t, d)
+	return fakeTicker{t}
+}
+
+func (c *Fake) AfterFunc(d time.Duration, f func()) Timer {
+	t := &fakeTimer{c: c, f: f}
+	c.arm(t, d)
+	return t
+}
+
+// Advance move the clock by d, firing due timers in time order
+func (c *Fake) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set move the clock to now, never backward, firing due timers in time order
+func (c *Fake) Set(now time.Time) {
+	for {
+		c.mu.Lock()
+		if len(c.waiting) == 0 || c.waiting[0].at.After(now) {
+			if now.After(c.now) {
+				c.now = now
+			}
+			c.mu.Unlock()
+			return
+		}
+
+		t := c.waiting[0]
+		c.waiting = c.waiting[1:]
+		if t.at.After(c.now) {
+			c.now = t.at
+		}
+		t.active = false
+		if t.period > 0 {
+			c.insert(t, t.period)
+		}
+		fireAt := c.now
+		c.mu.Unlock()
+
+		if t.f != nil {
+			t.f()
+			continue
+		}
+		select {
+		case t.ch <- fireAt:
+		default:
+		}
+	}
+}
+
+// Waiting timers not fired or stopped yet
+func (c *Fake) Waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiting)
+}
+
+// BlockUntil wait until at least n timers are waiting, e.g. an actor armed its timeout
+func (c *Fake) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiting) < n {
+		c.cond.Wait()
+	}
+}
+
+// NextAt time of the next timer, false if none
+func (c *Fake) NextAt() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.waiting) == 0 {
+		return time.Time{}, false
+	}
+	return c.waiting[0].at, true
+}
+
+func (c *Fake) arm(t *fakeTimer, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.insert(t, d)
+}
+
+// insert called with mu locked, equal times keep insert order
+func (c *Fake) insert(t *fakeTimer, d time.Duration) {
+	c.seq++
+	t.at, t.seq, t.active = c.now.Add(d), c.seq, true
+	i := sort.Search(len(c.waiting), func(i int) bool {
+		w := c.waiting[i]
+		return w.at.After(t.at) || (w.at.Equal(t.at) && w.seq > t.seq)
+	})
+	c.waiting = append(c.waiting, nil)
+	copy(c.waiting[i+1:], c.waiting[i:])
+	c.waiting[i] = t
+	c.cond.Broadcast()
+}
+
+// remove called with mu locked
+func (c *Fake) remove(t *fakeTimer) bool {
+	if !t.active {
+		return false
+	}
+	for i, w := range c.waiting {
+		if w == t {
+			c.waiting = append(c.waiting[:i], c.waiting[i+1:]...)
+			break
+		}
+	}
+	t.active = false
+	return true
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	return t.c.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	active := t.c.remove(t)
+	t.c.insert(t, d)
+	return active
+}
+
+type fakeTicker struct {
+	t *fakeTimer
+}
+
+func (t fakeTicker) C() <-chan time.Time {
+	return t.t.ch
+}
+
+func (t fakeTicker) Stop() {
+	t.t.Stop()
+}
+
+func (t fakeTicker) Reset(d time.Duration) {
+	t.t.c.mu.Lock()
+	defer t.t.c.mu.Unlock()
+	t.t.c.remove(t.t)
+	t.t.period = d
+	t.t.c.insert(t.t, d)
+}
+
+// timerCtx context with a deadline of a non real clock
+type timerCtx struct {
+	context.Context
+	deadline time.Time
+	cancel   context.CancelFunc
+	timer    Timer
+
+	mu  sync.Mutex
+	err error
+}
+
+func newTimerCtx(parent context.Context, c Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	inner, cancel := context.WithCancel(parent)
+	ctx := &timerCtx{Context: inner, deadline: c.Now().Add(d), cancel: cancel}
+	if pd, ok := parent.Deadline(); ok && pd.Before(ctx.deadline) {
+		ctx.deadline = pd
+	}
+	ctx.timer = c.AfterFunc(d, func() {
+		ctx.mu.Lock()
+		if ctx.err == nil && inner.Err() == nil {
+			ctx.err = context.DeadlineExceeded
+		}
+		ctx.mu.Unlock()
+		cancel()
+	})
+	return ctx, func() {
+		ctx.timer.Stop()
+		cancel()
+	}
+}
+
+func (ctx *timerCtx) Deadline() (time.Time, bool) {
+	return ctx.deadline, true
+}
+
+func (ctx *timerCtx) Err() error {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if ctx.err != nil {
+		return ctx.err
+	}
+	return ctx.Context.Err()
+}
@@ -0,0 +1,219 @@
+/*
+ * @Date: 2026-10-18 11:40:52
+ * @LastEditors: lipengfei
+ * @LastEditTime: 2026-10-18 11:40:52
+ * @FilePath: /vlgo/utils/clock/fake_test.go
+ * @Description: fake clock timers, tickers, ordering and contexts
+ */
+package clock
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeAfterFuncOrder(t *testing.T) {
+	c := NewFake(testStart)
+
+	type fire struct {
+		name string
+		at   time.Duration
+	}
+	var got []fire
+	add := func(name string, d time.Duration) {
+		c.AfterFunc(d, func() { got = append(got, fire{name, c.Now().Sub(testStart)}) })
+	}
+	add("3s", 3*time.Second)
+	add("1s", time.Second)
+	add("2s first", 2*time.Second)
+	add("2s second", 2*time.Second)
+	// armed by a callback, still fired in the same Advance
+	c.AfterFunc(1500*time.Millisecond, func() { add("chained", time.Second) })
+
+	c.Advance(1999 * time.Millisecond)
+	if len(got) != 1 {
+		t.Fatalf("fired %v before 2s", got)
+	}
+	c.Advance(10 * time.Second)
+	want := []fire{
+		{"1s", time.Second},
+		{"2s first", 2 * time.Second},
+		{"2s second", 2 * time.Second},
+		{"chained", 2500 * time.Millisecond},
+		{"3s", 3 * time.Second},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("fired %v, want %v", got, want)
+	}
+	if now := c.Now(); !now.Equal(testStart.Add(11999 * time.Millisecond)) {
+		t.Fatalf("now %v after advance", now)
+	}
+}
+
+func TestFakeTimer(t *testing.T) {
+	c := NewFake(testStart)
+
+	tm := c.NewTimer(time.Second)
+	c.Advance(999 * time.Millisecond)
+	select {
+	case at := <-tm.C():
+		t.Fatalf("fired early at %v", at)
+	default:
+	}
+	c.Advance(time.Millisecond)
+	select {
+	case at := <-tm.C():
+		if !at.Equal(testStart.Add(time.Second)) {
+			t.Fatalf("fired at %v", at)
+		}
+	default:
+		t.Fatal("not fired at 1s")
+	}
+	if tm.Stop() {
+		t.Fatal("stop after fire returned true")
+	}
+
+	if tm.Reset(time.Second) {
+		t.Fatal("reset of a fired timer returned true")
+	}
+	if !tm.Stop() {
+		t.Fatal("stop of an armed timer returned false")
+	}
+	c.Advance(time.Hour)
+	select {
+	case <-tm.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+	if c.Waiting() != 0 {
+		t.Fatalf("waiting %v", c.Waiting())
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	c := NewFake(testStart)
+
+	tk := c.NewTicker(time.Second)
+	c.Advance(time.Second)
+	if at := <-tk.C(); !at.Equal(testStart.Add(time.Second)) {
+		t.Fatalf("tick at %v", at)
+	}
+
+	// ticks not received are dropped, as package time does
+	c.Advance(3 * time.Second)
+	if at := <-tk.C(); !at.Equal(testStart.Add(2 * time.Second)) {
+		t.Fatalf("tick at %v", at)
+	}
+	select {
+	case at := <-tk.C():
+		t.Fatalf("extra tick %v", at)
+	default:
+	}
+
+	tk.Reset(10 * time.Second)
+	if next, _ := c.NextAt(); !next.Equal(testStart.Add(14 * time.Second)) {
+		t.Fatalf("next tick at %v after reset", next)
+	}
+	tk.Stop()
+	if _, ok := c.NextAt(); ok {
+		t.Fatal("stopped ticker still waiting")
+	}
+}
+
+func TestFakeSetNeverBackward(t *testing.T) {
+	c := NewFake(testStart)
+	c.Set(testStart.Add(-time.Hour))
+	if !c.Now().Equal(testStart) {
+		t.Fatalf("now %v after set backward", c.Now())
+	}
+	c.Set(testStart.Add(time.Hour))
+	if !c.Now().Equal(testStart.Add(time.Hour)) {
+		t.Fatalf("now %v after set", c.Now())
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	c := NewFake(testStart)
+
+	fired := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c.AfterFunc(time.Minute, func() { close(fired) })
+	}()
+
+	blocked := make(chan struct{})
+	go func() {
+		c.BlockUntil(1)
+		close(blocked)
+	}()
+	select {
+	case <-blocked:
+	case <-time.After(time.Second):
+		t.Fatal("BlockUntil not released by AfterFunc")
+	}
+	c.Advance(time.Minute)
+	select {
+	case <-fired:
+	default:
+		t.Fatal("not fired by Advance")
+	}
+}
+
+func TestWithTimeoutFake(t *testing.T) {
+	c := NewFake(testStart)
+	defer Set(c)()
+	if IsReal() {
+		t.Fatal("IsReal with a fake clock")
+	}
+
+	ctx, cancel := WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if dl, ok := ctx.Deadline(); !ok || !dl.Equal(testStart.Add(time.Second)) {
+		t.Fatalf("deadline %v %v", dl, ok)
+	}
+	c.Advance(999 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatalf("done early: %v", ctx.Err())
+	}
+	c.Advance(time.Millisecond)
+	<-ctx.Done()
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Fatalf("err %v, want deadline exceeded", ctx.Err())
+	}
+
+	ctx2, cancel2 := WithTimeout(context.Background(), time.Second)
+	cancel2()
+	<-ctx2.Done()
+	if ctx2.Err() != context.Canceled {
+		t.Fatalf("err %v, want canceled", ctx2.Err())
+	}
+	if c.Waiting() != 0 {
+		t.Fatalf("canceled context left %v timers", c.Waiting())
+	}
+
+	parent, cancelParent := WithTimeout(context.Background(), time.Second)
+	defer cancelParent()
+	child, cancelChild := WithTimeout(parent, time.Hour)
+	defer cancelChild()
+	if dl, _ := child.Deadline(); !dl.Equal(testStart.Add(2 * time.Second)) {
+		t.Fatalf("child deadline %v, want the parent one", dl)
+	}
+	c.Advance(time.Second)
+	<-child.Done()
+}
+
+func TestSetRestore(t *testing.T) {
+	c := NewFake(testStart)
+	restore := Set(c)
+	if !Now().Equal(testStart) || Since(testStart) != 0 || Until(testStart.Add(time.Second)) != time.Second {
+		t.Fatal("package functions not on the fake clock")
+	}
+	restore()
+	if !IsReal() {
+		t.Fatal("restore did not set back the real clock")
+	}
+}